@@ -9,6 +9,8 @@ import (
 type Node interface {
 	TokenLiteral() string
 	String() string
+	// Pos returns the position of the node's first token.
+	Pos() token.Position
 }
 
 type Statement interface {
@@ -23,6 +25,7 @@ type HashLiteral struct {
 
 func (i *HashLiteral) expressionNode()      {}
 func (i *HashLiteral) TokenLiteral() string { return i.Token.Literal }
+func (i *HashLiteral) Pos() token.Position  { return i.Token.Pos }
 func (i *HashLiteral) String() string {
 	var out bytes.Buffer
 	pairs := []string{}
@@ -44,6 +47,7 @@ type MacroLiteral struct {
 
 func (ml *MacroLiteral) expressionNode()      {}
 func (ml *MacroLiteral) TokenLiteral() string { return ml.Token.Literal }
+func (ml *MacroLiteral) Pos() token.Position  { return ml.Token.Pos }
 func (ml *MacroLiteral) String() string {
 	var out bytes.Buffer
 
@@ -68,6 +72,9 @@ type Expression interface {
 
 type Program struct {
 	Statements []Statement
+	// Comments lists every comment in the source in order. Each comment is
+	// also attached to the token it precedes or trails.
+	Comments []token.Comment
 }
 
 func (p *Program) TokenLiteral() string {
@@ -78,6 +85,13 @@ func (p *Program) TokenLiteral() string {
 	}
 }
 
+func (p *Program) Pos() token.Position {
+	if len(p.Statements) > 0 {
+		return p.Statements[0].Pos()
+	}
+	return token.Position{}
+}
+
 func (p *Program) String() string {
 	var out bytes.Buffer
 
@@ -95,6 +109,7 @@ type Identifier struct {
 
 func (i *Identifier) expressionNode()      {}
 func (i *Identifier) TokenLiteral() string { return i.Token.Literal }
+func (i *Identifier) Pos() token.Position  { return i.Token.Pos }
 func (i *Identifier) String() string       { return i.Value }
 
 type IntegerLiteral struct {
@@ -104,22 +119,52 @@ type IntegerLiteral struct {
 
 func (i *IntegerLiteral) expressionNode()      {}
 func (i *IntegerLiteral) TokenLiteral() string { return i.Token.Literal }
+func (i *IntegerLiteral) Pos() token.Position  { return i.Token.Pos }
 func (i *IntegerLiteral) String() string       { return i.Token.Literal }
 
-type LetStatement struct {
+type FloatLiteral struct {
 	Token token.Token
-	Name  *Identifier
-	Value Expression
+	Value float64
+}
+
+func (f *FloatLiteral) expressionNode()      {}
+func (f *FloatLiteral) TokenLiteral() string { return f.Token.Literal }
+func (f *FloatLiteral) Pos() token.Position  { return f.Token.Pos }
+func (f *FloatLiteral) String() string       { return f.Token.Literal }
+
+// LetStatement binds Value to Name, or, in a destructuring let such as
+// "let [a, b] = pair;", to the identifiers in Pattern, in which case Name is
+// nil.
+type LetStatement struct {
+	Token   token.Token
+	Name    *Identifier
+	Pattern Expression
+	Value   Expression
+	Export  bool // preceded by "export", at the top level of a module
+}
+
+// IsConst reports whether the statement is a const declaration, whose
+// variables cannot be assigned to.
+func (ls *LetStatement) IsConst() bool {
+	return ls.Token.Type == token.CONST
 }
 
 func (ls *LetStatement) statementNode()       {}
 func (ls *LetStatement) TokenLiteral() string { return ls.Token.Literal }
+func (ls *LetStatement) Pos() token.Position  { return ls.Token.Pos }
 
 func (ls *LetStatement) String() string {
 	var out bytes.Buffer
 
+	if ls.Export {
+		out.WriteString("export ")
+	}
 	out.WriteString(ls.TokenLiteral() + " ")
-	out.WriteString(ls.Name.String())
+	if ls.Pattern != nil {
+		out.WriteString(ls.Pattern.String())
+	} else {
+		out.WriteString(ls.Name.String())
+	}
 
 	out.WriteString(" = ")
 
@@ -140,6 +185,7 @@ type ReturnStatement struct {
 
 func (ls *ReturnStatement) statementNode()       {}
 func (ls *ReturnStatement) TokenLiteral() string { return ls.Token.Literal }
+func (ls *ReturnStatement) Pos() token.Position  { return ls.Token.Pos }
 
 func (ls *ReturnStatement) String() string {
 	var out bytes.Buffer
@@ -156,6 +202,75 @@ func (ls *ReturnStatement) String() string {
 
 }
 
+type ThrowStatement struct {
+	Token token.Token // the 'throw' token
+	Value Expression
+}
+
+func (ts *ThrowStatement) statementNode()       {}
+func (ts *ThrowStatement) TokenLiteral() string { return ts.Token.Literal }
+func (ts *ThrowStatement) Pos() token.Position  { return ts.Token.Pos }
+func (ts *ThrowStatement) String() string {
+	return ts.TokenLiteral() + " " + ts.Value.String() + ";"
+}
+
+// ImportStatement is `import "path" as name;`. It binds name to the
+// module found at path.
+type ImportStatement struct {
+	Token token.Token // the 'import' token
+	Path  string
+	Name  *Identifier
+}
+
+func (is *ImportStatement) statementNode()       {}
+func (is *ImportStatement) TokenLiteral() string { return is.Token.Literal }
+func (is *ImportStatement) Pos() token.Position  { return is.Token.Pos }
+func (is *ImportStatement) String() string {
+	return "import \"" + is.Path + "\" as " + is.Name.String() + ";"
+}
+
+// StructStatement is `struct Name { a, b }`. It binds Name, as a
+// constant, to a constructor of values with the fields a and b.
+type StructStatement struct {
+	Token  token.Token // the 'struct' token
+	Name   *Identifier
+	Fields []*Identifier
+	Export bool // see LetStatement
+}
+
+func (ss *StructStatement) statementNode()       {}
+func (ss *StructStatement) TokenLiteral() string { return ss.Token.Literal }
+func (ss *StructStatement) Pos() token.Position  { return ss.Token.Pos }
+func (ss *StructStatement) String() string {
+	var out bytes.Buffer
+
+	if ss.Export {
+		out.WriteString("export ")
+	}
+	out.WriteString("struct " + ss.Name.String() + " {")
+	for i, f := range ss.Fields {
+		if i > 0 {
+			out.WriteString(",")
+		}
+		out.WriteString(" " + f.String())
+	}
+	if len(ss.Fields) > 0 {
+		out.WriteString(" ")
+	}
+	out.WriteString("}")
+
+	return out.String()
+}
+
+// FieldNames returns the names of the struct's fields, in order.
+func (ss *StructStatement) FieldNames() []string {
+	names := make([]string, len(ss.Fields))
+	for i, f := range ss.Fields {
+		names[i] = f.Value
+	}
+	return names
+}
+
 type ExpressionStatement struct {
 	Token      token.Token
 	Expression Expression
@@ -163,6 +278,7 @@ type ExpressionStatement struct {
 
 func (ls *ExpressionStatement) statementNode()       {}
 func (ls *ExpressionStatement) TokenLiteral() string { return ls.Token.Literal }
+func (ls *ExpressionStatement) Pos() token.Position  { return ls.Token.Pos }
 
 func (ls *ExpressionStatement) String() string {
 
@@ -182,6 +298,7 @@ type PrefixExpression struct {
 
 func (pe *PrefixExpression) expressionNode()      {}
 func (pe *PrefixExpression) TokenLiteral() string { return pe.Token.Literal }
+func (pe *PrefixExpression) Pos() token.Position  { return pe.Token.Pos }
 func (pe *PrefixExpression) String() string {
 	var out bytes.Buffer
 
@@ -202,6 +319,7 @@ type InfixExpression struct {
 
 func (pe *InfixExpression) expressionNode()      {}
 func (pe *InfixExpression) TokenLiteral() string { return pe.Token.Literal }
+func (pe *InfixExpression) Pos() token.Position  { return pe.Token.Pos }
 func (pe *InfixExpression) String() string {
 	var out bytes.Buffer
 
@@ -214,6 +332,29 @@ func (pe *InfixExpression) String() string {
 	return out.String()
 }
 
+// AssignExpression is "target = value" or a compound assignment such as
+// "target += value", in which case Operator is the arithmetic operator
+// ("+") and Token is the assignment token ("+=").
+type AssignExpression struct {
+	Token    token.Token
+	Target   Expression
+	Operator string
+	Value    Expression
+}
+
+func (ae *AssignExpression) expressionNode()      {}
+func (ae *AssignExpression) TokenLiteral() string { return ae.Token.Literal }
+func (ae *AssignExpression) Pos() token.Position  { return ae.Token.Pos }
+func (ae *AssignExpression) String() string {
+	var out bytes.Buffer
+
+	out.WriteString(ae.Target.String())
+	out.WriteString(" " + ae.Token.Literal + " ")
+	out.WriteString(ae.Value.String())
+
+	return out.String()
+}
+
 type Boolean struct {
 	Token token.Token
 	Value bool
@@ -221,10 +362,20 @@ type Boolean struct {
 
 func (pe *Boolean) expressionNode()      {}
 func (pe *Boolean) TokenLiteral() string { return pe.Token.Literal }
+func (pe *Boolean) Pos() token.Position  { return pe.Token.Pos }
 func (pe *Boolean) String() string {
 	return pe.Token.Literal
 }
 
+type NullLiteral struct {
+	Token token.Token
+}
+
+func (nl *NullLiteral) expressionNode()      {}
+func (nl *NullLiteral) TokenLiteral() string { return nl.Token.Literal }
+func (nl *NullLiteral) Pos() token.Position  { return nl.Token.Pos }
+func (nl *NullLiteral) String() string       { return nl.Token.Literal }
+
 type IfExpression struct {
 	Token       token.Token
 	Condition   Expression
@@ -234,6 +385,7 @@ type IfExpression struct {
 
 func (pe *IfExpression) expressionNode()      {}
 func (pe *IfExpression) TokenLiteral() string { return pe.Token.Literal }
+func (pe *IfExpression) Pos() token.Position  { return pe.Token.Pos }
 func (pe *IfExpression) String() string {
 	var out bytes.Buffer
 
@@ -249,6 +401,164 @@ func (pe *IfExpression) String() string {
 	return out.String()
 }
 
+// TryExpression evaluates Block and, if it throws, Catch with the thrown
+// value bound to CatchParam. Finally, if present, runs however they end.
+// The value of the expression is that of Block or Catch.
+type TryExpression struct {
+	Token      token.Token // the 'try' token
+	Block      *BlockStatement
+	CatchParam *Identifier
+	Catch      *BlockStatement
+	Finally    *BlockStatement
+}
+
+func (te *TryExpression) expressionNode()      {}
+func (te *TryExpression) TokenLiteral() string { return te.Token.Literal }
+func (te *TryExpression) Pos() token.Position  { return te.Token.Pos }
+func (te *TryExpression) String() string {
+	var out bytes.Buffer
+
+	out.WriteString("try ")
+	out.WriteString(te.Block.String())
+	if te.Catch != nil {
+		out.WriteString(" catch (")
+		out.WriteString(te.CatchParam.String())
+		out.WriteString(") ")
+		out.WriteString(te.Catch.String())
+	}
+	if te.Finally != nil {
+		out.WriteString(" finally ")
+		out.WriteString(te.Finally.String())
+	}
+
+	return out.String()
+}
+
+// MatchExpression is "match (subject) { pattern => body, ... }". The
+// first arm whose pattern matches the subject and whose guard, if any, is
+// truthy is evaluated.
+type MatchExpression struct {
+	Token   token.Token // The 'match' token
+	Subject Expression
+	Arms    []*MatchArm
+}
+
+func (me *MatchExpression) expressionNode()      {}
+func (me *MatchExpression) TokenLiteral() string { return me.Token.Literal }
+func (me *MatchExpression) Pos() token.Position  { return me.Token.Pos }
+func (me *MatchExpression) String() string {
+	var out bytes.Buffer
+
+	arms := []string{}
+	for _, arm := range me.Arms {
+		arms = append(arms, arm.String())
+	}
+
+	out.WriteString("match (")
+	out.WriteString(me.Subject.String())
+	out.WriteString(") {")
+	out.WriteString(strings.Join(arms, ", "))
+	out.WriteString("}")
+
+	return out.String()
+}
+
+// MatchArm is one "pattern if guard => body" arm of a match expression.
+// Guard is nil if the arm has none. An expression body is wrapped in a
+// block holding a single expression statement.
+type MatchArm struct {
+	Pattern Expression
+	Guard   Expression
+	Body    *BlockStatement
+}
+
+func (ma *MatchArm) String() string {
+	var out bytes.Buffer
+
+	out.WriteString(ma.Pattern.String())
+	if ma.Guard != nil {
+		out.WriteString(" if " + ma.Guard.String())
+	}
+	out.WriteString(" => ")
+	out.WriteString(ma.Body.String())
+
+	return out.String()
+}
+
+// ArrayPattern matches an array with one element per pattern in Elements,
+// or at least that many if there is a "...rest" element, in which case
+// Rest is bound to the remaining elements.
+type ArrayPattern struct {
+	Token    token.Token // the '[' token
+	Elements []Expression
+	Rest     *Identifier
+}
+
+func (ap *ArrayPattern) expressionNode()      {}
+func (ap *ArrayPattern) TokenLiteral() string { return ap.Token.Literal }
+func (ap *ArrayPattern) Pos() token.Position  { return ap.Token.Pos }
+func (ap *ArrayPattern) String() string {
+	elements := []string{}
+	for _, el := range ap.Elements {
+		elements = append(elements, el.String())
+	}
+	if ap.Rest != nil {
+		elements = append(elements, "..."+ap.Rest.String())
+	}
+	return "[" + strings.Join(elements, ", ") + "]"
+}
+
+// HashPattern matches a hash that has all of Keys, with the value of each
+// key matching the pattern at the same index in Values. Other keys are
+// ignored.
+type HashPattern struct {
+	Token  token.Token // the '{' token
+	Keys   []Expression
+	Values []Expression
+}
+
+func (hp *HashPattern) expressionNode()      {}
+func (hp *HashPattern) TokenLiteral() string { return hp.Token.Literal }
+func (hp *HashPattern) Pos() token.Position  { return hp.Token.Pos }
+func (hp *HashPattern) String() string {
+	pairs := []string{}
+	for i, key := range hp.Keys {
+		// A key bound to a variable of its own name prints as {name}.
+		str, ok := key.(*StringLiteral)
+		ident, ok2 := hp.Values[i].(*Identifier)
+		if ok && ok2 && str.Value == ident.Value {
+			pairs = append(pairs, ident.String())
+			continue
+		}
+		pairs = append(pairs, key.String()+":"+hp.Values[i].String())
+	}
+	return "{" + strings.Join(pairs, ", ") + "}"
+}
+
+// PatternNames returns the names of the variables pattern binds, leaving
+// out the wildcard _.
+func PatternNames(pattern Expression) []string {
+	names := []string{}
+	switch pattern := pattern.(type) {
+	case *Identifier:
+		if pattern.Value != "_" {
+			names = append(names, pattern.Value)
+		}
+	case *ArrayPattern:
+		for _, element := range pattern.Elements {
+			names = append(names, PatternNames(element)...)
+		}
+		if pattern.Rest != nil {
+			names = append(names, PatternNames(pattern.Rest)...)
+		}
+	case *HashPattern:
+		for _, value := range pattern.Values {
+			names = append(names, PatternNames(value)...)
+		}
+	}
+	return names
+}
+
 type BlockStatement struct {
 	Token      token.Token
 	Statements []Statement
@@ -256,6 +566,7 @@ type BlockStatement struct {
 
 func (pe *BlockStatement) statementNode()       {}
 func (pe *BlockStatement) TokenLiteral() string { return pe.Token.Literal }
+func (pe *BlockStatement) Pos() token.Position  { return pe.Token.Pos }
 func (pe *BlockStatement) String() string {
 	var out bytes.Buffer
 
@@ -266,32 +577,158 @@ func (pe *BlockStatement) String() string {
 	return out.String()
 }
 
+type WhileStatement struct {
+	Token     token.Token // The 'while' token
+	Condition Expression
+	Body      *BlockStatement
+}
+
+func (ws *WhileStatement) statementNode()       {}
+func (ws *WhileStatement) TokenLiteral() string { return ws.Token.Literal }
+func (ws *WhileStatement) Pos() token.Position  { return ws.Token.Pos }
+func (ws *WhileStatement) String() string {
+	var out bytes.Buffer
+
+	out.WriteString("while")
+	out.WriteString(ws.Condition.String())
+	out.WriteString(" ")
+	out.WriteString(ws.Body.String())
+
+	return out.String()
+}
+
+// ForStatement is a C-style "for (init; condition; step) { body }" loop.
+// Init, Condition and Step are all optional; a missing Condition is always
+// true.
+type ForStatement struct {
+	Token     token.Token // The 'for' token
+	Init      Statement
+	Condition Expression
+	Step      Expression
+	Body      *BlockStatement
+}
+
+func (fs *ForStatement) statementNode()       {}
+func (fs *ForStatement) TokenLiteral() string { return fs.Token.Literal }
+func (fs *ForStatement) Pos() token.Position  { return fs.Token.Pos }
+func (fs *ForStatement) String() string {
+	var out bytes.Buffer
+
+	out.WriteString("for (")
+	if fs.Init != nil {
+		out.WriteString(strings.TrimSuffix(fs.Init.String(), ";"))
+	}
+	out.WriteString("; ")
+	if fs.Condition != nil {
+		out.WriteString(fs.Condition.String())
+	}
+	out.WriteString("; ")
+	if fs.Step != nil {
+		out.WriteString(fs.Step.String())
+	}
+	out.WriteString(") ")
+	out.WriteString(fs.Body.String())
+
+	return out.String()
+}
+
+// ForInStatement is "for (value in iterable) { body }" or
+// "for (key, value in iterable) { body }". Key is nil in the first form.
+type ForInStatement struct {
+	Token    token.Token // The 'for' token
+	Key      *Identifier
+	Value    *Identifier
+	Iterable Expression
+	Body     *BlockStatement
+}
+
+func (fs *ForInStatement) statementNode()       {}
+func (fs *ForInStatement) TokenLiteral() string { return fs.Token.Literal }
+func (fs *ForInStatement) Pos() token.Position  { return fs.Token.Pos }
+func (fs *ForInStatement) String() string {
+	var out bytes.Buffer
+
+	out.WriteString("for (")
+	if fs.Key != nil {
+		out.WriteString(fs.Key.String() + ", ")
+	}
+	out.WriteString(fs.Value.String())
+	out.WriteString(" in ")
+	out.WriteString(fs.Iterable.String())
+	out.WriteString(") ")
+	out.WriteString(fs.Body.String())
+
+	return out.String()
+}
+
+type BreakStatement struct {
+	Token token.Token
+}
+
+func (bs *BreakStatement) statementNode()       {}
+func (bs *BreakStatement) TokenLiteral() string { return bs.Token.Literal }
+func (bs *BreakStatement) Pos() token.Position  { return bs.Token.Pos }
+func (bs *BreakStatement) String() string       { return "break;" }
+
+type ContinueStatement struct {
+	Token token.Token
+}
+
+func (cs *ContinueStatement) statementNode()       {}
+func (cs *ContinueStatement) TokenLiteral() string { return cs.Token.Literal }
+func (cs *ContinueStatement) Pos() token.Position  { return cs.Token.Pos }
+func (cs *ContinueStatement) String() string       { return "continue;" }
+
 type FunctionLiteral struct {
 	Token      token.Token
 	Parameters []*Identifier
-	Body       *BlockStatement
-	Name       string
+	// Patterns holds the pattern of each destructured parameter, whose
+	// entry in Parameters is then an unnamed placeholder. It is nil if no
+	// parameter is destructured.
+	Patterns []Expression
+	// Defaults holds the default value of each optional parameter, and is
+	// nil if no parameter has one. Rest collects any further arguments.
+	Defaults []Expression
+	Rest     *Identifier
+	Body     *BlockStatement
+	Name     string
 }
 
 func (pe *FunctionLiteral) expressionNode()      {}
 func (pe *FunctionLiteral) TokenLiteral() string { return pe.Token.Literal }
+func (pe *FunctionLiteral) Pos() token.Position  { return pe.Token.Pos }
 func (pe *FunctionLiteral) String() string {
 	var out bytes.Buffer
 
-	params := []string{}
-	for _, p := range pe.Parameters {
-		params = append(params, p.String())
-	}
-
 	out.WriteString(pe.TokenLiteral())
 	out.WriteString("(")
-	out.WriteString(strings.Join(params, ", "))
+	out.WriteString(ParameterList(pe.Parameters, pe.Patterns, pe.Defaults, pe.Rest))
 	out.WriteString(")")
 	out.WriteString(pe.Body.String())
 
 	return out.String()
 }
 
+// ParameterList formats the parameters of a function for String and
+// Inspect methods.
+func ParameterList(parameters []*Identifier, patterns, defaults []Expression, rest *Identifier) string {
+	params := []string{}
+	for i, p := range parameters {
+		param := p.String()
+		if patterns != nil && patterns[i] != nil {
+			param = patterns[i].String()
+		}
+		if defaults != nil && defaults[i] != nil {
+			param += " = " + defaults[i].String()
+		}
+		params = append(params, param)
+	}
+	if rest != nil {
+		params = append(params, "..."+rest.String())
+	}
+	return strings.Join(params, ", ")
+}
+
 type CallExpression struct {
 	Token     token.Token
 	Function  Expression
@@ -300,6 +737,7 @@ type CallExpression struct {
 
 func (pe *CallExpression) expressionNode()      {}
 func (pe *CallExpression) TokenLiteral() string { return pe.Token.Literal }
+func (pe *CallExpression) Pos() token.Position  { return pe.Token.Pos }
 func (pe *CallExpression) String() string {
 	var out bytes.Buffer
 
@@ -316,6 +754,41 @@ func (pe *CallExpression) String() string {
 	return out.String()
 }
 
+// MethodCallExpression is receiver.method(arguments). It calls the
+// function stored under "method" if the receiver is a hash with that key,
+// and otherwise the builtin of that name with the receiver as its first
+// argument. A plain receiver.field parses to an IndexExpression.
+type MethodCallExpression struct {
+	Token     token.Token // the '.' or '?.' token
+	Receiver  Expression
+	Method    *Identifier
+	Arguments []Expression
+	// Optional is set for receiver?.method(), which is null, along with
+	// the rest of the chain it is in, if the receiver is null.
+	Optional bool
+}
+
+func (mc *MethodCallExpression) expressionNode()      {}
+func (mc *MethodCallExpression) TokenLiteral() string { return mc.Token.Literal }
+func (mc *MethodCallExpression) Pos() token.Position  { return mc.Token.Pos }
+func (mc *MethodCallExpression) String() string {
+	var out bytes.Buffer
+
+	args := []string{}
+	for _, a := range mc.Arguments {
+		args = append(args, a.String())
+	}
+
+	out.WriteString(mc.Receiver.String())
+	out.WriteString(optional(mc.Optional, "."))
+	out.WriteString(mc.Method.String())
+	out.WriteString("(")
+	out.WriteString(strings.Join(args, ", "))
+	out.WriteString(")")
+
+	return out.String()
+}
+
 type StringLiteral struct {
 	Token token.Token
 	Value string
@@ -323,8 +796,37 @@ type StringLiteral struct {
 
 func (sl *StringLiteral) expressionNode()      {}
 func (sl *StringLiteral) TokenLiteral() string { return sl.Token.Literal }
+func (sl *StringLiteral) Pos() token.Position  { return sl.Token.Pos }
 func (sl *StringLiteral) String() string       { return sl.Token.Literal }
 
+// InterpolatedString is a string literal with embedded "${expr}"
+// expressions. Parts holds the literal text segments as *StringLiteral
+// nodes, with empty segments left out, and the embedded expressions in
+// source order.
+type InterpolatedString struct {
+	Token token.Token // the token.INTERP_START token
+	Parts []Expression
+}
+
+func (is *InterpolatedString) expressionNode()      {}
+func (is *InterpolatedString) TokenLiteral() string { return is.Token.Literal }
+func (is *InterpolatedString) Pos() token.Position  { return is.Token.Pos }
+func (is *InterpolatedString) String() string {
+	var out bytes.Buffer
+
+	out.WriteString("\"")
+	for _, part := range is.Parts {
+		if s, ok := part.(*StringLiteral); ok {
+			out.WriteString(s.Value)
+		} else {
+			out.WriteString("${" + part.String() + "}")
+		}
+	}
+	out.WriteString("\"")
+
+	return out.String()
+}
+
 type ArrayLiteral struct {
 	token.Token // the '[' token
 	Elements    []Expression
@@ -332,6 +834,7 @@ type ArrayLiteral struct {
 
 func (al *ArrayLiteral) expressionNode()      {}
 func (al *ArrayLiteral) TokenLiteral() string { return al.Token.Literal }
+func (al *ArrayLiteral) Pos() token.Position  { return al.Token.Pos }
 func (al *ArrayLiteral) String() string {
 	var out bytes.Buffer
 
@@ -347,22 +850,95 @@ func (al *ArrayLiteral) String() string {
 	return out.String()
 }
 
+// SliceExpression is left[start:end]. Start and End are nil when omitted.
+type SliceExpression struct {
+	Token    token.Token // the '[' or '?[' token
+	Left     Expression
+	Start    Expression
+	End      Expression
+	Optional bool // see IndexExpression
+}
+
+func (se *SliceExpression) expressionNode()      {}
+func (se *SliceExpression) TokenLiteral() string { return se.Token.Literal }
+func (se *SliceExpression) Pos() token.Position  { return se.Token.Pos }
+func (se *SliceExpression) String() string {
+	var out bytes.Buffer
+
+	out.WriteString("(")
+	out.WriteString(se.Left.String())
+	out.WriteString(optional(se.Optional, "["))
+	if se.Start != nil {
+		out.WriteString(se.Start.String())
+	}
+	out.WriteString(":")
+	if se.End != nil {
+		out.WriteString(se.End.String())
+	}
+	out.WriteString("])")
+
+	return out.String()
+}
+
+// SpreadExpression expands an array into the surrounding argument list or
+// array literal.
+type SpreadExpression struct {
+	Token token.Token // the '...' token
+	Value Expression
+}
+
+func (se *SpreadExpression) expressionNode()      {}
+func (se *SpreadExpression) TokenLiteral() string { return se.Token.Literal }
+func (se *SpreadExpression) Pos() token.Position  { return se.Token.Pos }
+func (se *SpreadExpression) String() string       { return "..." + se.Value.String() }
+
 type IndexExpression struct {
 	Token token.Token
 	Left  Expression
 	Index Expression
+	// Optional is set for left?[index] and left?.name, which are null,
+	// along with the rest of the chain they are in, if left is null.
+	Optional bool
+	// Dot is set for left.name, whose Index is name as a string literal.
+	Dot bool
 }
 
 func (ie *IndexExpression) expressionNode()      {}
 func (ie *IndexExpression) TokenLiteral() string { return ie.Token.Literal }
+func (ie *IndexExpression) Pos() token.Position  { return ie.Token.Pos }
 func (ie *IndexExpression) String() string {
 	var out bytes.Buffer
 
 	out.WriteString("(")
 	out.WriteString(ie.Left.String())
-	out.WriteString("[")
+	if ie.Dot {
+		out.WriteString(optional(ie.Optional, "."))
+		out.WriteString(ie.Index.String())
+		out.WriteString(")")
+		return out.String()
+	}
+	out.WriteString(optional(ie.Optional, "["))
 	out.WriteString(ie.Index.String())
 	out.WriteString("])")
 
 	return out.String()
 }
+
+// IsChain reports whether node is an access or call, the links of a chain
+// such as a?.b.c(d) that an optional access can cut short.
+func IsChain(node Node) bool {
+	switch node.(type) {
+	case *IndexExpression, *SliceExpression, *MethodCallExpression, *CallExpression:
+		return true
+	}
+	return false
+}
+
+// optional returns the operator op of an access, prefixed with "?" if the
+// access is optional.
+func optional(isOptional bool, op string) string {
+	if isOptional {
+		return "?" + op
+	}
+	return op
+}
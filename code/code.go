@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"encoding/binary"
 	"fmt"
+	"monkey/token"
 )
 
 type Instructions []byte
@@ -74,6 +75,47 @@ const (
 	OpClosure
 	OpGetFree
 	OpCurrentClosure
+	OpConcat
+	OpJumpNotTruthyOrPop
+	OpJumpTruthyOrPop
+	OpLessThan
+	OpLessEqual
+	OpGreaterEqual
+	OpMod
+	OpPow
+	OpBitAnd
+	OpBitOr
+	OpBitXor
+	OpShiftLeft
+	OpShiftRight
+	OpBitNot
+	OpCaptureLocal
+	OpCaptureFree
+	OpAssignLocal
+	OpAssignFree
+	OpRange
+	OpGetIterator
+	OpIterNext
+	OpMatchArray
+	OpMatchHash
+	OpHasKey
+	OpArrayRest
+	OpMatchError
+	OpDestructureError
+	OpSpread
+	OpCallSpread
+	OpArgMissing
+	OpSlice
+	OpSetIndex
+	OpDup2
+	OpGetMethod
+	OpTry
+	OpEndTry
+	OpThrow
+	OpCatch
+	OpImport
+	OpJumpNotNullOrPop
+	OpJumpNull
 )
 
 type Definition struct {
@@ -112,6 +154,104 @@ var definitions = map[Opcode]*Definition{
 	OpClosure:        {"OpGetBuiltin", []int{2, 1}},
 	OpGetFree:        {"OpGetFree", []int{1}},
 	OpCurrentClosure: {"OpCurrentClosure", []int{}},
+	OpConcat:         {"OpConcat", []int{2}},
+
+	// OpJumpNotTruthyOrPop and OpJumpTruthyOrPop jump, keeping the value on
+	// top of the stack, if it decides the result of && or ||. Otherwise
+	// they pop it and fall through to the right operand.
+	OpJumpNotTruthyOrPop: {"OpJumpNotTruthyOrPop", []int{2}},
+	OpJumpTruthyOrPop:    {"OpJumpTruthyOrPop", []int{2}},
+
+	OpLessThan:     {"OpLessThan", []int{}},
+	OpLessEqual:    {"OpLessEqual", []int{}},
+	OpGreaterEqual: {"OpGreaterEqual", []int{}},
+	OpMod:          {"OpMod", []int{}},
+	OpPow:          {"OpPow", []int{}},
+	OpBitAnd:       {"OpBitAnd", []int{}},
+	OpBitOr:        {"OpBitOr", []int{}},
+	OpBitXor:       {"OpBitXor", []int{}},
+	OpShiftLeft:    {"OpShiftLeft", []int{}},
+	OpShiftRight:   {"OpShiftRight", []int{}},
+	OpBitNot:       {"OpBitNot", []int{}},
+
+	// OpCaptureLocal and OpCaptureFree push the cell holding a variable for
+	// OpClosure, boxing a local into a cell the first time it is captured.
+	// OpAssignLocal and OpAssignFree store through the variable's cell.
+	OpCaptureLocal: {"OpCaptureLocal", []int{1}},
+	OpCaptureFree:  {"OpCaptureFree", []int{1}},
+	OpAssignLocal:  {"OpAssignLocal", []int{1}},
+	OpAssignFree:   {"OpAssignFree", []int{1}},
+
+	OpRange: {"OpRange", []int{}},
+
+	// OpGetIterator replaces the iterable on top of the stack with an
+	// iterator over it. OpIterNext pushes the key and then the value of the
+	// iterator's next element, leaving the iterator below them, or jumps to
+	// its operand once the iterator is exhausted.
+	OpGetIterator: {"OpGetIterator", []int{}},
+	OpIterNext:    {"OpIterNext", []int{2}},
+
+	// OpMatchArray replaces the value on top of the stack with whether it
+	// is an array of exactly the first operand's length, or at least that
+	// long if the second operand is 1. OpMatchHash tests for a hash and
+	// OpHasKey for a key in the hash below it. OpArrayRest replaces an array
+	// with its elements from the operand's index on. OpMatchError raises
+	// the error for a value that no match arm matched.
+	OpMatchArray: {"OpMatchArray", []int{2, 1}},
+	OpMatchHash:  {"OpMatchHash", []int{}},
+	OpHasKey:     {"OpHasKey", []int{}},
+	OpArrayRest:  {"OpArrayRest", []int{2}},
+	OpMatchError: {"OpMatchError", []int{}},
+
+	// OpDestructureError raises the error for a value that does not have
+	// the shape of the pattern named by the constant at its operand.
+	OpDestructureError: {"OpDestructureError", []int{2}},
+
+	// OpSpread pops an array and the array below it and pushes the second
+	// extended with the elements of the first. OpCallSpread pops an array
+	// of arguments and calls the function below it with them.
+	OpSpread:     {"OpSpread", []int{}},
+	OpCallSpread: {"OpCallSpread", []int{}},
+
+	// OpArgMissing pushes whether the call left the parameter at its
+	// operand's index without an argument, so its default is needed.
+	OpArgMissing: {"OpArgMissing", []int{1}},
+
+	// OpSlice pops the end and start of a slice, either of which is null
+	// if omitted, and replaces the value below them with the slice.
+	OpSlice: {"OpSlice", []int{}},
+
+	// OpSetIndex pops a value, an index and a collection, stores the value
+	// in the collection at the index and pushes the value. OpDup2 pushes
+	// copies of the top two values on the stack.
+	OpSetIndex: {"OpSetIndex", []int{}},
+	OpDup2:     {"OpDup2", []int{}},
+
+	// OpGetMethod replaces the receiver on top of the stack with the
+	// function that calls the method named by the constant at its operand.
+	OpGetMethod: {"OpGetMethod", []int{2}},
+
+	// OpTry installs a handler in the current frame that jumps to its
+	// operand with the error on the stack, and OpEndTry removes it.
+	// OpThrow pops a value and raises it, re-raising it unchanged if it
+	// is an error. OpCatch replaces the error on top of the stack with
+	// the value a catch clause binds.
+	OpTry:    {"OpTry", []int{2}},
+	OpEndTry: {"OpEndTry", []int{}},
+	OpThrow:  {"OpThrow", []int{}},
+	OpCatch:  {"OpCatch", []int{}},
+
+	// OpImport pushes the module whose top-level code is the function
+	// constant at its first operand, running the code the first time. The
+	// second operand is the constant of the import path, for errors.
+	OpImport: {"OpImport", []int{2, 2}},
+
+	// OpJumpNotNullOrPop jumps, keeping the value on top of the stack, if
+	// it is not null, and pops it otherwise, for ??. OpJumpNull jumps past
+	// the rest of an optional chain if the value on top of the stack is
+	// null, leaving it as the chain's value.
+	OpJumpNotNullOrPop: {"OpJumpNotNullOrPop", []int{2}},
+	OpJumpNull:         {"OpJumpNull", []int{2}},
 }
 
 func Lookup(op byte) (*Definition, error) {
@@ -170,3 +310,41 @@ func ReadUInt16(ins Instructions) int {
 func ReadUInt8(ins Instructions) uint8 {
 	return uint8(ins[0])
 }
+
+// SourceMap maps instruction offsets back to the source positions they were
+// compiled from. Entries are ordered by offset and an entry covers every
+// instruction up to the next one.
+type SourceMap []SourceMapEntry
+
+type SourceMapEntry struct {
+	Offset int
+	Pos    token.Position
+}
+
+// Add records that the instruction at offset was compiled from pos. It is a
+// no-op if the previous entry already maps to pos.
+func (sm SourceMap) Add(offset int, pos token.Position) SourceMap {
+	if n := len(sm); n > 0 && sm[n-1].Pos == pos {
+		return sm
+	}
+	return append(sm, SourceMapEntry{Offset: offset, Pos: pos})
+}
+
+// Truncate drops all entries at or after offset.
+func (sm SourceMap) Truncate(offset int) SourceMap {
+	i := len(sm)
+	for i > 0 && sm[i-1].Offset >= offset {
+		i--
+	}
+	return sm[:i]
+}
+
+// Lookup returns the source position of the instruction at offset.
+func (sm SourceMap) Lookup(offset int) (token.Position, bool) {
+	for i := len(sm) - 1; i >= 0; i-- {
+		if sm[i].Offset <= offset {
+			return sm[i].Pos, true
+		}
+	}
+	return token.Position{}, false
+}
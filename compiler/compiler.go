@@ -1,10 +1,13 @@
 package compiler
 
 import (
+	"errors"
 	"fmt"
 	"monkey/ast"
 	"monkey/code"
+	"monkey/module"
 	"monkey/object"
+	"monkey/token"
 	"sort"
 )
 
@@ -15,8 +18,20 @@ type EmittedInstruction struct {
 
 type CompilationScope struct {
 	instructions        code.Instructions
+	sourceMap           code.SourceMap
 	lastInstruction     EmittedInstruction
 	previousInstruction EmittedInstruction
+	loops               []*loop
+	temps               int                   // hidden variables in use, see allocTemp
+	handlers            []*ast.BlockStatement // see pushHandler
+}
+
+// loop records the jumps emitted for break and continue statements in a
+// loop body, which are patched once the loop's layout is known.
+type loop struct {
+	breaks    []int
+	continues []int
+	handlers  int // handlers in effect outside the loop
 }
 
 type Compiler struct {
@@ -27,6 +42,41 @@ type Compiler struct {
 	symbolTable         *SymbolTable
 	scopes              []CompilationScope
 	scopeIndex          int
+	pos                 token.Position // position of the node being compiled
+	chained             bool           // see compileChainLeft
+	nullJumps           []int          // OpJumpNull jumps of the current chain
+	loader              *module.Loader
+	filename            string // file being compiled, see SetModuleLoader
+}
+
+var infixOperators = map[string]code.Opcode{
+	"+":  code.OpAdd,
+	"-":  code.OpSub,
+	"*":  code.OpMul,
+	"/":  code.OpDiv,
+	"%":  code.OpMod,
+	"**": code.OpPow,
+	"==": code.OpEqual,
+	"!=": code.OpNotEqual,
+	">":  code.OpGreaterThan,
+	"<":  code.OpLessThan,
+	">=": code.OpGreaterEqual,
+	"<=": code.OpLessEqual,
+	"&":  code.OpBitAnd,
+	"|":  code.OpBitOr,
+	"^":  code.OpBitXor,
+	"<<": code.OpShiftLeft,
+	">>": code.OpShiftRight,
+	"..": code.OpRange,
+}
+
+// shortCircuitOperators maps the operators whose right operand is only
+// evaluated if the left one does not decide the result to the jump that
+// skips it.
+var shortCircuitOperators = map[string]code.Opcode{
+	"&&": code.OpJumpNotTruthyOrPop,
+	"||": code.OpJumpTruthyOrPop,
+	"??": code.OpJumpNotNullOrPop,
 }
 
 func NewWithState(s *SymbolTable, constants []object.Object) *Compiler {
@@ -61,6 +111,26 @@ func (c *Compiler) currentInstructions() code.Instructions {
 }
 
 func (c *Compiler) Compile(node ast.Node) error {
+	if node != nil {
+		if pos := node.Pos(); pos.IsValid() {
+			outerPos := c.pos
+			c.pos = pos
+			defer func() { c.pos = outerPos }()
+		}
+	}
+
+	// An access or call starts a chain unless it is the left side of one.
+	chained := c.chained
+	c.chained = false
+	if !chained && ast.IsChain(node) {
+		outerJumps := c.nullJumps
+		c.nullJumps = nil
+		defer func() {
+			c.patchJumps(c.nullJumps, len(c.currentInstructions()))
+			c.nullJumps = outerJumps
+		}()
+	}
+
 	switch node := node.(type) {
 	case *ast.Program:
 		for _, s := range node.Statements {
@@ -69,49 +139,88 @@ func (c *Compiler) Compile(node ast.Node) error {
 				return err
 			}
 		}
+		// The value of a program is the last value popped, which a loop
+		// statement at the end would leave as its condition or iterator.
+		if n := len(node.Statements); n > 0 && isLoop(node.Statements[n-1]) {
+			c.emit(code.OpNull)
+			c.emit(code.OpPop)
+		}
 	case *ast.ReturnStatement:
 		err := c.Compile(node.ReturnValue)
 		if err != nil {
 			return err
 		}
+		err = c.leaveHandlers(0)
+		if err != nil {
+			return err
+		}
 		c.emit(code.OpReturnValue)
 	case *ast.CallExpression:
-		err := c.Compile(node.Function)
+		err := c.compileChainLeft(node.Function, false)
 		if err != nil {
 			return err
 		}
-		for _, arg := range node.Arguments {
-			err := c.Compile(arg)
-			if err != nil {
-				return err
-			}
+		return c.compileCall(node.Arguments)
+	case *ast.MethodCallExpression:
+		err := c.compileChainLeft(node.Receiver, node.Optional)
+		if err != nil {
+			return err
 		}
-		c.emit(code.OpCall, len(node.Arguments))
+		c.emit(code.OpGetMethod, c.addConstant(&object.String{Value: node.Method.Value}))
+		return c.compileCall(node.Arguments)
 	case *ast.FunctionLiteral:
 		c.enterScope()
-		if node.Name != "" {
+		if node.Name != "" && !assignsTo(node.Body, node.Name) {
 			c.symbolTable.DefineFunctionName(node.Name)
 		}
-		for _, p := range node.Parameters {
-			c.symbolTable.Define(p.Value)
+		params := make([]Symbol, len(node.Parameters))
+		for i, p := range node.Parameters {
+			params[i] = c.symbolTable.Define(p.Value)
+		}
+		if node.Rest != nil {
+			c.symbolTable.Define(node.Rest.Value)
+		}
+		numDefaults := 0
+		for i := range node.Parameters {
+			if node.Defaults != nil && node.Defaults[i] != nil {
+				numDefaults++
+				err := c.compileDefault(node.Defaults[i], i, params[i])
+				if err != nil {
+					return err
+				}
+			}
+			if node.Patterns != nil && node.Patterns[i] != nil {
+				err := c.compileDestructuring(node.Patterns[i], params[i])
+				if err != nil {
+					return err
+				}
+			}
 		}
 		err := c.Compile(node.Body)
 		if err != nil {
 			return err
 		}
-		if c.lastInstructionIs(code.OpPop) {
+		if endsWithExpression(node.Body) && c.lastInstructionIs(code.OpPop) {
 			c.replaceLastPopWithReturn()
 		}
 		if !c.lastInstructionIs(code.OpReturnValue) {
 			c.emit(code.OpReturn)
 		}
 		freeSymbols := c.symbolTable.FreeSymbols
-		numLocals := c.symbolTable.numDefinitions
+		numLocals := c.symbolTable.numLocals()
+		sourceMap := c.scopes[c.scopeIndex].sourceMap
 		instructions := c.leaveScope()
 		for _, s := range freeSymbols {
-			c.loadSymbol(s)
+			c.captureSymbol(s)
+		}
+		compiledFn := &object.CompiledFunction{
+			Instructions:  instructions,
+			SourceMap:     sourceMap,
+			NumLocals:     numLocals,
+			NumParameters: len(node.Parameters),
+			NumDefaults:   numDefaults,
+			Variadic:      node.Rest != nil,
 		}
-		compiledFn := &object.CompiledFunction{Instructions: instructions, NumLocals: numLocals, NumParameters: len(node.Parameters)}
 		fnIdex := c.addConstant(compiledFn)
 		c.emit(code.OpClosure, fnIdex, len(freeSymbols))
 	case *ast.PrefixExpression:
@@ -124,10 +233,21 @@ func (c *Compiler) Compile(node ast.Node) error {
 			c.emit(code.OpBang)
 		case "-":
 			c.emit(code.OpMinus)
+		case "~":
+			c.emit(code.OpBitNot)
 		default:
-			return fmt.Errorf("unknown operator %s", node.Operator)
+			return c.errorf("unknown operator %s", node.Operator)
 		}
+	case *ast.SpreadExpression:
+		err := c.Compile(node.Value)
+		if err != nil {
+			return err
+		}
+		c.emit(code.OpSpread)
 	case *ast.ArrayLiteral:
+		if hasSpread(node.Elements) {
+			return c.compileSpreadList(node.Elements)
+		}
 		for _, el := range node.Elements {
 			err := c.Compile(el)
 			if err != nil {
@@ -155,7 +275,7 @@ func (c *Compiler) Compile(node ast.Node) error {
 		}
 		c.emit(code.OpHash, len(node.Pairs)*2)
 	case *ast.IndexExpression:
-		err := c.Compile(node.Left)
+		err := c.compileChainLeft(node.Left, node.Optional)
 		if err != nil {
 			return err
 		}
@@ -164,15 +284,41 @@ func (c *Compiler) Compile(node ast.Node) error {
 			return err
 		}
 		c.emit(code.OpIndex)
+	case *ast.SliceExpression:
+		err := c.compileChainLeft(node.Left, node.Optional)
+		if err != nil {
+			return err
+		}
+		for _, bound := range []ast.Expression{node.Start, node.End} {
+			if bound == nil {
+				c.emit(code.OpNull)
+				continue
+			}
+			err := c.Compile(bound)
+			if err != nil {
+				return err
+			}
+		}
+		c.emit(code.OpSlice)
 	case *ast.StringLiteral:
 		str := &object.String{Value: node.Value}
 		c.emit(code.OpConstant, c.addConstant(str))
+	case *ast.InterpolatedString:
+		for _, part := range node.Parts {
+			err := c.Compile(part)
+			if err != nil {
+				return err
+			}
+		}
+		c.emit(code.OpConcat, len(node.Parts))
 	case *ast.Boolean:
 		if node.Value {
 			c.emit(code.OpTrue)
 		} else {
 			c.emit(code.OpFalse)
 		}
+	case *ast.NullLiteral:
+		c.emit(code.OpNull)
 	case *ast.ExpressionStatement:
 		err := c.Compile(node.Expression)
 		if err != nil {
@@ -180,16 +326,17 @@ func (c *Compiler) Compile(node ast.Node) error {
 		}
 		c.emit(code.OpPop)
 	case *ast.InfixExpression:
-		if node.Operator == "<" {
-			err := c.Compile(node.Right)
+		if op, ok := shortCircuitOperators[node.Operator]; ok {
+			err := c.Compile(node.Left)
 			if err != nil {
 				return err
 			}
-			err = c.Compile(node.Left)
+			jumpPos := c.emit(op, 9999)
+			err = c.Compile(node.Right)
 			if err != nil {
 				return err
 			}
-			c.emit(code.OpGreaterThan)
+			c.changeOperand(jumpPos, len(c.currentInstructions()))
 			return nil
 		}
 		err := c.Compile(node.Left)
@@ -200,24 +347,11 @@ func (c *Compiler) Compile(node ast.Node) error {
 		if err != nil {
 			return err
 		}
-		switch node.Operator {
-		case "+":
-			c.emit(code.OpAdd)
-		case "-":
-			c.emit(code.OpSub)
-		case "*":
-			c.emit(code.OpMul)
-		case "/":
-			c.emit(code.OpDiv)
-		case ">":
-			c.emit(code.OpGreaterThan)
-		case "==":
-			c.emit(code.OpEqual)
-		case "!=":
-			c.emit(code.OpNotEqual)
-		default:
-			return fmt.Errorf("unknown operator %s", node.Operator)
+		op, ok := infixOperators[node.Operator]
+		if !ok {
+			return c.errorf("unknown operator %s", node.Operator)
 		}
+		c.emit(op)
 	case *ast.IfExpression:
 		err := c.Compile(node.Condition)
 		if err != nil {
@@ -228,9 +362,7 @@ func (c *Compiler) Compile(node ast.Node) error {
 		if err != nil {
 			return err
 		}
-		if c.lastInstructionIs(code.OpPop) {
-			c.removeLastPop()
-		}
+		c.keepLastValue(node.Consequence)
 		jumpPos := c.emit(code.OpJump, 9999)
 		afterConsequencePos := len(c.currentInstructions())
 		c.changeOperand(jumpNotTruthyPos, afterConsequencePos)
@@ -242,13 +374,138 @@ func (c *Compiler) Compile(node ast.Node) error {
 			if err != nil {
 				return err
 			}
-			if c.lastInstructionIs(code.OpPop) {
-				c.removeLastPop()
-			}
+			c.keepLastValue(node.Alternative)
 		}
 		afterAlternativePos := len(c.currentInstructions())
 		c.changeOperand(jumpPos, afterAlternativePos)
+	case *ast.WhileStatement:
+		conditionPos := len(c.currentInstructions())
+		err := c.Compile(node.Condition)
+		if err != nil {
+			return err
+		}
+		jumpNotTruthyPos := c.emit(code.OpJumpNotTruthy, 9999)
+
+		l, err := c.compileLoopBody(node.Body)
+		if err != nil {
+			return err
+		}
+		c.patchJumps(l.continues, conditionPos)
+		c.emit(code.OpJump, conditionPos)
+
+		afterLoopPos := len(c.currentInstructions())
+		c.changeOperand(jumpNotTruthyPos, afterLoopPos)
+		c.patchJumps(l.breaks, afterLoopPos)
+	case *ast.ForStatement:
+		c.enterBlock()
+		defer c.leaveBlock()
+		if node.Init != nil {
+			err := c.Compile(node.Init)
+			if err != nil {
+				return err
+			}
+		}
+
+		conditionPos := len(c.currentInstructions())
+		jumpNotTruthyPos := -1
+		if node.Condition != nil {
+			err := c.Compile(node.Condition)
+			if err != nil {
+				return err
+			}
+			jumpNotTruthyPos = c.emit(code.OpJumpNotTruthy, 9999)
+		}
+
+		l, err := c.compileLoopBody(node.Body)
+		if err != nil {
+			return err
+		}
+		c.patchJumps(l.continues, len(c.currentInstructions()))
+		if node.Step != nil {
+			err := c.Compile(node.Step)
+			if err != nil {
+				return err
+			}
+			c.emit(code.OpPop)
+		}
+		c.emit(code.OpJump, conditionPos)
+
+		afterLoopPos := len(c.currentInstructions())
+		if jumpNotTruthyPos >= 0 {
+			c.changeOperand(jumpNotTruthyPos, afterLoopPos)
+		}
+		c.patchJumps(l.breaks, afterLoopPos)
+	case *ast.ForInStatement:
+		err := c.Compile(node.Iterable)
+		if err != nil {
+			return err
+		}
+		c.emit(code.OpGetIterator)
+
+		c.enterBlock()
+		defer c.leaveBlock()
+		nextPos := c.emit(code.OpIterNext, 9999)
+		value, err := c.define(node.Value.Value)
+		if err != nil {
+			return err
+		}
+		c.setSymbol(value)
+		if node.Key != nil {
+			key, err := c.define(node.Key.Value)
+			if err != nil {
+				return err
+			}
+			c.setSymbol(key)
+		} else {
+			c.emit(code.OpPop)
+		}
+
+		l, err := c.compileLoopBody(node.Body)
+		if err != nil {
+			return err
+		}
+		c.patchJumps(l.continues, nextPos)
+		c.emit(code.OpJump, nextPos)
+
+		afterLoopPos := len(c.currentInstructions())
+		c.changeOperand(nextPos, afterLoopPos)
+		c.patchJumps(l.breaks, afterLoopPos)
+		c.emit(code.OpPop)
+	case *ast.MatchExpression:
+		return c.compileMatchExpression(node)
+	case *ast.TryExpression:
+		return c.compileTryExpression(node)
+	case *ast.ImportStatement:
+		return c.compileImportStatement(node)
+	case *ast.ThrowStatement:
+		err := c.Compile(node.Value)
+		if err != nil {
+			return err
+		}
+		c.emit(code.OpThrow)
+	case *ast.BreakStatement:
+		l := c.currentLoop()
+		if l == nil {
+			return c.errorf("break outside of a loop")
+		}
+		err := c.leaveHandlers(l.handlers)
+		if err != nil {
+			return err
+		}
+		l.breaks = append(l.breaks, c.emit(code.OpJump, 9999))
+	case *ast.ContinueStatement:
+		l := c.currentLoop()
+		if l == nil {
+			return c.errorf("continue outside of a loop")
+		}
+		err := c.leaveHandlers(l.handlers)
+		if err != nil {
+			return err
+		}
+		l.continues = append(l.continues, c.emit(code.OpJump, 9999))
 	case *ast.BlockStatement:
+		c.enterBlock()
+		defer c.leaveBlock()
 		for _, s := range node.Statements {
 			err := c.Compile(s)
 			if err != nil {
@@ -258,31 +515,258 @@ func (c *Compiler) Compile(node ast.Node) error {
 	case *ast.Identifier:
 		symbol, ok := c.symbolTable.Resolve(node.Value)
 		if !ok {
-			return fmt.Errorf("undefined variable %s", node.Value)
+			return c.errorf("undefined variable %s", node.Value)
+		}
+		c.loadSymbol(symbol)
+	case *ast.AssignExpression:
+		if index, ok := node.Target.(*ast.IndexExpression); ok {
+			return c.compileIndexAssignment(node, index)
+		}
+		ident, ok := node.Target.(*ast.Identifier)
+		if !ok {
+			return c.errorf("cannot assign to %s", node.Target.String())
+		}
+		symbol, ok := c.symbolTable.Resolve(ident.Value)
+		if !ok {
+			return c.errorf("undefined variable %s", ident.Value)
+		}
+		if c.symbolTable.origin(symbol).Const {
+			return c.errorf("cannot assign to constant %s", ident.Value)
+		}
+		switch c.symbolTable.origin(symbol).Scope {
+		case BuiltinScope:
+			return c.errorf("cannot assign to builtin %s", ident.Value)
+		case FunctionScope:
+			return c.errorf("cannot assign to %s inside its own body", ident.Value)
+		}
+		if node.Operator != "" {
+			c.loadSymbol(symbol)
+		}
+		err := c.Compile(node.Value)
+		if err != nil {
+			return err
+		}
+		if node.Operator != "" {
+			op, ok := infixOperators[node.Operator]
+			if !ok {
+				return c.errorf("unknown operator %s", node.Operator)
+			}
+			c.emit(op)
 		}
+		c.assignSymbol(symbol)
 		c.loadSymbol(symbol)
 	case *ast.LetStatement:
-		symbol := c.symbolTable.Define(node.Name.Value)
+		if node.Pattern != nil {
+			err := c.Compile(node.Value)
+			if err != nil {
+				return err
+			}
+			value := c.allocTemp()
+			defer c.freeTemp()
+			c.setSymbol(value)
+			err = c.compileDestructuring(node.Pattern, value)
+			if err != nil || !node.IsConst() {
+				return err
+			}
+			for _, name := range ast.PatternNames(node.Pattern) {
+				c.symbolTable.markConst(name)
+			}
+			return nil
+		}
+		if fn, ok := node.Value.(*ast.FunctionLiteral); ok && assignsTo(fn.Body, node.Name.Value) {
+			return c.compileSelfAssigningLet(node, fn)
+		}
+		// The value is compiled first, so that it sees an outer variable
+		// the statement shadows.
 		err := c.Compile(node.Value)
 		if err != nil {
 			return err
 		}
-		if symbol.Scope == GlobalScope {
-			c.emit(code.OpSetGlobal, symbol.Index)
+		var symbol Symbol
+		if node.IsConst() {
+			symbol, err = c.defineConst(node.Name.Value, literalValue(node.Value))
 		} else {
-			c.emit(code.OpSetLocal, symbol.Index)
+			symbol, err = c.define(node.Name.Value)
+		}
+		if err != nil {
+			return err
+		}
+		c.setSymbol(symbol)
+	case *ast.StructStatement:
+		structType := object.NewStructType(node.Name.Value, node.FieldNames())
+		c.emit(code.OpConstant, c.addConstant(structType))
+		symbol, err := c.defineConst(node.Name.Value, nil)
+		if err != nil {
+			return err
 		}
+		c.setSymbol(symbol)
 	case *ast.IntegerLiteral:
 		integer := &object.Integer{Value: node.Value}
 
 		c.emit(code.OpConstant, c.addConstant(integer))
+	case *ast.FloatLiteral:
+		float := &object.Float{Value: node.Value}
+		c.emit(code.OpConstant, c.addConstant(float))
 	}
 
 	return nil
 
 }
 
+// compileChainLeft compiles the left side of an access or call as part of
+// the same chain. After an optional access, a null left side skips the
+// rest of the chain, as in a?.b.c(), whose value is then null.
+func (c *Compiler) compileChainLeft(left ast.Expression, optional bool) error {
+	c.chained = true
+	err := c.Compile(left)
+	if err != nil {
+		return err
+	}
+	if optional {
+		c.nullJumps = append(c.nullJumps, c.emit(code.OpJumpNull, 9999))
+	}
+	return nil
+}
+
+// errorf returns a compile error prefixed with the position of the node
+// currently being compiled.
+func (c *Compiler) errorf(format string, a ...interface{}) error {
+	msg := fmt.Sprintf(format, a...)
+	if c.pos.IsValid() {
+		msg = c.pos.String() + ": " + msg
+	}
+	return errors.New(msg)
+}
+
+// define defines name for a new variable in the current scope, which fails
+// if the scope already has a constant of that name.
+func (c *Compiler) define(name string) (Symbol, error) {
+	if c.symbolTable.IsConst(name) {
+		return Symbol{}, c.errorf("cannot redeclare constant %s", name)
+	}
+	return c.symbolTable.Define(name), nil
+}
+
+// defineConst is define for a constant, whose value is given if it can be
+// inlined.
+func (c *Compiler) defineConst(name string, value object.Object) (Symbol, error) {
+	if c.symbolTable.IsConst(name) {
+		return Symbol{}, c.errorf("cannot redeclare constant %s", name)
+	}
+	constant := -1
+	if _, ok := value.(*object.Boolean); value != nil && !ok {
+		constant = c.addConstant(value)
+	}
+	return c.symbolTable.DefineConst(name, value, constant), nil
+}
+
+// compileSelfAssigningLet compiles a let statement binding a function that
+// assigns to the variable it is bound to. The variable is defined before
+// the function, which captures it like any other variable instead of
+// referring to itself, so the assignment is seen outside the function.
+func (c *Compiler) compileSelfAssigningLet(node *ast.LetStatement, fn *ast.FunctionLiteral) error {
+	var symbol Symbol
+	var err error
+	if node.IsConst() {
+		symbol, err = c.defineConst(node.Name.Value, nil)
+	} else {
+		symbol, err = c.define(node.Name.Value)
+	}
+	if err != nil {
+		return err
+	}
+	if symbol.Scope == LocalScope {
+		// A fresh binding for the function to capture.
+		c.emit(code.OpNull)
+		c.setSymbol(symbol)
+	}
+	err = c.Compile(fn)
+	if err != nil {
+		return err
+	}
+	c.assignSymbol(symbol)
+	return nil
+}
+
+// assignsTo reports whether node contains an assignment to the variable
+// name, including inside nested functions.
+func assignsTo(node ast.Node, name string) bool {
+	found := false
+	ast.Modify(node, func(n ast.Node) ast.Node {
+		switch n := n.(type) {
+		case *ast.AssignExpression:
+			if ident, ok := n.Target.(*ast.Identifier); ok && ident.Value == name {
+				found = true
+			}
+		case *ast.CallExpression:
+			// Modify does not walk into calls.
+			if assignsTo(n.Function, name) {
+				found = true
+			}
+			for _, arg := range n.Arguments {
+				if assignsTo(arg, name) {
+					found = true
+				}
+			}
+		}
+		return n
+	})
+	return found
+}
+
+// literalValue returns the value of a literal that a constant can be
+// inlined as, or nil if expr is not such a literal.
+func literalValue(expr ast.Expression) object.Object {
+	switch expr := expr.(type) {
+	case *ast.IntegerLiteral:
+		return &object.Integer{Value: expr.Value}
+	case *ast.FloatLiteral:
+		return &object.Float{Value: expr.Value}
+	case *ast.StringLiteral:
+		return &object.String{Value: expr.Value}
+	case *ast.Boolean:
+		return &object.Boolean{Value: expr.Value}
+	case *ast.PrefixExpression:
+		if expr.Operator != "-" {
+			return nil
+		}
+		switch value := literalValue(expr.Right).(type) {
+		case *object.Integer:
+			return &object.Integer{Value: -value.Value}
+		case *object.Float:
+			return &object.Float{Value: -value.Value}
+		}
+	}
+	return nil
+}
+
+// loadValue pushes the inlined value of a constant.
+func (c *Compiler) loadValue(symbol Symbol) {
+	if b, ok := symbol.Value.(*object.Boolean); ok {
+		if b.Value {
+			c.emit(code.OpTrue)
+		} else {
+			c.emit(code.OpFalse)
+		}
+		return
+	}
+	c.emit(code.OpConstant, symbol.Constant)
+}
+
+// setSymbol binds a newly defined symbol to the value on top of the stack.
+func (c *Compiler) setSymbol(symbol Symbol) {
+	if symbol.Scope == GlobalScope {
+		c.emit(code.OpSetGlobal, symbol.Index)
+	} else {
+		c.emit(code.OpSetLocal, symbol.Index)
+	}
+}
+
 func (c *Compiler) loadSymbol(symbol Symbol) {
+	if symbol.Value != nil {
+		c.loadValue(symbol)
+		return
+	}
 	switch symbol.Scope {
 	case GlobalScope:
 		c.emit(code.OpGetGlobal, symbol.Index)
@@ -297,6 +781,32 @@ func (c *Compiler) loadSymbol(symbol Symbol) {
 	}
 }
 
+// assignSymbol stores the value on top of the stack into an existing
+// variable, writing through its cell if a closure has captured it.
+func (c *Compiler) assignSymbol(symbol Symbol) {
+	switch symbol.Scope {
+	case GlobalScope:
+		c.emit(code.OpSetGlobal, symbol.Index)
+	case LocalScope:
+		c.emit(code.OpAssignLocal, symbol.Index)
+	case FreeScope:
+		c.emit(code.OpAssignFree, symbol.Index)
+	}
+}
+
+// captureSymbol pushes a free variable of a closure being created. Locals
+// and free variables are captured by reference through their cells.
+func (c *Compiler) captureSymbol(symbol Symbol) {
+	switch symbol.Scope {
+	case LocalScope:
+		c.emit(code.OpCaptureLocal, symbol.Index)
+	case FreeScope:
+		c.emit(code.OpCaptureFree, symbol.Index)
+	default:
+		c.loadSymbol(symbol)
+	}
+}
+
 func (c *Compiler) replaceLastPopWithReturn() {
 	c.replaceInstruction(c.scopes[c.scopeIndex].lastInstruction.Position, code.Make(code.OpReturnValue))
 	c.scopes[c.scopeIndex].lastInstruction.Opcode = code.OpReturnValue
@@ -324,6 +834,176 @@ func (c *Compiler) changeOperand(opPos int, operand int) {
 	c.replaceInstruction(opPos, newInstruction)
 }
 
+// compileLoopBody compiles the body of a loop and returns the break and
+// continue jumps in it, which the caller patches.
+func (c *Compiler) compileLoopBody(body *ast.BlockStatement) (*loop, error) {
+	scope := &c.scopes[c.scopeIndex]
+	l := &loop{handlers: len(scope.handlers)}
+	scope.loops = append(scope.loops, l)
+	err := c.Compile(body)
+	scope = &c.scopes[c.scopeIndex]
+	scope.loops = scope.loops[:len(scope.loops)-1]
+	return l, err
+}
+
+func (c *Compiler) currentLoop() *loop {
+	loops := c.scopes[c.scopeIndex].loops
+	if len(loops) == 0 {
+		return nil
+	}
+	return loops[len(loops)-1]
+}
+
+func (c *Compiler) patchJumps(positions []int, target int) {
+	for _, pos := range positions {
+		c.changeOperand(pos, target)
+	}
+}
+
+// compileCall calls the function on top of the stack with args.
+func (c *Compiler) compileCall(args []ast.Expression) error {
+	if hasSpread(args) {
+		err := c.compileSpreadList(args)
+		if err != nil {
+			return err
+		}
+		c.emit(code.OpCallSpread)
+		return nil
+	}
+	for _, arg := range args {
+		err := c.Compile(arg)
+		if err != nil {
+			return err
+		}
+	}
+	c.emit(code.OpCall, len(args))
+	return nil
+}
+
+// compileIndexAssignment evaluates the collection and index of the target
+// once, reading the current element through copies of them for a compound
+// assignment.
+func (c *Compiler) compileIndexAssignment(node *ast.AssignExpression, target *ast.IndexExpression) error {
+	err := c.Compile(target.Left)
+	if err != nil {
+		return err
+	}
+	err = c.Compile(target.Index)
+	if err != nil {
+		return err
+	}
+	if node.Operator != "" {
+		c.emit(code.OpDup2)
+		c.emit(code.OpIndex)
+	}
+	err = c.Compile(node.Value)
+	if err != nil {
+		return err
+	}
+	if node.Operator != "" {
+		op, ok := infixOperators[node.Operator]
+		if !ok {
+			return c.errorf("unknown operator %s", node.Operator)
+		}
+		c.emit(op)
+	}
+	c.emit(code.OpSetIndex)
+	return nil
+}
+
+// compileDefault stores the value of a parameter's default in its local
+// when the call passed no argument for it.
+func (c *Compiler) compileDefault(def ast.Expression, index int, param Symbol) error {
+	c.emit(code.OpArgMissing, index)
+	jumpPos := c.emit(code.OpJumpNotTruthy, 9999)
+	err := c.Compile(def)
+	if err != nil {
+		return err
+	}
+	c.setSymbol(param)
+	c.changeOperand(jumpPos, len(c.currentInstructions()))
+	return nil
+}
+
+func hasSpread(elements []ast.Expression) bool {
+	for _, el := range elements {
+		if _, ok := el.(*ast.SpreadExpression); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// compileSpreadList builds an array of elements, some of which are spread,
+// by extending an array of the leading elements with each spread value and
+// each run of ordinary elements in turn.
+func (c *Compiler) compileSpreadList(elements []ast.Expression) error {
+	isSpread := func(i int) bool {
+		_, ok := elements[i].(*ast.SpreadExpression)
+		return ok
+	}
+
+	i := 0
+	for ; i < len(elements) && !isSpread(i); i++ {
+		err := c.Compile(elements[i])
+		if err != nil {
+			return err
+		}
+	}
+	c.emit(code.OpArray, i)
+
+	for i < len(elements) {
+		if isSpread(i) {
+			err := c.Compile(elements[i])
+			if err != nil {
+				return err
+			}
+			i++
+			continue
+		}
+		start := i
+		for ; i < len(elements) && !isSpread(i); i++ {
+			err := c.Compile(elements[i])
+			if err != nil {
+				return err
+			}
+		}
+		c.emit(code.OpArray, i-start)
+		c.emit(code.OpSpread)
+	}
+	return nil
+}
+
+// keepLastValue leaves the value of a compiled block on the stack: the
+// value of its trailing expression statement, or null if it has none.
+func (c *Compiler) keepLastValue(block *ast.BlockStatement) {
+	if endsWithExpression(block) && c.lastInstructionIs(code.OpPop) {
+		c.removeLastPop()
+	} else {
+		c.emit(code.OpNull)
+	}
+}
+
+func isLoop(stmt ast.Statement) bool {
+	switch stmt.(type) {
+	case *ast.WhileStatement, *ast.ForStatement, *ast.ForInStatement:
+		return true
+	}
+	return false
+}
+
+// endsWithExpression reports whether the last statement of block is an
+// expression statement, whose value is popped by the block's last
+// instruction. Loops can end in an OpPop of their own.
+func endsWithExpression(block *ast.BlockStatement) bool {
+	n := len(block.Statements)
+	if n == 0 {
+		return false
+	}
+	_, ok := block.Statements[n-1].(*ast.ExpressionStatement)
+	return ok
+}
+
 func (c *Compiler) lastInstructionIs(op code.Opcode) bool {
 	if len(c.currentInstructions()) == 0 {
 		return false
@@ -339,6 +1019,7 @@ func (c *Compiler) removeLastPop() {
 	new := old[:last.Position]
 
 	c.scopes[c.scopeIndex].instructions = new
+	c.scopes[c.scopeIndex].sourceMap = c.scopes[c.scopeIndex].sourceMap.Truncate(last.Position)
 	c.scopes[c.scopeIndex].lastInstruction = previous
 
 }
@@ -356,6 +1037,9 @@ func (c *Compiler) addInstruction(ins []byte) int {
 	posNewInstruction := len(c.currentInstructions())
 	updatedInstructions := append(c.currentInstructions(), ins...)
 	c.scopes[c.scopeIndex].instructions = updatedInstructions
+	if c.pos.IsValid() {
+		c.scopes[c.scopeIndex].sourceMap = c.scopes[c.scopeIndex].sourceMap.Add(posNewInstruction, c.pos)
+	}
 	return posNewInstruction
 }
 
@@ -367,13 +1051,17 @@ func (c *Compiler) addConstant(obj object.Object) int {
 func (c *Compiler) Bytecode() *Bytecode {
 	return &Bytecode{
 		Instructions: c.currentInstructions(),
+		SourceMap:    c.scopes[c.scopeIndex].sourceMap,
 		Constants:    c.constants,
+		NumLocals:    c.symbolTable.numLocals(),
 	}
 }
 
 type Bytecode struct {
 	Instructions code.Instructions
+	SourceMap    code.SourceMap
 	Constants    []object.Object
+	NumLocals    int // slots for the variables of top-level blocks
 }
 
 func (c *Compiler) enterScope() {
@@ -394,3 +1082,14 @@ func (c *Compiler) leaveScope() code.Instructions {
 	return instructions
 
 }
+
+// enterBlock opens the scope of a block, whose variables are locals that
+// go out of scope, and give up their slots, when leaveBlock closes it.
+func (c *Compiler) enterBlock() {
+	c.symbolTable = NewBlockSymbolTable(c.symbolTable)
+}
+
+func (c *Compiler) leaveBlock() {
+	c.symbolTable.release()
+	c.symbolTable = c.symbolTable.Outer
+}
@@ -82,6 +82,23 @@ func TestIntegerArithmetic(t *testing.T) {
 	runCompilerTests(t, tests)
 }
 
+func TestFloatLiterals(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			input:             "1.5 * 2",
+			expectedConstants: []interface{}{1.5, 2},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpMul),
+				code.Make(code.OpPop),
+			},
+		},
+	}
+
+	runCompilerTests(t, tests)
+}
+
 func TestGlobalLetStatements(t *testing.T) {
 	tests := []compilerTestCase{
 		{input: "let one=1;let two=2;", expectedConstants: []interface{}{1, 2}, expectedInstructions: []code.Instructions{
@@ -129,6 +146,18 @@ func TestStringExpressions(t *testing.T) {
 				code.Make(code.OpPop),
 			},
 		},
+		{
+			input:             `"a${1}b${true}"`,
+			expectedConstants: []interface{}{"a", 1, "b"},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpConstant, 2),
+				code.Make(code.OpTrue),
+				code.Make(code.OpConcat, 4),
+				code.Make(code.OpPop),
+			},
+		},
 	}
 	runCompilerTests(t, tests)
 
@@ -164,11 +193,11 @@ func TestBooleanExpressions(t *testing.T) {
 		},
 		{
 			input:             "1 < 2",
-			expectedConstants: []interface{}{2, 1},
+			expectedConstants: []interface{}{1, 2},
 			expectedInstructions: []code.Instructions{
 				code.Make(code.OpConstant, 0),
 				code.Make(code.OpConstant, 1),
-				code.Make(code.OpGreaterThan),
+				code.Make(code.OpLessThan),
 				code.Make(code.OpPop),
 			},
 		},
@@ -349,6 +378,89 @@ if (true) { 10 };3333;
 	runCompilerTests(t, tests)
 }
 
+func TestOperatorOpcodes(t *testing.T) {
+	operators := map[string]code.Opcode{
+		"<":  code.OpLessThan,
+		"<=": code.OpLessEqual,
+		">=": code.OpGreaterEqual,
+		"%":  code.OpMod,
+		"**": code.OpPow,
+		"&":  code.OpBitAnd,
+		"|":  code.OpBitOr,
+		"^":  code.OpBitXor,
+		"<<": code.OpShiftLeft,
+		">>": code.OpShiftRight,
+	}
+
+	tests := []compilerTestCase{
+		{
+			input:             "~1",
+			expectedConstants: []interface{}{1},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpBitNot),
+				code.Make(code.OpPop),
+			},
+		},
+	}
+	for operator, op := range operators {
+		tests = append(tests, compilerTestCase{
+			input:             "1 " + operator + " 2",
+			expectedConstants: []interface{}{1, 2},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpConstant, 1),
+				code.Make(op),
+				code.Make(code.OpPop),
+			},
+		})
+	}
+
+	runCompilerTests(t, tests)
+}
+
+func TestLogicalOperators(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			input:             "true && false; 1",
+			expectedConstants: []interface{}{1},
+			expectedInstructions: []code.Instructions{
+				// 0000
+				code.Make(code.OpTrue),
+				// 0001
+				code.Make(code.OpJumpNotTruthyOrPop, 5),
+				// 0004
+				code.Make(code.OpFalse),
+				// 0005
+				code.Make(code.OpPop),
+				// 0006
+				code.Make(code.OpConstant, 0),
+				// 0009
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input:             "1 || 2 || 3",
+			expectedConstants: []interface{}{1, 2, 3},
+			expectedInstructions: []code.Instructions{
+				// 0000
+				code.Make(code.OpConstant, 0),
+				// 0003
+				code.Make(code.OpJumpTruthyOrPop, 9),
+				// 0006
+				code.Make(code.OpConstant, 1),
+				// 0009
+				code.Make(code.OpJumpTruthyOrPop, 15),
+				// 0012
+				code.Make(code.OpConstant, 2),
+				// 0015
+				code.Make(code.OpPop),
+			},
+		},
+	}
+	runCompilerTests(t, tests)
+}
+
 func TestIndexExpressions(t *testing.T) {
 	tests := []compilerTestCase{
 		{
@@ -380,6 +492,19 @@ func TestIndexExpressions(t *testing.T) {
 				code.Make(code.OpPop),
 			},
 		},
+		{
+			input:             "[1,2][1:]",
+			expectedConstants: []interface{}{1, 2, 1},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpArray, 2),
+				code.Make(code.OpConstant, 2),
+				code.Make(code.OpNull),
+				code.Make(code.OpSlice),
+				code.Make(code.OpPop),
+			},
+		},
 	}
 	runCompilerTests(t, tests)
 }
@@ -414,6 +539,11 @@ func testConstants(t *testing.T, expected []interface{}, actual []object.Object)
 			if err != nil {
 				return fmt.Errorf("constant %d - testIntegerObject failed. %s", i, err)
 			}
+		case float64:
+			f, ok := actual[i].(*object.Float)
+			if !ok || f.Value != constant {
+				return fmt.Errorf("constant %d - wrong float. got=%T (%+v), want=%g", i, actual[i], actual[i], constant)
+			}
 		case string:
 			err := testStringObject(constant, actual[i])
 			if err != nil {
@@ -579,3 +709,796 @@ func TestCompilerScopes(t *testing.T) {
 		t.Errorf("previous instruction op code wrong. got=%d, want=%d", previous.Opcode, code.OpMul)
 	}
 }
+
+func TestAssignments(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			input:             "let a = [1]; a[0] += 2;",
+			expectedConstants: []interface{}{1, 0, 2},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpArray, 1),
+				code.Make(code.OpSetGlobal, 0),
+				code.Make(code.OpGetGlobal, 0),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpDup2),
+				code.Make(code.OpIndex),
+				code.Make(code.OpConstant, 2),
+				code.Make(code.OpAdd),
+				code.Make(code.OpSetIndex),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input:             "let x = 1; x += 2;",
+			expectedConstants: []interface{}{1, 2},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpSetGlobal, 0),
+				code.Make(code.OpGetGlobal, 0),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpAdd),
+				code.Make(code.OpSetGlobal, 0),
+				code.Make(code.OpGetGlobal, 0),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input: "fn() { let x = 1; x = 2; fn() { x -= 1 } }",
+			expectedConstants: []interface{}{
+				1,
+				2,
+				1,
+				[]code.Instructions{
+					code.Make(code.OpGetFree, 0),
+					code.Make(code.OpConstant, 2),
+					code.Make(code.OpSub),
+					code.Make(code.OpAssignFree, 0),
+					code.Make(code.OpGetFree, 0),
+					code.Make(code.OpReturnValue),
+				},
+				[]code.Instructions{
+					code.Make(code.OpConstant, 0),
+					code.Make(code.OpSetLocal, 0),
+					code.Make(code.OpConstant, 1),
+					code.Make(code.OpAssignLocal, 0),
+					code.Make(code.OpGetLocal, 0),
+					code.Make(code.OpPop),
+					code.Make(code.OpCaptureLocal, 0),
+					code.Make(code.OpClosure, 3, 1),
+					code.Make(code.OpReturnValue),
+				},
+			},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpClosure, 4, 0),
+				code.Make(code.OpPop),
+			},
+		},
+	}
+
+	runCompilerTests(t, tests)
+}
+
+func TestLoops(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			input:             "while (false) { }; 1",
+			expectedConstants: []interface{}{1},
+			expectedInstructions: []code.Instructions{
+				// 0000
+				code.Make(code.OpFalse),
+				// 0001
+				code.Make(code.OpJumpNotTruthy, 7),
+				// 0004
+				code.Make(code.OpJump, 0),
+				// 0007
+				code.Make(code.OpConstant, 0),
+				// 0010
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input:             "while (true) { continue; break; }",
+			expectedConstants: []interface{}{},
+			expectedInstructions: []code.Instructions{
+				// 0000
+				code.Make(code.OpTrue),
+				// 0001
+				code.Make(code.OpJumpNotTruthy, 13),
+				// 0004
+				code.Make(code.OpJump, 0),
+				// 0007
+				code.Make(code.OpJump, 13),
+				// 0010
+				code.Make(code.OpJump, 0),
+				// 0013
+				code.Make(code.OpNull),
+				// 0014
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input:             "for (let i = 0; i < 3; i += 1) { continue; }",
+			expectedConstants: []interface{}{0, 3, 1},
+			expectedInstructions: []code.Instructions{
+				// 0000
+				code.Make(code.OpConstant, 0),
+				// 0003
+				code.Make(code.OpSetLocal, 0),
+				// 0005
+				code.Make(code.OpGetLocal, 0),
+				// 0007
+				code.Make(code.OpConstant, 1),
+				// 0010
+				code.Make(code.OpLessThan),
+				// 0011
+				code.Make(code.OpJumpNotTruthy, 31),
+				// 0014
+				code.Make(code.OpJump, 17),
+				// 0017
+				code.Make(code.OpGetLocal, 0),
+				// 0019
+				code.Make(code.OpConstant, 2),
+				// 0022
+				code.Make(code.OpAdd),
+				// 0023
+				code.Make(code.OpAssignLocal, 0),
+				// 0025
+				code.Make(code.OpGetLocal, 0),
+				// 0027
+				code.Make(code.OpPop),
+				// 0028
+				code.Make(code.OpJump, 5),
+				// 0031
+				code.Make(code.OpNull),
+				// 0032
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input:             "for (;;) { if (true) { break; } }",
+			expectedConstants: []interface{}{},
+			expectedInstructions: []code.Instructions{
+				// 0000
+				code.Make(code.OpTrue),
+				// 0001
+				code.Make(code.OpJumpNotTruthy, 11),
+				// 0004
+				code.Make(code.OpJump, 16),
+				// 0007
+				code.Make(code.OpNull),
+				// 0008
+				code.Make(code.OpJump, 12),
+				// 0011
+				code.Make(code.OpNull),
+				// 0012
+				code.Make(code.OpPop),
+				// 0013
+				code.Make(code.OpJump, 0),
+				// 0016
+				code.Make(code.OpNull),
+				// 0017
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input:             "for (x in [1]) { x }",
+			expectedConstants: []interface{}{1},
+			expectedInstructions: []code.Instructions{
+				// 0000
+				code.Make(code.OpConstant, 0),
+				// 0003
+				code.Make(code.OpArray, 1),
+				// 0006
+				code.Make(code.OpGetIterator),
+				// 0007
+				code.Make(code.OpIterNext, 19),
+				// 0010
+				code.Make(code.OpSetLocal, 0),
+				// 0012
+				code.Make(code.OpPop),
+				// 0013
+				code.Make(code.OpGetLocal, 0),
+				// 0015
+				code.Make(code.OpPop),
+				// 0016
+				code.Make(code.OpJump, 7),
+				// 0019
+				code.Make(code.OpPop),
+				// 0020
+				code.Make(code.OpNull),
+				// 0021
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input:             "for (i, x in 0..3) { continue }",
+			expectedConstants: []interface{}{0, 3},
+			expectedInstructions: []code.Instructions{
+				// 0000
+				code.Make(code.OpConstant, 0),
+				// 0003
+				code.Make(code.OpConstant, 1),
+				// 0006
+				code.Make(code.OpRange),
+				// 0007
+				code.Make(code.OpGetIterator),
+				// 0008
+				code.Make(code.OpIterNext, 21),
+				// 0011
+				code.Make(code.OpSetLocal, 0),
+				// 0013
+				code.Make(code.OpSetLocal, 1),
+				// 0015
+				code.Make(code.OpJump, 8),
+				// 0018
+				code.Make(code.OpJump, 8),
+				// 0021
+				code.Make(code.OpPop),
+				// 0022
+				code.Make(code.OpNull),
+				// 0023
+				code.Make(code.OpPop),
+			},
+		},
+	}
+
+	runCompilerTests(t, tests)
+}
+
+func TestMatchExpressions(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			input:             "match (1) { 1 => 10, _ => 20 }",
+			expectedConstants: []interface{}{1, 1, 10, 20},
+			expectedInstructions: []code.Instructions{
+				// 0000
+				code.Make(code.OpConstant, 0),
+				// 0003
+				code.Make(code.OpSetGlobal, 0),
+				// 0006
+				code.Make(code.OpGetGlobal, 0),
+				// 0009
+				code.Make(code.OpConstant, 1),
+				// 0012
+				code.Make(code.OpEqual),
+				// 0013
+				code.Make(code.OpJumpNotTruthy, 22),
+				// 0016
+				code.Make(code.OpConstant, 2),
+				// 0019
+				code.Make(code.OpJump, 32),
+				// 0022
+				code.Make(code.OpConstant, 3),
+				// 0025
+				code.Make(code.OpJump, 32),
+				// 0028
+				code.Make(code.OpGetGlobal, 0),
+				// 0031
+				code.Make(code.OpMatchError),
+				// 0032
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input:             "match ([1]) { [x, ...t] => x }",
+			expectedConstants: []interface{}{1, 0},
+			expectedInstructions: []code.Instructions{
+				// 0000
+				code.Make(code.OpConstant, 0),
+				// 0003
+				code.Make(code.OpArray, 1),
+				// 0006
+				code.Make(code.OpSetGlobal, 0),
+				// 0009
+				code.Make(code.OpGetGlobal, 0),
+				// 0012
+				code.Make(code.OpMatchArray, 1, 1),
+				// 0016
+				code.Make(code.OpJumpNotTruthy, 41),
+				// 0019
+				code.Make(code.OpGetGlobal, 0),
+				// 0022
+				code.Make(code.OpConstant, 1),
+				// 0025
+				code.Make(code.OpIndex),
+				// 0026
+				code.Make(code.OpSetLocal, 0),
+				// 0028
+				code.Make(code.OpGetGlobal, 0),
+				// 0031
+				code.Make(code.OpArrayRest, 1),
+				// 0034
+				code.Make(code.OpSetLocal, 1),
+				// 0036
+				code.Make(code.OpGetLocal, 0),
+				// 0038
+				code.Make(code.OpJump, 45),
+				// 0041
+				code.Make(code.OpGetGlobal, 0),
+				// 0044
+				code.Make(code.OpMatchError),
+				// 0045
+				code.Make(code.OpPop),
+			},
+		},
+	}
+
+	runCompilerTests(t, tests)
+}
+
+func TestDestructuring(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			input:             "let [a, b] = [1, 2];",
+			expectedConstants: []interface{}{1, 2, 0, 1, "[a, b]"},
+			expectedInstructions: []code.Instructions{
+				// 0000
+				code.Make(code.OpConstant, 0),
+				// 0003
+				code.Make(code.OpConstant, 1),
+				// 0006
+				code.Make(code.OpArray, 2),
+				// 0009
+				code.Make(code.OpSetGlobal, 0),
+				// 0012
+				code.Make(code.OpGetGlobal, 0),
+				// 0015
+				code.Make(code.OpMatchArray, 2, 0),
+				// 0019
+				code.Make(code.OpJumpNotTruthy, 45),
+				// 0022
+				code.Make(code.OpGetGlobal, 0),
+				// 0025
+				code.Make(code.OpConstant, 2),
+				// 0028
+				code.Make(code.OpIndex),
+				// 0029
+				code.Make(code.OpSetGlobal, 1),
+				// 0032
+				code.Make(code.OpGetGlobal, 0),
+				// 0035
+				code.Make(code.OpConstant, 3),
+				// 0038
+				code.Make(code.OpIndex),
+				// 0039
+				code.Make(code.OpSetGlobal, 2),
+				// 0042
+				code.Make(code.OpJump, 51),
+				// 0045
+				code.Make(code.OpGetGlobal, 0),
+				// 0048
+				code.Make(code.OpDestructureError, 4),
+			},
+		},
+		{
+			input: "fn([x]) { x }",
+			expectedConstants: []interface{}{
+				0,
+				"[x]",
+				[]code.Instructions{
+					code.Make(code.OpGetLocal, 0),
+					code.Make(code.OpMatchArray, 1, 0),
+					code.Make(code.OpJumpNotTruthy, 20),
+					code.Make(code.OpGetLocal, 0),
+					code.Make(code.OpConstant, 0),
+					code.Make(code.OpIndex),
+					code.Make(code.OpSetLocal, 1),
+					code.Make(code.OpJump, 25),
+					code.Make(code.OpGetLocal, 0),
+					code.Make(code.OpDestructureError, 1),
+					code.Make(code.OpGetLocal, 1),
+					code.Make(code.OpReturnValue),
+				},
+			},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpClosure, 2, 0),
+				code.Make(code.OpPop),
+			},
+		},
+	}
+
+	runCompilerTests(t, tests)
+}
+
+func TestDefaultsAndSpread(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			input: "fn(a, b = 2) { b }",
+			expectedConstants: []interface{}{
+				2,
+				[]code.Instructions{
+					code.Make(code.OpArgMissing, 1),
+					code.Make(code.OpJumpNotTruthy, 10),
+					code.Make(code.OpConstant, 0),
+					code.Make(code.OpSetLocal, 1),
+					code.Make(code.OpGetLocal, 1),
+					code.Make(code.OpReturnValue),
+				},
+			},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpClosure, 1, 0),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input:             "[1, ...[2], 3]",
+			expectedConstants: []interface{}{1, 2, 3},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpArray, 1),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpArray, 1),
+				code.Make(code.OpSpread),
+				code.Make(code.OpConstant, 2),
+				code.Make(code.OpArray, 1),
+				code.Make(code.OpSpread),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input:             "len(...[1])",
+			expectedConstants: []interface{}{1},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpGetBuiltin, 0),
+				code.Make(code.OpArray, 0),
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpArray, 1),
+				code.Make(code.OpSpread),
+				code.Make(code.OpCallSpread),
+				code.Make(code.OpPop),
+			},
+		},
+	}
+
+	runCompilerTests(t, tests)
+}
+
+func TestMethodCalls(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			input:             `"a".upper()`,
+			expectedConstants: []interface{}{"a", "upper"},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpGetMethod, 1),
+				code.Make(code.OpCall, 0),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input:             `{}.x`,
+			expectedConstants: []interface{}{"x"},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpHash, 0),
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpIndex),
+				code.Make(code.OpPop),
+			},
+		},
+	}
+
+	runCompilerTests(t, tests)
+}
+
+func TestTryExpressions(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			input:             `try { 1 } catch (e) { e }`,
+			expectedConstants: []interface{}{1},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpTry, 10),
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpEndTry),
+				code.Make(code.OpJump, 15),
+				code.Make(code.OpCatch),
+				code.Make(code.OpSetLocal, 0),
+				code.Make(code.OpGetLocal, 0),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input:             `try { 1 } finally { 2 }`,
+			expectedConstants: []interface{}{1, 2, 2},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpTry, 14),
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpEndTry),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpPop),
+				code.Make(code.OpJump, 19),
+				code.Make(code.OpConstant, 2),
+				code.Make(code.OpPop),
+				code.Make(code.OpThrow),
+				code.Make(code.OpPop),
+			},
+		},
+	}
+
+	runCompilerTests(t, tests)
+}
+
+func TestNullishAndOptionalChains(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			input:             "null ?? 1",
+			expectedConstants: []interface{}{1},
+			expectedInstructions: []code.Instructions{
+				// 0000
+				code.Make(code.OpNull),
+				// 0001
+				code.Make(code.OpJumpNotNullOrPop, 7),
+				// 0004
+				code.Make(code.OpConstant, 0),
+				// 0007
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input:             "let h = {}; h?.a.b",
+			expectedConstants: []interface{}{"a", "b"},
+			expectedInstructions: []code.Instructions{
+				// 0000
+				code.Make(code.OpHash, 0),
+				// 0003
+				code.Make(code.OpSetGlobal, 0),
+				// 0006
+				code.Make(code.OpGetGlobal, 0),
+				// 0009
+				code.Make(code.OpJumpNull, 20),
+				// 0012
+				code.Make(code.OpConstant, 0),
+				// 0015
+				code.Make(code.OpIndex),
+				// 0016
+				code.Make(code.OpConstant, 1),
+				// 0019
+				code.Make(code.OpIndex),
+				// 0020
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input:             "let h = {}; h[h?[1]]",
+			expectedConstants: []interface{}{1},
+			expectedInstructions: []code.Instructions{
+				// 0000
+				code.Make(code.OpHash, 0),
+				// 0003
+				code.Make(code.OpSetGlobal, 0),
+				// 0006
+				code.Make(code.OpGetGlobal, 0),
+				// 0009
+				code.Make(code.OpGetGlobal, 0),
+				// 0012
+				code.Make(code.OpJumpNull, 19),
+				// 0015
+				code.Make(code.OpConstant, 0),
+				// 0018
+				code.Make(code.OpIndex),
+				// 0019
+				code.Make(code.OpIndex),
+				// 0020
+				code.Make(code.OpPop),
+			},
+		},
+	}
+
+	runCompilerTests(t, tests)
+}
+
+func TestStructs(t *testing.T) {
+	program := parse("struct Point { x, y }; Point(1, 2).x")
+	compiler := New()
+	err := compiler.Compile(program)
+	if err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+	bytecode := compiler.Bytecode()
+
+	err = testInstructions([]code.Instructions{
+		code.Make(code.OpConstant, 0),
+		code.Make(code.OpSetGlobal, 0),
+		code.Make(code.OpGetGlobal, 0),
+		code.Make(code.OpConstant, 1),
+		code.Make(code.OpConstant, 2),
+		code.Make(code.OpCall, 2),
+		code.Make(code.OpConstant, 3),
+		code.Make(code.OpIndex),
+		code.Make(code.OpPop),
+	}, bytecode.Instructions)
+	if err != nil {
+		t.Fatalf("testInstructions failed: %s", err)
+	}
+	structType, ok := bytecode.Constants[0].(*object.StructType)
+	if !ok {
+		t.Fatalf("constant 0 is not a struct type. got=%T", bytecode.Constants[0])
+	}
+	if structType.Name != "Point" || fmt.Sprint(structType.Fields) != "[x y]" {
+		t.Errorf("wrong struct type: %s %v", structType.Name, structType.Fields)
+	}
+}
+
+func TestBlockLocals(t *testing.T) {
+	tests := []struct {
+		input     string
+		numLocals int
+	}{
+		{"fn() { if (true) { let a = 1; let b = 2 } else { let c = 3 } let d = 4 }", 2},
+		{"fn(x) { while (x) { let a = 1; if (a) { let b = 2 } } for (y in x) { let z = y } }", 3},
+		{"fn() { match (1) { [a, b] => a, c => c } }", 3},
+		{"if (true) { let a = 1 } for (x in []) { let y = x }", 2},
+	}
+
+	for _, tt := range tests {
+		compiler := New()
+		err := compiler.Compile(parse(tt.input))
+		if err != nil {
+			t.Fatalf("compiler error: %s", err)
+		}
+		bytecode := compiler.Bytecode()
+		numLocals := bytecode.NumLocals
+		for _, constant := range bytecode.Constants {
+			if fn, ok := constant.(*object.CompiledFunction); ok {
+				numLocals = fn.NumLocals
+			}
+		}
+		if numLocals != tt.numLocals {
+			t.Errorf("wrong number of locals for %q. want=%d, got=%d", tt.input, tt.numLocals, numLocals)
+		}
+	}
+}
+
+func TestConstants(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			input:             "const MAX = 100; MAX + MAX",
+			expectedConstants: []interface{}{100, 100},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpSetGlobal, 0),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpAdd),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input: "const N = 7; fn() { N }; N; N",
+			expectedConstants: []interface{}{
+				7,
+				7,
+				[]code.Instructions{
+					code.Make(code.OpConstant, 1),
+					code.Make(code.OpReturnValue),
+				},
+			},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpSetGlobal, 0),
+				code.Make(code.OpClosure, 2, 0),
+				code.Make(code.OpPop),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpPop),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input:             "const DEBUG = false; const NEG = -2; DEBUG; NEG",
+			expectedConstants: []interface{}{2, -2},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpFalse),
+				code.Make(code.OpSetGlobal, 0),
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpMinus),
+				code.Make(code.OpSetGlobal, 1),
+				code.Make(code.OpFalse),
+				code.Make(code.OpPop),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input:             "const xs = [1]; xs",
+			expectedConstants: []interface{}{1},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpArray, 1),
+				code.Make(code.OpSetGlobal, 0),
+				code.Make(code.OpGetGlobal, 0),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input: `fn() { const S = "s"; fn() { S } }`,
+			expectedConstants: []interface{}{
+				"s",
+				"s",
+				[]code.Instructions{
+					code.Make(code.OpConstant, 1),
+					code.Make(code.OpReturnValue),
+				},
+				[]code.Instructions{
+					code.Make(code.OpConstant, 0),
+					code.Make(code.OpSetLocal, 0),
+					code.Make(code.OpClosure, 2, 0),
+					code.Make(code.OpReturnValue),
+				},
+			},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpClosure, 3, 0),
+				code.Make(code.OpPop),
+			},
+		},
+	}
+
+	runCompilerTests(t, tests)
+}
+
+func TestCompilerErrorPositions(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"let a = 1;\nlet b = a + c;", "2:13: undefined variable c"},
+		{"fn() {\n  x\n}", "2:3: undefined variable x"},
+		{"let a = 1;\nb = a;", "2:3: undefined variable b"},
+		{"len = 1;", "1:5: cannot assign to builtin len"},
+		{"const f = fn() { f = 1 };", "1:20: cannot assign to constant f"},
+		{"let a = 1;\nbreak;", "2:1: break outside of a loop"},
+		{`import "lib" as lib;`, `1:1: cannot import "lib": no module loader`},
+		{"const max = 1;\nmax = 2;", "2:5: cannot assign to constant max"},
+		{"const max = 1;\nmax += 2;", "2:5: cannot assign to constant max"},
+		{"const max = 1;\nlet max = 2;", "2:1: cannot redeclare constant max"},
+		{"const [a, b] = [1, 2];\nlet f = fn() { a = 3 };", "2:18: cannot assign to constant a"},
+		{"if (true) {\n  const x = 1;\n  let x = 2;\n}", "3:3: cannot redeclare constant x"},
+		{"if (true) { let x = 1 }\nx", "2:1: undefined variable x"},
+		{"struct P { x }\nP = 1;", "2:3: cannot assign to constant P"},
+		{"const P = 1;\nstruct P { x }", "2:1: cannot redeclare constant P"},
+		{"for (x in [1]) { x }\nx", "2:1: undefined variable x"},
+		{"match (1) { n => n }\nn", "2:1: undefined variable n"},
+		{"try { 1 } catch (e) { e }\ne", "2:1: undefined variable e"},
+	}
+
+	for _, tt := range tests {
+		program := parse(tt.input)
+		compiler := New()
+		err := compiler.Compile(program)
+		if err == nil {
+			t.Fatalf("expected compiler error but resulted in none.")
+		}
+		if err.Error() != tt.expected {
+			t.Errorf("wrong compiler error. want=%q, got=%q", tt.expected, err)
+		}
+	}
+}
+
+func TestSourceMap(t *testing.T) {
+	program := parse("1;\n\n2 + 3;")
+	compiler := New()
+	err := compiler.Compile(program)
+	if err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+	bytecode := compiler.Bytecode()
+
+	tests := []struct {
+		offset       int
+		expectedLine int
+	}{
+		{0, 1},
+		{3, 1},
+		{4, 3},
+		{10, 3},
+	}
+	for _, tt := range tests {
+		pos, ok := bytecode.SourceMap.Lookup(tt.offset)
+		if !ok {
+			t.Fatalf("no position for offset %d", tt.offset)
+		}
+		if pos.Line != tt.expectedLine {
+			t.Errorf("wrong line for offset %d. want=%d, got=%d", tt.offset, tt.expectedLine, pos.Line)
+		}
+	}
+}
@@ -0,0 +1,65 @@
+package compiler
+
+import (
+	"monkey/ast"
+	"monkey/code"
+	"monkey/module"
+	"monkey/object"
+)
+
+// SetModuleLoader makes the compiler resolve the imports of the file
+// filename through loader, compiling each module the first time it is
+// imported. filename is empty for code that is not in a file.
+func (c *Compiler) SetModuleLoader(loader *module.Loader, filename string) {
+	c.loader = loader
+	c.filename = filename
+}
+
+func (c *Compiler) compileImportStatement(node *ast.ImportStatement) error {
+	if c.loader == nil {
+		return c.errorf("cannot import %q: no module loader", node.Path)
+	}
+	fn, err := c.loader.Import(node.Path, c.filename, c.compileModule)
+	if err != nil {
+		return &module.ImportError{Pos: c.pos, Path: node.Path, Err: err}
+	}
+	symbol, err := c.define(node.Name.Value)
+	if err != nil {
+		return err
+	}
+	c.emit(code.OpImport, c.addConstant(fn), c.addConstant(&object.String{Value: node.Path}))
+	c.setSymbol(symbol)
+	return nil
+}
+
+// compileModule compiles the top-level code of a module to a function that
+// returns a hash of its exports. The module gets a global namespace of its
+// own and shares the constants of the program.
+func (c *Compiler) compileModule(filename string, program *ast.Program) (object.Object, error) {
+	mc := New()
+	mc.constants = c.constants
+	mc.SetModuleLoader(c.loader, filename)
+	err := mc.Compile(program)
+	c.constants = mc.constants
+	if err != nil {
+		return nil, err
+	}
+
+	exports := module.Exports(program)
+	for _, name := range exports {
+		symbol, _ := mc.symbolTable.Resolve(name)
+		mc.emit(code.OpConstant, mc.addConstant(&object.String{Value: name}))
+		mc.loadSymbol(symbol)
+	}
+	mc.emit(code.OpHash, 2*len(exports))
+	mc.emit(code.OpReturnValue)
+	c.constants = mc.constants
+
+	bytecode := mc.Bytecode()
+	return &object.CompiledFunction{
+		Instructions: bytecode.Instructions,
+		SourceMap:    bytecode.SourceMap,
+		NumLocals:    bytecode.NumLocals,
+		Module:       filename,
+	}, nil
+}
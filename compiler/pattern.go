@@ -0,0 +1,216 @@
+package compiler
+
+import (
+	"fmt"
+	"monkey/ast"
+	"monkey/code"
+	"monkey/object"
+)
+
+// compileMatchExpression keeps the subject in a hidden variable and tests
+// it against each arm in turn. A failed test jumps to the next arm, and
+// falling off the last arm raises an error.
+func (c *Compiler) compileMatchExpression(node *ast.MatchExpression) error {
+	err := c.Compile(node.Subject)
+	if err != nil {
+		return err
+	}
+	subject := c.allocTemp()
+	defer c.freeTemp()
+	c.setSymbol(subject)
+
+	ends := []int{}
+	for _, arm := range node.Arms {
+		fails, err := c.compileMatchArm(arm, subject)
+		if err != nil {
+			return err
+		}
+		ends = append(ends, c.emit(code.OpJump, 9999))
+		c.patchJumps(fails, len(c.currentInstructions()))
+	}
+
+	c.loadSymbol(subject)
+	c.emit(code.OpMatchError)
+	c.patchJumps(ends, len(c.currentInstructions()))
+	return nil
+}
+
+// compileMatchArm compiles an arm in a block of its own, which holds the
+// variables its pattern binds. It returns the jumps taken when the arm does
+// not apply.
+func (c *Compiler) compileMatchArm(arm *ast.MatchArm, subject Symbol) ([]int, error) {
+	c.enterBlock()
+	defer c.leaveBlock()
+
+	fails, err := c.compilePattern(arm.Pattern, subject)
+	if err != nil {
+		return nil, err
+	}
+	if arm.Guard != nil {
+		err := c.Compile(arm.Guard)
+		if err != nil {
+			return nil, err
+		}
+		fails = append(fails, c.emit(code.OpJumpNotTruthy, 9999))
+	}
+
+	err = c.Compile(arm.Body)
+	if err != nil {
+		return nil, err
+	}
+	c.keepLastValue(arm.Body)
+	return fails, nil
+}
+
+// compileDestructuring binds the identifiers in pattern to the parts of
+// the value held in symbol, raising an error, positioned at the pattern, if
+// the value does not have the pattern's shape.
+func (c *Compiler) compileDestructuring(pattern ast.Expression, symbol Symbol) error {
+	fails, err := c.compilePattern(pattern, symbol)
+	if err != nil || len(fails) == 0 {
+		return err
+	}
+	jumpPos := c.emit(code.OpJump, 9999)
+	c.patchJumps(fails, len(c.currentInstructions()))
+
+	outerPos := c.pos
+	c.pos = pattern.Pos()
+	c.loadSymbol(symbol)
+	c.emit(code.OpDestructureError, c.addConstant(&object.String{Value: pattern.String()}))
+	c.pos = outerPos
+
+	c.changeOperand(jumpPos, len(c.currentInstructions()))
+	return nil
+}
+
+// compilePattern emits code that matches the value held in symbol against
+// pattern and binds the pattern's identifiers. It returns the jumps taken
+// when the value does not match, which leave the stack as they found it.
+func (c *Compiler) compilePattern(pattern ast.Expression, symbol Symbol) ([]int, error) {
+	switch pattern := pattern.(type) {
+	case *ast.Identifier:
+		if pattern.Value != "_" {
+			target, err := c.define(pattern.Value)
+			if err != nil {
+				return nil, err
+			}
+			c.loadSymbol(symbol)
+			c.setSymbol(target)
+		}
+		return nil, nil
+
+	case *ast.ArrayPattern:
+		hasRest := 0
+		if pattern.Rest != nil {
+			hasRest = 1
+		}
+		c.loadSymbol(symbol)
+		c.emit(code.OpMatchArray, len(pattern.Elements), hasRest)
+		fails := []int{c.emit(code.OpJumpNotTruthy, 9999)}
+
+		for i, element := range pattern.Elements {
+			if isWildcard(element) {
+				continue
+			}
+			c.loadSymbol(symbol)
+			c.emit(code.OpConstant, c.addConstant(&object.Integer{Value: int64(i)}))
+			c.emit(code.OpIndex)
+			elementFails, err := c.compileSubpattern(element)
+			if err != nil {
+				return nil, err
+			}
+			fails = append(fails, elementFails...)
+		}
+
+		if pattern.Rest != nil && !isWildcard(pattern.Rest) {
+			rest, err := c.define(pattern.Rest.Value)
+			if err != nil {
+				return nil, err
+			}
+			c.loadSymbol(symbol)
+			c.emit(code.OpArrayRest, len(pattern.Elements))
+			c.setSymbol(rest)
+		}
+		return fails, nil
+
+	case *ast.HashPattern:
+		c.loadSymbol(symbol)
+		c.emit(code.OpMatchHash)
+		fails := []int{c.emit(code.OpJumpNotTruthy, 9999)}
+
+		for i, key := range pattern.Keys {
+			c.loadSymbol(symbol)
+			err := c.Compile(key)
+			if err != nil {
+				return nil, err
+			}
+			c.emit(code.OpHasKey)
+			fails = append(fails, c.emit(code.OpJumpNotTruthy, 9999))
+
+			if isWildcard(pattern.Values[i]) {
+				continue
+			}
+			c.loadSymbol(symbol)
+			err = c.Compile(key)
+			if err != nil {
+				return nil, err
+			}
+			c.emit(code.OpIndex)
+			valueFails, err := c.compileSubpattern(pattern.Values[i])
+			if err != nil {
+				return nil, err
+			}
+			fails = append(fails, valueFails...)
+		}
+		return fails, nil
+
+	default:
+		c.loadSymbol(symbol)
+		err := c.Compile(pattern)
+		if err != nil {
+			return nil, err
+		}
+		c.emit(code.OpEqual)
+		return []int{c.emit(code.OpJumpNotTruthy, 9999)}, nil
+	}
+}
+
+// compileSubpattern matches the value on top of the stack against pattern,
+// binding it directly if pattern is an identifier.
+func (c *Compiler) compileSubpattern(pattern ast.Expression) ([]int, error) {
+	if ident, ok := pattern.(*ast.Identifier); ok {
+		symbol, err := c.define(ident.Value)
+		if err != nil {
+			return nil, err
+		}
+		c.setSymbol(symbol)
+		return nil, nil
+	}
+
+	temp := c.allocTemp()
+	defer c.freeTemp()
+	c.setSymbol(temp)
+	return c.compilePattern(pattern, temp)
+}
+
+func isWildcard(pattern ast.Expression) bool {
+	ident, ok := pattern.(*ast.Identifier)
+	return ok && ident.Value == "_"
+}
+
+// allocTemp returns a hidden variable for an intermediate value. Temps are
+// numbered by how many are in use, so nested constructs get distinct ones
+// and a slot is reused once the construct that held it is compiled.
+func (c *Compiler) allocTemp() Symbol {
+	scope := &c.scopes[c.scopeIndex]
+	name := fmt.Sprintf("$temp%d", scope.temps)
+	scope.temps++
+	if symbol, ok := c.symbolTable.store[name]; ok {
+		return symbol
+	}
+	return c.symbolTable.Define(name)
+}
+
+func (c *Compiler) freeTemp() {
+	c.scopes[c.scopeIndex].temps--
+}
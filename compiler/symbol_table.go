@@ -1,5 +1,7 @@
 package compiler
 
+import "monkey/object"
+
 type SymbolScope string
 
 const (
@@ -14,6 +16,12 @@ type Symbol struct {
 	Name  string
 	Scope SymbolScope
 	Index int
+	Const bool
+	// Value is the value of a constant bound to a literal. Loads of the
+	// symbol push it directly instead of reading the variable.
+	Value object.Object
+	// Constant is the index of Value in the constant pool.
+	Constant int
 }
 
 type SymbolTable struct {
@@ -21,12 +29,32 @@ type SymbolTable struct {
 	numDefinitions int
 	Outer          *SymbolTable
 	FreeSymbols    []Symbol
+
+	// slots allocates the local variables of a function, or of the blocks
+	// at the top level. Block tables share the slots of their function.
+	slots *slots
+	block bool
+	base  int // first slot of a block, released when the block ends
+}
+
+type slots struct {
+	next int
+	max  int
+}
+
+func (s *slots) alloc() int {
+	index := s.next
+	s.next++
+	if s.next > s.max {
+		s.max = s.next
+	}
+	return index
 }
 
 func NewSymbolTable() *SymbolTable {
 	s := make(map[string]Symbol)
 	free := []Symbol{}
-	return &SymbolTable{store: s, FreeSymbols: free}
+	return &SymbolTable{store: s, FreeSymbols: free, slots: &slots{}}
 }
 
 func (s *SymbolTable) defineFree(original Symbol) Symbol {
@@ -43,18 +71,68 @@ func NewEnclosedSymbolTable(outer *SymbolTable) *SymbolTable {
 	return s
 }
 
+// NewBlockSymbolTable returns the table of a block nested in outer. Its
+// variables are locals of the enclosing function, or of the main program
+// at the top level, and their slots are reused once the block is released.
+func NewBlockSymbolTable(outer *SymbolTable) *SymbolTable {
+	s := NewSymbolTable()
+	s.Outer = outer
+	s.slots = outer.slots
+	s.block = true
+	s.base = outer.slots.next
+	return s
+}
+
+// release frees the slots of a block's variables for later blocks.
+func (s *SymbolTable) release() {
+	s.slots.next = s.base
+}
+
+// numLocals returns the number of local slots a function, or the main
+// program, needs for its variables and those of its blocks.
+func (s *SymbolTable) numLocals() int {
+	return s.slots.max
+}
+
 func (s *SymbolTable) Define(name string) Symbol {
 	symbol := Symbol{Name: name, Index: s.numDefinitions}
 	if s.Outer == nil {
 		symbol.Scope = GlobalScope
 	} else {
 		symbol.Scope = LocalScope
+		symbol.Index = s.slots.alloc()
 	}
 	s.store[name] = symbol
 	s.numDefinitions++
 	return symbol
 }
 
+// DefineConst defines name as a constant. value is its value if that is
+// known at compile time, and nil otherwise, and constant is the index of
+// value in the constant pool.
+func (s *SymbolTable) DefineConst(name string, value object.Object, constant int) Symbol {
+	symbol := s.Define(name)
+	symbol.Const = true
+	symbol.Value = value
+	symbol.Constant = constant
+	s.store[name] = symbol
+	return symbol
+}
+
+// IsConst reports whether s itself, rather than an enclosing table,
+// defines name as a constant.
+func (s *SymbolTable) IsConst(name string) bool {
+	symbol, ok := s.store[name]
+	return ok && symbol.Const
+}
+
+// markConst makes the variable name defined in s a constant.
+func (s *SymbolTable) markConst(name string) {
+	symbol := s.store[name]
+	symbol.Const = true
+	s.store[name] = symbol
+}
+
 func (s *SymbolTable) DefineFunctionName(name string) Symbol {
 	symbol := Symbol{Name: name, Index: 0, Scope: FunctionScope}
 	s.store[name] = symbol
@@ -69,12 +147,15 @@ func (s *SymbolTable) DefineBuiltin(index int, name string) Symbol {
 
 func (s *SymbolTable) Resolve(name string) (Symbol, bool) {
 	obj, ok := s.store[name]
+	if !ok && s.block {
+		return s.Outer.Resolve(name)
+	}
 	if !ok && s.Outer != nil {
 		obj, ok = s.Outer.Resolve(name)
 		if !ok {
 			return obj, ok
 		}
-		if obj.Scope == GlobalScope || obj.Scope == BuiltinScope {
+		if obj.Scope == GlobalScope || obj.Scope == BuiltinScope || obj.Value != nil {
 			return obj, ok
 		}
 		free := s.defineFree(obj)
@@ -82,3 +163,20 @@ func (s *SymbolTable) Resolve(name string) (Symbol, bool) {
 	}
 	return obj, ok
 }
+
+// origin returns the symbol a free symbol was captured from, following the
+// chain of enclosing tables. Other symbols are returned unchanged.
+func (s *SymbolTable) origin(symbol Symbol) Symbol {
+	for table := s.function(); symbol.Scope == FreeScope; table = table.Outer.function() {
+		symbol = table.FreeSymbols[symbol.Index]
+	}
+	return symbol
+}
+
+// function returns the table of the function s is in, skipping blocks.
+func (s *SymbolTable) function() *SymbolTable {
+	for s.block {
+		s = s.Outer
+	}
+	return s
+}
@@ -1,6 +1,9 @@
 package compiler
 
-import "testing"
+import (
+	"monkey/object"
+	"testing"
+)
 
 func TestDefine(t *testing.T) {
 	expected := map[string]Symbol{
@@ -39,3 +42,80 @@ func TestResolveGlobal(t *testing.T) {
 		}
 	}
 }
+
+func TestDefineConst(t *testing.T) {
+	global := NewSymbolTable()
+	max := global.DefineConst("max", &object.Integer{Value: 100}, 0)
+	global.DefineConst("limit", nil, -1)
+	global.Define("x")
+
+	if max.Scope != GlobalScope || max.Index != 0 || !max.Const || max.Constant != 0 {
+		t.Errorf("wrong symbol for max: %+v", max)
+	}
+	for name, expected := range map[string]bool{"max": true, "limit": true, "x": false, "y": false} {
+		if global.IsConst(name) != expected {
+			t.Errorf("IsConst(%q) wrong. want=%t", name, expected)
+		}
+	}
+
+	outer := NewEnclosedSymbolTable(global)
+	outer.DefineConst("n", &object.Integer{Value: 5}, 1)
+	outer.DefineConst("m", nil, -1)
+	inner := NewEnclosedSymbolTable(outer)
+	if inner.IsConst("n") {
+		t.Errorf("IsConst reports constants of enclosing tables")
+	}
+	n, _ := inner.Resolve("n")
+	if n.Scope != LocalScope || n.Value == nil {
+		t.Errorf("inlined constant n was captured: %+v", n)
+	}
+	m, _ := inner.Resolve("m")
+	if m.Scope != FreeScope {
+		t.Errorf("constant m was not captured: %+v", m)
+	}
+}
+
+func TestBlockSymbolTables(t *testing.T) {
+	global := NewSymbolTable()
+	global.Define("a")
+
+	fn := NewEnclosedSymbolTable(global)
+	fn.Define("p")
+	first := NewBlockSymbolTable(fn)
+	b := first.Define("b")
+	nested := NewBlockSymbolTable(first)
+	c := nested.Define("c")
+	nested.release()
+	first.release()
+	second := NewBlockSymbolTable(fn)
+	d := second.Define("d")
+
+	if b.Scope != LocalScope || b.Index != 1 || c.Index != 2 || d.Index != 1 {
+		t.Errorf("wrong slots. b=%+v, c=%+v, d=%+v", b, c, d)
+	}
+	if fn.numLocals() != 3 {
+		t.Errorf("wrong number of locals. want=3, got=%d", fn.numLocals())
+	}
+	if _, ok := fn.Resolve("b"); ok {
+		t.Errorf("variable b of a block resolved outside it")
+	}
+
+	closure := NewEnclosedSymbolTable(second)
+	inner := NewBlockSymbolTable(closure)
+	for _, expected := range []Symbol{
+		{Name: "a", Scope: GlobalScope, Index: 0},
+		{Name: "d", Scope: FreeScope, Index: 0},
+		{Name: "p", Scope: FreeScope, Index: 1},
+	} {
+		symbol, ok := inner.Resolve(expected.Name)
+		if !ok || symbol != expected {
+			t.Errorf("wrong symbol for %s. want=%+v, got=%+v", expected.Name, expected, symbol)
+		}
+	}
+	if len(inner.FreeSymbols) != 0 || len(closure.FreeSymbols) != 2 {
+		t.Errorf("free symbols recorded in the wrong table")
+	}
+	if origin := inner.origin(Symbol{Name: "p", Scope: FreeScope, Index: 1}); origin.Scope != LocalScope || origin.Index != 0 {
+		t.Errorf("wrong origin for p: %+v", origin)
+	}
+}
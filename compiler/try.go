@@ -0,0 +1,127 @@
+package compiler
+
+import (
+	"monkey/ast"
+	"monkey/code"
+)
+
+// compileTryExpression installs a handler around the try block. An error
+// raised in it jumps to the catch clause, which is itself covered by a
+// handler when there is a finally block, so that the finally block runs
+// before the error is raised again. On the normal paths the finally block
+// is compiled inline after the try block and after the catch clause.
+func (c *Compiler) compileTryExpression(node *ast.TryExpression) error {
+	handler, err := c.compileProtected(node.Block, node.Finally)
+	if err != nil {
+		return err
+	}
+	ends := []int{c.emit(code.OpJump, 9999)}
+	c.changeOperand(handler, len(c.currentInstructions()))
+
+	if node.Catch != nil {
+		rethrow := -1
+		if node.Finally != nil {
+			rethrow = c.emit(code.OpTry, 9999)
+			c.pushHandler(node.Finally)
+		}
+		err := c.compileCatch(node)
+		if err != nil {
+			return err
+		}
+		if node.Finally == nil {
+			c.patchJumps(ends, len(c.currentInstructions()))
+			return nil
+		}
+		c.popHandler()
+		c.emit(code.OpEndTry)
+		err = c.Compile(node.Finally)
+		if err != nil {
+			return err
+		}
+		ends = append(ends, c.emit(code.OpJump, 9999))
+		c.changeOperand(rethrow, len(c.currentInstructions()))
+	}
+
+	err = c.Compile(node.Finally)
+	if err != nil {
+		return err
+	}
+	c.emit(code.OpThrow)
+	c.patchJumps(ends, len(c.currentInstructions()))
+	return nil
+}
+
+// compileCatch binds the caught value to the catch parameter, in a block
+// of its own, and compiles the catch block.
+func (c *Compiler) compileCatch(node *ast.TryExpression) error {
+	c.enterBlock()
+	defer c.leaveBlock()
+
+	symbol, err := c.define(node.CatchParam.Value)
+	if err != nil {
+		return err
+	}
+	c.emit(code.OpCatch)
+	c.setSymbol(symbol)
+	err = c.Compile(node.Catch)
+	if err != nil {
+		return err
+	}
+	c.keepLastValue(node.Catch)
+	return nil
+}
+
+// compileProtected compiles block, leaving its value on the stack, under a
+// handler and then finally, if there is one. It returns the position of
+// the OpTry, whose target the caller patches.
+func (c *Compiler) compileProtected(block, finally *ast.BlockStatement) (int, error) {
+	pos := c.emit(code.OpTry, 9999)
+	c.pushHandler(finally)
+	err := c.Compile(block)
+	if err != nil {
+		return 0, err
+	}
+	c.keepLastValue(block)
+	c.popHandler()
+	c.emit(code.OpEndTry)
+	if finally != nil {
+		err := c.Compile(finally)
+		if err != nil {
+			return 0, err
+		}
+	}
+	return pos, nil
+}
+
+// pushHandler records a handler the code being compiled runs under, along
+// with the finally block, possibly nil, that must run when control leaves
+// it by break, continue or return.
+func (c *Compiler) pushHandler(finally *ast.BlockStatement) {
+	scope := &c.scopes[c.scopeIndex]
+	scope.handlers = append(scope.handlers, finally)
+}
+
+func (c *Compiler) popHandler() {
+	scope := &c.scopes[c.scopeIndex]
+	scope.handlers = scope.handlers[:len(scope.handlers)-1]
+}
+
+// leaveHandlers removes the handlers in effect beyond the first n,
+// innermost first, running their finally blocks. Each finally block is
+// compiled outside the handlers it leaves.
+func (c *Compiler) leaveHandlers(n int) error {
+	handlers := c.scopes[c.scopeIndex].handlers
+	defer func() { c.scopes[c.scopeIndex].handlers = handlers }()
+
+	for i := len(handlers) - 1; i >= n; i-- {
+		c.scopes[c.scopeIndex].handlers = handlers[:i]
+		c.emit(code.OpEndTry)
+		if handlers[i] != nil {
+			err := c.Compile(handlers[i])
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
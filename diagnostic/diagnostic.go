@@ -0,0 +1,72 @@
+package diagnostic
+
+import (
+	"fmt"
+	"monkey/token"
+	"sort"
+)
+
+type Severity int
+
+const (
+	Error Severity = iota
+	Warning
+)
+
+func (s Severity) String() string {
+	switch s {
+	case Error:
+		return "error"
+	case Warning:
+		return "warning"
+	default:
+		return fmt.Sprintf("severity(%d)", int(s))
+	}
+}
+
+// Code identifies a class of diagnostic. Lexer codes start with "L", parser
+// codes with "P".
+type Code string
+
+const (
+	IllegalCharacter    Code = "L0001"
+	UnterminatedComment Code = "L0002"
+	InvalidEncoding     Code = "L0003"
+	UnterminatedString  Code = "L0004"
+	InvalidEscape       Code = "L0005"
+	InvalidNumber       Code = "L0006"
+
+	UnexpectedToken   Code = "P0001"
+	MissingExpression Code = "P0002"
+	InvalidInteger    Code = "P0003"
+	InvalidFloat      Code = "P0004"
+	InvalidAssignment Code = "P0005"
+	OutsideLoop       Code = "P0006"
+	InvalidPattern    Code = "P0007"
+	InvalidParameter  Code = "P0008"
+	NotTopLevel       Code = "P0009"
+	DuplicateField    Code = "P0010"
+)
+
+// Diagnostic is a single message about a span of source code. End points
+// just past the last character of the span.
+type Diagnostic struct {
+	Severity Severity
+	Code     Code
+	Message  string
+	Start    token.Position
+	End      token.Position
+}
+
+// String formats the diagnostic as "pos: severity[code]: message".
+func (d Diagnostic) String() string {
+	return fmt.Sprintf("%s: %s[%s]: %s", d.Start, d.Severity, d.Code, d.Message)
+}
+
+// Sort orders diagnostics by their start offset, keeping the relative order
+// of diagnostics that start at the same offset.
+func Sort(diagnostics []Diagnostic) {
+	sort.SliceStable(diagnostics, func(i, j int) bool {
+		return diagnostics[i].Start.Offset < diagnostics[j].Start.Offset
+	})
+}
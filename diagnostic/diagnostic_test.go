@@ -0,0 +1,37 @@
+package diagnostic
+
+import (
+	"monkey/token"
+	"testing"
+)
+
+func TestString(t *testing.T) {
+	d := Diagnostic{
+		Severity: Error,
+		Code:     UnexpectedToken,
+		Message:  "expected next token to be =, got INT instead",
+		Start:    token.Position{Filename: "main.monkey", Offset: 6, Line: 1, Column: 7},
+	}
+
+	expected := "main.monkey:1:7: error[P0001]: expected next token to be =, got INT instead"
+	if d.String() != expected {
+		t.Errorf("d.String() wrong. want=%q, got=%q", expected, d.String())
+	}
+}
+
+func TestSort(t *testing.T) {
+	diagnostics := []Diagnostic{
+		{Message: "c", Start: token.Position{Offset: 9}},
+		{Message: "a", Start: token.Position{Offset: 1}},
+		{Message: "b1", Start: token.Position{Offset: 4}},
+		{Message: "b2", Start: token.Position{Offset: 4}},
+	}
+	Sort(diagnostics)
+
+	expected := []string{"a", "b1", "b2", "c"}
+	for i, msg := range expected {
+		if diagnostics[i].Message != msg {
+			t.Errorf("diagnostics[%d] wrong. want=%q, got=%q", i, msg, diagnostics[i].Message)
+		}
+	}
+}
@@ -5,10 +5,24 @@ import (
 )
 
 var builtins = map[string]*object.Builtin{
-	"len":   object.GetBuiltinByName("len"),
-	"first": object.GetBuiltinByName("first"),
-	"last":  object.GetBuiltinByName("last"),
-	"rest":  object.GetBuiltinByName("rest"),
-	"puts":  object.GetBuiltinByName("puts"),
-	"push":  object.GetBuiltinByName("push"),
+	"len":    object.GetBuiltinByName("len"),
+	"first":  object.GetBuiltinByName("first"),
+	"last":   object.GetBuiltinByName("last"),
+	"rest":   object.GetBuiltinByName("rest"),
+	"puts":   object.GetBuiltinByName("puts"),
+	"push":   object.GetBuiltinByName("push"),
+	"int":    object.GetBuiltinByName("int"),
+	"float":  object.GetBuiltinByName("float"),
+	"str":    object.GetBuiltinByName("str"),
+	"append": object.GetBuiltinByName("append"),
+	"delete": object.GetBuiltinByName("delete"),
+	"upper":  object.GetBuiltinByName("upper"),
+	"lower":  object.GetBuiltinByName("lower"),
+	"split":  object.GetBuiltinByName("split"),
+	"join":   object.GetBuiltinByName("join"),
+	"keys":   object.GetBuiltinByName("keys"),
+	"values": object.GetBuiltinByName("values"),
+	"map":    object.GetBuiltinByName("map"),
+	"filter": object.GetBuiltinByName("filter"),
+	"reduce": object.GetBuiltinByName("reduce"),
 }
@@ -0,0 +1,78 @@
+package evaluator
+
+import (
+	"monkey/ast"
+	"monkey/object"
+)
+
+// evalChain evaluates an access or call. It also reports whether an
+// optional access in its chain found null, in which case the value is null
+// and the rest of the chain the node is the left side of is skipped.
+func evalChain(node ast.Node, env *object.Environment) (object.Object, bool) {
+	switch node := node.(type) {
+	case *ast.CallExpression:
+		if node.Function.TokenLiteral() == "quote" {
+			return quote(node.Arguments[0], env), false
+		}
+		function, skip := evalChainLeft(node.Function, false, env)
+		if skip || isError(function) {
+			return function, skip
+		}
+		args := evalExpressions(node.Arguments, env)
+		if len(args) == 1 && isError(args[0]) {
+			return args[0], false
+		}
+		return applyFunction(function, args), false
+	case *ast.IndexExpression:
+		left, skip := evalChainLeft(node.Left, node.Optional, env)
+		if skip || isError(left) {
+			return left, skip
+		}
+		index := Eval(node.Index, env)
+		if isError(index) {
+			return index, false
+		}
+		return evalIndexExpression(left, index), false
+	case *ast.SliceExpression:
+		left, skip := evalChainLeft(node.Left, node.Optional, env)
+		if skip || isError(left) {
+			return left, skip
+		}
+		return evalSliceExpression(node, left, env), false
+	case *ast.MethodCallExpression:
+		receiver, skip := evalChainLeft(node.Receiver, node.Optional, env)
+		if skip || isError(receiver) {
+			return receiver, skip
+		}
+		method, ok := object.Method(receiver, node.Method.Value)
+		if !ok {
+			return newError("undefined method %s for %s", node.Method.Value, receiver.Type()), false
+		}
+		args := evalExpressions(node.Arguments, env)
+		if len(args) == 1 && isError(args[0]) {
+			return args[0], false
+		}
+		return applyFunction(method, args), false
+	}
+	return Eval(node, env), false
+}
+
+// evalChainLeft evaluates the left side of an access or call as part of
+// the same chain, which is skipped from there if an optional access finds
+// null. Errors are positioned as Eval does.
+func evalChainLeft(left ast.Expression, optional bool, env *object.Environment) (object.Object, bool) {
+	if !ast.IsChain(left) {
+		value := Eval(left, env)
+		return value, optional && isNull(value)
+	}
+	value, skip := evalChain(left, env)
+	if err, ok := value.(*object.Error); ok && !err.Pos.IsValid() {
+		err.Pos = left.Pos()
+	}
+	return value, skip || optional && isNull(value)
+}
+
+func isNull(obj object.Object) bool {
+	_, ok := obj.(*object.Null)
+	return ok
+}
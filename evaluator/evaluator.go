@@ -2,42 +2,75 @@ package evaluator
 
 import (
 	"fmt"
+	"math"
 	"monkey/ast"
 	"monkey/object"
+	"strings"
 )
 
 var (
 	TRUE  = &object.Boolean{Value: true}
 	FALSE = &object.Boolean{Value: false}
 	NULL  = &object.Null{}
+
+	BREAK    = &object.Break{}
+	CONTINUE = &object.Continue{}
 )
 
+// Eval evaluates node in env. Errors that do not carry a position yet are
+// attributed to the innermost node they surfaced from.
 func Eval(node ast.Node, env *object.Environment) object.Object {
+	result := eval(node, env)
+	if err, ok := result.(*object.Error); ok && !err.Pos.IsValid() && node != nil {
+		err.Pos = node.Pos()
+	}
+	return result
+}
+
+func eval(node ast.Node, env *object.Environment) object.Object {
 	switch node := node.(type) {
 	case *ast.Identifier:
 		return evalIdentifier(node, env)
+	case *ast.AssignExpression:
+		return evalAssignExpression(node, env)
 	case *ast.BlockStatement:
-		return evalBlockStatement(node, env)
+		return evalBlockStatement(node, object.NewEnclosedEnvironment(env))
 	case *ast.ReturnStatement:
 		val := Eval(node.ReturnValue, env)
 		if isError(val) {
 			return val
 		}
 		return &object.ReturnValue{Value: val}
-	case *ast.CallExpression:
-		if node.Function.TokenLiteral() == "quote" {
-			return quote(node.Arguments[0], env)
-		}
-		function := Eval(node.Function, env)
-
-		if isError(function) {
-			return function
+	case *ast.ThrowStatement:
+		val := Eval(node.Value, env)
+		if isError(val) {
+			return val
 		}
-		args := evalExpressions(node.Arguments, env)
-		if len(args) == 1 && isError(args[0]) {
-			return args[0]
+		return &object.Error{Message: "uncaught exception: " + val.Inspect(), Value: val}
+	case *ast.TryExpression:
+		return evalTryExpression(node, env)
+	case *ast.ImportStatement:
+		return evalImportStatement(node, env)
+	case *ast.StructStatement:
+		structType := object.NewStructType(node.Name.Value, node.FieldNames())
+		if err := env.Define(node.Name.Value, structType, true); err != nil {
+			return newError("%s", err)
 		}
-		return applyFunction(function, args)
+	case *ast.WhileStatement:
+		return evalWhileStatement(node, env)
+	case *ast.ForStatement:
+		return evalForStatement(node, env)
+	case *ast.ForInStatement:
+		return evalForInStatement(node, env)
+	case *ast.MatchExpression:
+		return evalMatchExpression(node, env)
+	case *ast.BreakStatement:
+		return BREAK
+	case *ast.ContinueStatement:
+		return CONTINUE
+	case *ast.CallExpression, *ast.IndexExpression, *ast.SliceExpression, *ast.MethodCallExpression:
+		result, _ := evalChain(node, env)
+		return result
 	case *ast.Program:
 		return evalProgram(node.Statements, env)
 	case *ast.LetStatement:
@@ -45,39 +78,40 @@ func Eval(node ast.Node, env *object.Environment) object.Object {
 		if isError(val) {
 			return val
 		}
-		env.Set(node.Name.Value, val)
+		if node.Pattern != nil {
+			return destructure(node.Pattern, val, env, node.IsConst())
+		}
+		if err := env.Define(node.Name.Value, val, node.IsConst()); err != nil {
+			return newError("%s", err)
+		}
 	case *ast.ArrayLiteral:
 		elements := evalExpressions(node.Elements, env)
 		if len(elements) == 1 && isError(elements[0]) {
 			return elements[0]
 		}
 		return &object.Array{Elements: elements}
-	case *ast.IndexExpression:
-		left := Eval(node.Left, env)
-		if isError(left) {
-			return left
-		}
-		index := Eval(node.Index, env)
-		if isError(index) {
-			return index
-		}
-		return evalIndexExpression(left, index)
 	case *ast.FunctionLiteral:
 		params := node.Parameters
 		body := node.Body
-		return &object.Function{Parameters: params, Env: env, Body: body}
+		return &object.Function{Parameters: params, Patterns: node.Patterns, Defaults: node.Defaults, Rest: node.Rest, Env: env, Body: body}
 	case *ast.IfExpression:
 		return evalIfExpression(node, env)
 	case *ast.HashLiteral:
 		return evalHashLiteral(node, env)
 	case *ast.StringLiteral:
 		return &object.String{Value: node.Value}
+	case *ast.InterpolatedString:
+		return evalInterpolatedString(node, env)
 	case *ast.ExpressionStatement:
 		return Eval(node.Expression, env)
 	case *ast.IntegerLiteral:
 		return &object.Integer{Value: node.Value}
+	case *ast.FloatLiteral:
+		return &object.Float{Value: node.Value}
 	case *ast.Boolean:
 		return nativeBoolToBooleanObject(node.Value)
+	case *ast.NullLiteral:
+		return NULL
 	case *ast.PrefixExpression:
 		right := Eval(node.Right, env)
 		if isError(right) {
@@ -89,10 +123,19 @@ func Eval(node ast.Node, env *object.Environment) object.Object {
 		if isError(left) {
 			return left
 		}
+		// &&, || and ?? yield the operand that decided the result and only
+		// evaluate the right operand when the left one doesn't decide it.
+		if node.Operator == "&&" && !isTruthy(left) || node.Operator == "||" && isTruthy(left) ||
+			node.Operator == "??" && !isNull(left) {
+			return left
+		}
 		right := Eval(node.Right, env)
 		if isError(right) {
 			return right
 		}
+		if node.Operator == "&&" || node.Operator == "||" || node.Operator == "??" {
+			return right
+		}
 		return evalInfixExpression(node.Operator, right, left)
 	}
 	return nil
@@ -123,13 +166,50 @@ func evalIndexExpression(left, index object.Object) object.Object {
 	switch {
 	case left.Type() == object.ARRAY_OBJ && index.Type() == object.INTEGER_OBJ:
 		return evalArrayIndexExpression(left, index)
+	case left.Type() == object.STRING_OBJ && index.Type() == object.INTEGER_OBJ:
+		return evalStringIndexExpression(left, index)
 	case left.Type() == object.HASH_OBJ:
 		return evalHashIndexExpression(left, index)
+	case left.Type() == object.MODULE_OBJ && index.Type() == object.STRING_OBJ:
+		value, err := left.(*object.Module).Export(index.(*object.String).Value)
+		if err != nil {
+			return newError("%s", err)
+		}
+		return value
+	case left.Type() == object.STRUCT_OBJ && index.Type() == object.STRING_OBJ:
+		value, err := left.(*object.Struct).Field(index.(*object.String).Value)
+		if err != nil {
+			return newError("%s", err)
+		}
+		return value
 	default:
 		return newError("index operator not supported: %s", left.Type())
 	}
 }
 
+func evalSliceExpression(node *ast.SliceExpression, left object.Object, env *object.Environment) object.Object {
+	bounds := []object.Object{NULL, NULL}
+	for i, bound := range []ast.Expression{node.Start, node.End} {
+		if bound == nil {
+			continue
+		}
+		bounds[i] = Eval(bound, env)
+		if isError(bounds[i]) {
+			return bounds[i]
+		}
+	}
+
+	sliceable, ok := left.(object.Sliceable)
+	if !ok {
+		return newError("slice operator not supported: %s", left.Type())
+	}
+	lo, hi, err := object.SliceBounds(bounds[0], bounds[1], sliceable.Len())
+	if err != nil {
+		return newError("%s", err)
+	}
+	return sliceable.Slice(lo, hi)
+}
+
 func evalArrayIndexExpression(array, index object.Object) object.Object {
 	arrayObject := array.(*object.Array)
 	idx := index.(*object.Integer).Value
@@ -140,6 +220,14 @@ func evalArrayIndexExpression(array, index object.Object) object.Object {
 	return arrayObject.Elements[idx]
 }
 
+func evalStringIndexExpression(str, index object.Object) object.Object {
+	char, ok := str.(*object.String).CharAt(index.(*object.Integer).Value)
+	if !ok {
+		return NULL
+	}
+	return char
+}
+
 func evalHashIndexExpression(hash, index object.Object) object.Object {
 	hashObj := hash.(*object.Hash)
 	key, ok := index.(object.Hashable)
@@ -157,11 +245,29 @@ func evalHashIndexExpression(hash, index object.Object) object.Object {
 func applyFunction(fn object.Object, args []object.Object) object.Object {
 	switch fn := fn.(type) {
 	case *object.Function:
-		extendedEnv := extendFunctionEnv(fn, args)
+		if arity := fn.Arity(); !arity.Accepts(len(args)) {
+			return newError("wrong number of arguments. want=%s, got=%d", arity, len(args))
+		}
+		extendedEnv, err := extendFunctionEnv(fn, args)
+		if err != nil {
+			return err
+		}
 		evaluated := Eval(fn.Body, extendedEnv)
 		return unwrapReturnValue(evaluated)
+	case *object.StructType:
+		value, err := fn.New(args)
+		if err != nil {
+			return newError("%s", err)
+		}
+		return value
 	case *object.Builtin:
-		if result := fn.Fn(args...); result != nil {
+		var result object.Object
+		if fn.HigherOrderFn != nil {
+			result = fn.HigherOrderFn(callFunction, args...)
+		} else {
+			result = fn.Fn(args...)
+		}
+		if result != nil {
 			return result
 		}
 		return NULL
@@ -170,12 +276,46 @@ func applyFunction(fn object.Object, args []object.Object) object.Object {
 	}
 }
 
-func extendFunctionEnv(fn *object.Function, args []object.Object) *object.Environment {
+// callFunction lets higher-order builtins call Monkey functions.
+func callFunction(fn object.Object, args ...object.Object) object.Object {
+	if result := applyFunction(fn, args); result != nil {
+		return result
+	}
+	return NULL
+}
+
+func extendFunctionEnv(fn *object.Function, args []object.Object) (*object.Environment, object.Object) {
 	env := object.NewEnclosedEnvironment(fn.Env)
 	for paramIdx, param := range fn.Parameters {
-		env.Set(param.Value, args[paramIdx])
+		var arg object.Object
+		if paramIdx < len(args) {
+			arg = args[paramIdx]
+		} else {
+			// Defaults are evaluated at each call, and may refer to the
+			// parameters before them.
+			arg = Eval(fn.Defaults[paramIdx], env)
+			if isError(arg) {
+				return nil, arg
+			}
+		}
+
+		if fn.Patterns != nil && fn.Patterns[paramIdx] != nil {
+			if err := destructure(fn.Patterns[paramIdx], arg, env, false); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		env.Set(param.Value, arg)
+	}
+
+	if fn.Rest != nil {
+		rest := []object.Object{}
+		if len(args) > len(fn.Parameters) {
+			rest = append(rest, args[len(fn.Parameters):]...)
+		}
+		env.Set(fn.Rest.Value, &object.Array{Elements: rest})
 	}
-	return env
+	return env, nil
 }
 
 func unwrapReturnValue(obj object.Object) object.Object {
@@ -188,11 +328,25 @@ func unwrapReturnValue(obj object.Object) object.Object {
 func evalExpressions(exps []ast.Expression, env *object.Environment) []object.Object {
 	var result []object.Object
 	for _, e := range exps {
+		spread, isSpread := e.(*ast.SpreadExpression)
+		if isSpread {
+			e = spread.Value
+		}
 		evaluated := Eval(e, env)
 		if isError(evaluated) {
 			return []object.Object{evaluated}
 		}
-		result = append(result, evaluated)
+		if !isSpread {
+			result = append(result, evaluated)
+			continue
+		}
+		array, ok := evaluated.(*object.Array)
+		if !ok {
+			err := newError("cannot spread %s", evaluated.Type())
+			err.Pos = spread.Pos()
+			return []object.Object{err}
+		}
+		result = append(result, array.Elements...)
 	}
 	return result
 }
@@ -207,6 +361,124 @@ func evalIdentifier(node *ast.Identifier, env *object.Environment) object.Object
 	return newError("identifier not found: " + node.Value)
 }
 
+func evalAssignExpression(node *ast.AssignExpression, env *object.Environment) object.Object {
+	if index, ok := node.Target.(*ast.IndexExpression); ok {
+		return evalIndexAssignment(node, index, env)
+	}
+	ident, ok := node.Target.(*ast.Identifier)
+	if !ok {
+		return newError("cannot assign to %s", node.Target.String())
+	}
+	if _, ok := env.Get(ident.Value); !ok {
+		if _, ok := builtins[ident.Value]; ok {
+			return newError("cannot assign to builtin %s", ident.Value)
+		}
+		return newError("identifier not found: " + ident.Value)
+	}
+
+	var current object.Object
+	if node.Operator != "" {
+		current = evalIdentifier(ident, env)
+	}
+	val := Eval(node.Value, env)
+	if isError(val) {
+		return val
+	}
+	if current != nil {
+		val = evalInfixExpression(node.Operator, val, current)
+		if isError(val) {
+			return val
+		}
+	}
+	if err := env.Assign(ident.Value, val); err != nil {
+		return newError("%s", err)
+	}
+	return val
+}
+
+func evalIndexAssignment(node *ast.AssignExpression, target *ast.IndexExpression, env *object.Environment) object.Object {
+	left := Eval(target.Left, env)
+	if isError(left) {
+		return left
+	}
+	index := Eval(target.Index, env)
+	if isError(index) {
+		return index
+	}
+
+	var current object.Object
+	if node.Operator != "" {
+		current = evalIndexExpression(left, index)
+		if isError(current) {
+			return current
+		}
+	}
+	val := Eval(node.Value, env)
+	if isError(val) {
+		return val
+	}
+	if current != nil {
+		val = evalInfixExpression(node.Operator, val, current)
+		if isError(val) {
+			return val
+		}
+	}
+
+	switch left := left.(type) {
+	case *object.Array:
+		i, ok := index.(*object.Integer)
+		if !ok {
+			return newError("array index must be an integer, got %s", index.Type())
+		}
+		if i.Value < 0 || i.Value >= int64(len(left.Elements)) {
+			return newError("index %d out of range for array of length %d", i.Value, len(left.Elements))
+		}
+		left.Elements[i.Value] = val
+	case *object.Hash:
+		key, ok := index.(object.Hashable)
+		if !ok {
+			return newError("unusable as hash key: %s", index.Type())
+		}
+		left.Pairs[key.HashKey()] = object.HashPair{Key: index, Value: val}
+	case *object.Struct:
+		name, ok := index.(*object.String)
+		if !ok {
+			return newError("struct field name must be a string, got %s", index.Type())
+		}
+		if err := left.SetField(name.Value, val); err != nil {
+			return newError("%s", err)
+		}
+	default:
+		return newError("index assignment not supported: %s", left.Type())
+	}
+	return val
+}
+
+func evalTryExpression(te *ast.TryExpression, env *object.Environment) object.Object {
+	result := Eval(te.Block, env)
+	if err, ok := result.(*object.Error); ok && te.Catch != nil {
+		catchEnv := object.NewEnclosedEnvironment(env)
+		catchEnv.Set(te.CatchParam.Value, err.Thrown())
+		result = Eval(te.Catch, catchEnv)
+	}
+
+	if te.Finally != nil {
+		// A finally block that throws, returns or leaves a loop overrides
+		// how the rest of the try expression ended.
+		if final := Eval(te.Finally, env); final != nil {
+			switch final.Type() {
+			case object.ERROR_OBJ, object.RETURN_VALUE_OBJ, object.BREAK_OBJ, object.CONTINUE_OBJ:
+				return final
+			}
+		}
+	}
+
+	if result == nil {
+		return NULL
+	}
+	return result
+}
+
 func evalIfExpression(ie *ast.IfExpression, env *object.Environment) object.Object {
 	condition := Eval(ie.Condition, env)
 	if isError(condition) {
@@ -242,8 +514,15 @@ func evalInfixExpression(operator string, right object.Object, left object.Objec
 	switch {
 	case left.Type() == object.INTEGER_OBJ && right.Type() == object.INTEGER_OBJ:
 		return evalIntegerInfixExpression(operator, right, left)
+	case object.IsNumber(left) && object.IsNumber(right):
+		return evalFloatInfixExpression(operator, right, left)
 	case left.Type() == object.STRING_OBJ && right.Type() == object.STRING_OBJ:
 		return evalStringInfixExpression(operator, right, left)
+	case left.Type() == object.STRUCT_OBJ && right.Type() == object.STRUCT_OBJ && (operator == "==" || operator == "!="):
+		equal := left.(*object.Struct).Equal(right.(*object.Struct))
+		return nativeBoolToBooleanObject(equal == (operator == "=="))
+	case left.Type() == object.NULL_OBJ && right.Type() == object.NULL_OBJ && (operator == "==" || operator == "!="):
+		return nativeBoolToBooleanObject(operator == "==")
 	case operator == "==":
 		return nativeBoolToBooleanObject(right == left)
 	case operator == "!=":
@@ -266,11 +545,77 @@ func evalIntegerInfixExpression(operator string, right object.Object, left objec
 	case "*":
 		return &object.Integer{Value: leftVal * rightVal}
 	case "/":
+		if rightVal == 0 {
+			return newError("division by zero")
+		}
 		return &object.Integer{Value: leftVal / rightVal}
+	case "%":
+		if rightVal == 0 {
+			return newError("division by zero")
+		}
+		return &object.Integer{Value: leftVal % rightVal}
+	case "**":
+		if rightVal < 0 {
+			return &object.Float{Value: math.Pow(float64(leftVal), float64(rightVal))}
+		}
+		return &object.Integer{Value: object.IntPow(leftVal, rightVal)}
+	case "..":
+		return &object.Range{Start: leftVal, End: rightVal}
+	case "&":
+		return &object.Integer{Value: leftVal & rightVal}
+	case "|":
+		return &object.Integer{Value: leftVal | rightVal}
+	case "^":
+		return &object.Integer{Value: leftVal ^ rightVal}
+	case "<<", ">>":
+		if rightVal < 0 {
+			return newError("negative shift count: %d", rightVal)
+		}
+		if operator == "<<" {
+			return &object.Integer{Value: leftVal << uint64(rightVal)}
+		}
+		return &object.Integer{Value: leftVal >> uint64(rightVal)}
+	case "<":
+		return nativeBoolToBooleanObject(leftVal < rightVal)
+	case ">":
+		return nativeBoolToBooleanObject(leftVal > rightVal)
+	case "<=":
+		return nativeBoolToBooleanObject(leftVal <= rightVal)
+	case ">=":
+		return nativeBoolToBooleanObject(leftVal >= rightVal)
+	case "==":
+		return nativeBoolToBooleanObject(rightVal == leftVal)
+	case "!=":
+		return nativeBoolToBooleanObject(rightVal != leftVal)
+	default:
+		return newError("unknown operator: %s %s %s", left.Type(), operator, right.Type())
+	}
+}
+
+func evalFloatInfixExpression(operator string, right object.Object, left object.Object) object.Object {
+	leftVal := object.ToFloat(left)
+	rightVal := object.ToFloat(right)
+	switch operator {
+	case "+":
+		return &object.Float{Value: leftVal + rightVal}
+	case "-":
+		return &object.Float{Value: leftVal - rightVal}
+	case "*":
+		return &object.Float{Value: leftVal * rightVal}
+	case "/":
+		return &object.Float{Value: leftVal / rightVal}
+	case "%":
+		return &object.Float{Value: math.Mod(leftVal, rightVal)}
+	case "**":
+		return &object.Float{Value: math.Pow(leftVal, rightVal)}
 	case "<":
 		return nativeBoolToBooleanObject(leftVal < rightVal)
 	case ">":
 		return nativeBoolToBooleanObject(leftVal > rightVal)
+	case "<=":
+		return nativeBoolToBooleanObject(leftVal <= rightVal)
+	case ">=":
+		return nativeBoolToBooleanObject(leftVal >= rightVal)
 	case "==":
 		return nativeBoolToBooleanObject(rightVal == leftVal)
 	case "!=":
@@ -286,11 +631,35 @@ func evalStringInfixExpression(operator string, right object.Object, left object
 	switch operator {
 	case "+":
 		return &object.String{Value: leftVal + rightVal}
+	case "<":
+		return nativeBoolToBooleanObject(leftVal < rightVal)
+	case ">":
+		return nativeBoolToBooleanObject(leftVal > rightVal)
+	case "<=":
+		return nativeBoolToBooleanObject(leftVal <= rightVal)
+	case ">=":
+		return nativeBoolToBooleanObject(leftVal >= rightVal)
+	case "==":
+		return nativeBoolToBooleanObject(leftVal == rightVal)
+	case "!=":
+		return nativeBoolToBooleanObject(leftVal != rightVal)
 	default:
 		return newError("unknown operator: %s %s %s", left.Type(), operator, right.Type())
 	}
 }
 
+func evalInterpolatedString(node *ast.InterpolatedString, env *object.Environment) object.Object {
+	var out strings.Builder
+	for _, part := range node.Parts {
+		val := Eval(part, env)
+		if isError(val) {
+			return val
+		}
+		out.WriteString(val.Inspect())
+	}
+	return &object.String{Value: out.String()}
+}
+
 func isError(obj object.Object) bool {
 	if obj != nil {
 		return obj.Type() == object.ERROR_OBJ
@@ -304,6 +673,8 @@ func evalPrefixExpression(operator string, right object.Object) object.Object {
 		return evalBangOperatorExpression(right)
 	case "-":
 		return evalMinusPrefixOperatorExpression(right)
+	case "~":
+		return evalBitNotPrefixOperatorExpression(right)
 	default:
 		return newError("unknown operator %s %s", operator, right.Type())
 	}
@@ -323,6 +694,9 @@ func evalBangOperatorExpression(right object.Object) object.Object {
 }
 
 func evalMinusPrefixOperatorExpression(right object.Object) object.Object {
+	if f, ok := right.(*object.Float); ok {
+		return &object.Float{Value: -f.Value}
+	}
 	if right.Type() != object.INTEGER_OBJ {
 		return newError("unknown operator: -%s", right.Type())
 	}
@@ -330,6 +704,14 @@ func evalMinusPrefixOperatorExpression(right object.Object) object.Object {
 	return &object.Integer{Value: -value}
 }
 
+func evalBitNotPrefixOperatorExpression(right object.Object) object.Object {
+	if right.Type() != object.INTEGER_OBJ {
+		return newError("unknown operator: ~%s", right.Type())
+	}
+	value := right.(*object.Integer).Value
+	return &object.Integer{Value: ^value}
+}
+
 func nativeBoolToBooleanObject(input bool) *object.Boolean {
 	if input {
 		return TRUE
@@ -361,10 +743,103 @@ func evalBlockStatement(block *ast.BlockStatement, env *object.Environment) obje
 
 		if result != nil {
 			rt := result.Type()
-			if rt == object.RETURN_VALUE_OBJ || rt == object.ERROR_OBJ {
+			if rt == object.RETURN_VALUE_OBJ || rt == object.ERROR_OBJ ||
+				rt == object.BREAK_OBJ || rt == object.CONTINUE_OBJ {
 				return result
 			}
 		}
 	}
 	return result
 }
+
+func evalWhileStatement(ws *ast.WhileStatement, env *object.Environment) object.Object {
+	for {
+		condition := Eval(ws.Condition, env)
+		if isError(condition) {
+			return condition
+		}
+		if !isTruthy(condition) {
+			return NULL
+		}
+
+		if result, done := evalLoopBody(ws.Body, env); done {
+			return result
+		}
+	}
+}
+
+func evalForStatement(fs *ast.ForStatement, env *object.Environment) object.Object {
+	env = object.NewEnclosedEnvironment(env)
+	if fs.Init != nil {
+		if init := Eval(fs.Init, env); isError(init) {
+			return init
+		}
+	}
+
+	for {
+		if fs.Condition != nil {
+			condition := Eval(fs.Condition, env)
+			if isError(condition) {
+				return condition
+			}
+			if !isTruthy(condition) {
+				return NULL
+			}
+		}
+
+		if result, done := evalLoopBody(fs.Body, env); done {
+			return result
+		}
+
+		if fs.Step != nil {
+			if step := Eval(fs.Step, env); isError(step) {
+				return step
+			}
+		}
+	}
+}
+
+func evalForInStatement(fs *ast.ForInStatement, env *object.Environment) object.Object {
+	iterable := Eval(fs.Iterable, env)
+	if isError(iterable) {
+		return iterable
+	}
+	it, ok := iterable.(object.Iterable)
+	if !ok {
+		return newError("cannot iterate over %s", iterable.Type())
+	}
+
+	iterator := it.NewIterator()
+	for {
+		key, value, ok := iterator.Next()
+		if !ok {
+			return NULL
+		}
+		// Each iteration binds the loop variables afresh.
+		iterEnv := object.NewEnclosedEnvironment(env)
+		if fs.Key != nil {
+			iterEnv.Set(fs.Key.Value, key)
+		}
+		iterEnv.Set(fs.Value.Value, value)
+
+		if result, done := evalLoopBody(fs.Body, iterEnv); done {
+			return result
+		}
+	}
+}
+
+// evalLoopBody runs one iteration of a loop and reports whether the loop
+// is done, along with the value the loop statement evaluates to.
+func evalLoopBody(body *ast.BlockStatement, env *object.Environment) (object.Object, bool) {
+	result := Eval(body, env)
+	if result == nil {
+		return nil, false
+	}
+	switch result.Type() {
+	case object.RETURN_VALUE_OBJ, object.ERROR_OBJ:
+		return result, true
+	case object.BREAK_OBJ:
+		return NULL, true
+	}
+	return nil, false
+}
@@ -2,8 +2,10 @@ package evaluator
 
 import (
 	"monkey/lexer"
+	"monkey/module"
 	"monkey/object"
 	"monkey/parser"
+	"os"
 	"testing"
 )
 
@@ -36,6 +38,59 @@ func TestEvalIntegerExpression(t *testing.T) {
 	}
 }
 
+func TestEvalFloatExpression(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected float64
+	}{
+		{"1.5", 1.5},
+		{"-2.25", -2.25},
+		{"1e3", 1000},
+		{"2.5E-1", 0.25},
+		{"1.5 + 1.5", 3},
+		{"1 + 0.5", 1.5},
+		{"0.5 * 4", 2},
+		{"7 / 2.0", 3.5},
+		{"10 - 2.5 * 2", 5},
+		{"let total = 3; let count = 4; total / float(count)", 0.75},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		testFloatObject(t, evaluated, tt.expected)
+	}
+}
+
+func TestNumberComparisonsAndConversions(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"1.5 < 2", "true"},
+		{"2 > 2.5", "false"},
+		{"1 == 1.0", "true"},
+		{"0.1 + 0.2 != 0.3", "true"},
+		{"int(3.9)", "3"},
+		{"int(-3.9)", "-3"},
+		{`int(" 42 ")`, "42"},
+		{"float(2)", "2.0"},
+		{`float("1.25")`, "1.25"},
+		{"str(1.5)", "1.5"},
+		{"str(10 / 4)", "2"},
+		{`str("x") + str([1, 2.0])`, "x[1, 2.0]"},
+		{`float("abc")`, `ERROR: 1:6: cannot convert "abc" to FLOAT`},
+		{"int(1e300)", "ERROR: 1:4: cannot convert 1e+300 to INTEGER"},
+		{"1 / 0", "ERROR: 1:3: division by zero"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		if evaluated.Inspect() != tt.expected {
+			t.Errorf("wrong result for %q. want=%q, got=%q", tt.input, tt.expected, evaluated.Inspect())
+		}
+	}
+}
+
 func TestFunctionObject(t *testing.T) {
 	input := "fn(x) { x + 2; };"
 
@@ -117,6 +172,21 @@ func testIntegerObject(t *testing.T, obj object.Object, expected int64) bool {
 	return true
 }
 
+func testFloatObject(t *testing.T, obj object.Object, expected float64) bool {
+	result, ok := obj.(*object.Float)
+	if !ok {
+		t.Errorf("object is not Float. got=%T (%+v)", obj, obj)
+		return false
+	}
+	if result.Value != expected {
+		t.Errorf("object has wrong value. got=%g, want=%g",
+			result.Value, expected)
+		return false
+	}
+
+	return true
+}
+
 func testBooleanObject(t *testing.T, obj object.Object, expected bool) bool {
 	result, ok := obj.(*object.Boolean)
 	if !ok {
@@ -156,6 +226,69 @@ func TestIfElseExpressions(t *testing.T) {
 	}
 }
 
+func TestOperators(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"1 <= 2", "true"},
+		{"3 <= 2", "false"},
+		{"3 >= 3", "true"},
+		{"1.5 <= 1", "false"},
+		{`"abc" < "abd"`, "true"},
+		{`"abc" == "abc"`, "true"},
+		{"7 % 3", "1"},
+		{"7.5 % 2", "1.5"},
+		{"2 ** 3 ** 2", "512"},
+		{"-2 ** 2", "-4"},
+		{"2 ** -1", "0.5"},
+		{"0b1100 & 0b1010", "8"},
+		{"0b1100 | 0b1010", "14"},
+		{"0b1100 ^ 0b1010", "6"},
+		{"~0", "-1"},
+		{"1 << 10", "1024"},
+		{"-16 >> 2", "-4"},
+		{"5 % 0", "ERROR: 1:3: division by zero"},
+		{"1 << -1", "ERROR: 1:3: negative shift count: -1"},
+		{"1.5 & 1", "ERROR: 1:5: unknown operator: FLOAT & INTEGER"},
+		{"true < false", "ERROR: 1:6: unknown operator: BOOLEAN < BOOLEAN"},
+		{"~1.5", "ERROR: 1:1: unknown operator: ~FLOAT"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		if evaluated.Inspect() != tt.expected {
+			t.Errorf("wrong result for %q. want=%q, got=%q", tt.input, tt.expected, evaluated.Inspect())
+		}
+	}
+}
+
+func TestLogicalOperators(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"true && true", "true"},
+		{"true && false", "false"},
+		{"false || true", "true"},
+		{"false || false", "false"},
+		{"1 < 2 && 2 < 3", "true"},
+		{`1 && "yes"`, "yes"},
+		{`false || "default"`, "default"},
+		{"if (1 > 2) { 10 } || 5", "5"},
+		{"let boom = fn() { -true }; false && boom()", "false"},
+		{"let boom = fn() { -true }; true || boom()", "true"},
+		{"false || -true", "ERROR: 1:10: unknown operator: -BOOLEAN"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		if evaluated.Inspect() != tt.expected {
+			t.Errorf("wrong result for %q. want=%q, got=%q", tt.input, tt.expected, evaluated.Inspect())
+		}
+	}
+}
+
 func TestBangOperator(t *testing.T) {
 	tests := []struct {
 		input    string
@@ -304,6 +437,36 @@ if (10 > 1) {
 	}
 }
 
+func TestErrorPositions(t *testing.T) {
+	tests := []struct {
+		input           string
+		expectedLine    int
+		expectedColumn  int
+		expectedInspect string
+	}{
+		{"let x = 1;\nlet y = x + z;", 2, 13, "ERROR: 2:13: identifier not found: z"},
+		{"5 + true;", 1, 3, "ERROR: 1:3: type mismatch: INTEGER + BOOLEAN"},
+		{"let f = fn() {\n  -true\n};\nf();", 2, 3, "ERROR: 2:3: unknown operator: -BOOLEAN"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+
+		errObj, ok := evaluated.(*object.Error)
+		if !ok {
+			t.Errorf("no error object returned. got=%T(%+v)", evaluated, evaluated)
+			continue
+		}
+		if errObj.Pos.Line != tt.expectedLine || errObj.Pos.Column != tt.expectedColumn {
+			t.Errorf("wrong error position. expected=%d:%d, got=%s",
+				tt.expectedLine, tt.expectedColumn, errObj.Pos)
+		}
+		if errObj.Inspect() != tt.expectedInspect {
+			t.Errorf("wrong inspect. expected=%q, got=%q", tt.expectedInspect, errObj.Inspect())
+		}
+	}
+}
+
 func TestLetStatements(t *testing.T) {
 	tests := []struct {
 		input    string
@@ -320,6 +483,478 @@ func TestLetStatements(t *testing.T) {
 	}
 }
 
+func TestAssignments(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"let x = 1; x = 2; x", "2"},
+		{"let x = 1; x += 2; x", "3"},
+		{"let x = 10; x -= 2; x *= 3; x /= 4; x", "6"},
+		{"let x = 1; let y = 2; x = y = 5; x + y", "10"},
+		{`let s = "a"; s += "b"`, "ab"},
+		{"let x = 1; let f = fn() { x = 5 }; f(); x", "5"},
+		{"let counter = fn() { let n = 0; fn() { n += 1 } }; let c = counter(); c(); c(); c()", "3"},
+		{"let f = fn() { let n = 0; let get = fn() { n }; n = 7; get() }; f()", "7"},
+		{"let f = fn(n) { let g = fn() { fn() { n *= 2 } }; g()(); g()(); n }; f(3)", "12"},
+		{"let f = fn() { f = 1 }; f()", "1"},
+		{"let f = fn() { f = 1 }; f(); f", "1"},
+		{"let g = fn() { let f = fn() { f = 5 }; f(); f }; g()", "5"},
+		{"let f = fn() { let h = fn() { f = 2 }; h() }; f(); f", "2"},
+		{"y = 1", "ERROR: 1:3: identifier not found: y"},
+		{"len = 1", "ERROR: 1:5: cannot assign to builtin len"},
+		{`let x = 1; x += "a"`, "ERROR: 1:14: type mismatch: INTEGER + STRING"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		if evaluated.Inspect() != tt.expected {
+			t.Errorf("wrong result for %q. want=%q, got=%q", tt.input, tt.expected, evaluated.Inspect())
+		}
+	}
+}
+
+func TestIndexAssignments(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`let a = [1, 2, 3]; a[1] = 5; a`, "[1, 5, 3]"},
+		{`let a = [1, 2, 3]; a[0] += 10; a[0]`, "11"},
+		{`let h = {"a": 1}; h["b"] = 2; h["a"] + h["b"]`, "3"},
+		{`let h = {"n": 1}; h["n"] *= 5; h["n"]`, "5"},
+		{`let a = [[0, 0], [0, 0]]; a[1][0] = 7; a`, "[[0, 0], [7, 0]]"},
+		{`let a = [0]; let f = fn(xs) { xs[0] = 9 }; f(a); a[0]`, "9"},
+		{`let a = [1]; a[0] = 2`, "2"},
+		{`let xs = []; for (i in 0..5) { append(xs, i * i) }; xs`, "[0, 1, 4, 9, 16]"},
+		{`let xs = [1]; append(xs, 2, 3) == xs`, "true"},
+		{`let xs = [1, 2, 3]; delete(xs, 1) + len(xs)`, "4"},
+		{`let xs = [1]; delete(xs, 5)`, "null"},
+		{`let h = {"a": 1, "b": 2}; delete(h, "a") + h["b"]`, "3"},
+		{`let h = {"a": 1}; delete(h, "a"); h`, "{}"},
+		{`let a = [1]; append(a, a); str(a)`, "[1, [...]]"},
+		{`let h = {}; h["self"] = h; str(h)`, "{self:{...}}"},
+		{`let b = [1]; let a = [b, b]; str(a)`, "[[1], [1]]"},
+		{"let a = [1];\na[1] = 2", "ERROR: 2:6: index 1 out of range for array of length 1"},
+		{`let s = "ab"; s[0] = "c"`, "ERROR: 1:20: index assignment not supported: STRING"},
+		{`let h = {}; h[[1]] = 1`, "ERROR: 1:20: unusable as hash key: ARRAY"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		if evaluated.Inspect() != tt.expected {
+			t.Errorf("wrong result for %q. want=%q, got=%q", tt.input, tt.expected, evaluated.Inspect())
+		}
+	}
+}
+
+func TestMethodCalls(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`let user = {"address": {"city": "Oslo"}}; user.address.city`, "Oslo"},
+		{`let h = {"n": 1}; h.n = 5; h.n += 1; h["n"]`, "6"},
+		{`"abc".upper()`, "ABC"},
+		{`"a,b".split(",").join("-")`, "a-b"},
+		{`[1, 2, 3].map(fn(x) { x * 2 })`, "[2, 4, 6]"},
+		{`[1, 2, 3, 4].filter(fn(x) { x % 2 == 0 }).reduce(fn(a, x) { a + x }, 0)`, "6"},
+		{`let obj = {"greet": fn(name) { "hi " + name }}; obj.greet("bo")`, "hi bo"},
+		{`let h = {"b": 2, "a": 1}; h.keys().join(",") + h.values().join(",")`, "a,b1,2"},
+		{`map([1], fn(x) { x + 1 })`, "[2]"},
+		{`let total = 0; [1, 2].map(fn(x) { total += x }); total`, "3"},
+		{`[[1, 2], [3]].map(fn(xs) { xs.map(fn(x) { x * 10 }) })`, "[[10, 20], [30]]"},
+		{`let fact = fn(n) { if (n < 2) { 1 } else { n * fact(n - 1) } }; [3, 4].map(fact)`, "[6, 24]"},
+		{`["a", "b"].map(upper)`, "[A, B]"},
+		{`"a-b".split(...["-"]).len()`, "2"},
+		{`let f = fn() { [1, 2].map(fn(x) { return x + 1; 0 }) }; f()`, "[2, 3]"},
+		{"1.foo()", "ERROR: 1:2: undefined method foo for INTEGER"},
+		{"[1, 2].map(fn(x) {\n  -true\n})", "ERROR: 2:3: unknown operator: -BOOLEAN"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		if evaluated.Inspect() != tt.expected {
+			t.Errorf("wrong result for %q. want=%q, got=%q", tt.input, tt.expected, evaluated.Inspect())
+		}
+	}
+}
+
+func TestLoops(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"let i = 0; while (i < 10) { i += 1 }; i", "10"},
+		{"let n = 0; for (let i = 0; i < 100000; i += 1) { n += i }; n", "4999950000"},
+		{"let n = 0; for (let i = 0; i < 10; i += 1) { if (i % 2 == 0) { continue } n += i }; n", "25"},
+		{"let i = 0; while (true) { if (i == 5) { break; } i += 1 }; i", "5"},
+		{"let i = 0; for (;;) { i += 1; if (i > 3) { break } }; i", "4"},
+		{"let f = fn() { let i = 0; while (true) { if (i == 3) { return i * 10 } i += 1 } }; f()", "30"},
+		{"let n = 0; for (let i = 0; i < 3; i += 1) { for (let j = 0; j < 3; j += 1) { if (j == i) { break } n += 1 } }; n", "3"},
+		{"while (false) { 1 }", "null"},
+		{"let i = 0; while (i < 3) { i += x }", "ERROR: 1:33: identifier not found: x"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		if evaluated.Inspect() != tt.expected {
+			t.Errorf("wrong result for %q. want=%q, got=%q", tt.input, tt.expected, evaluated.Inspect())
+		}
+	}
+}
+
+func TestForInLoops(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`let s = 0; for (x in [1, 2, 3]) { s += x }; s`, "6"},
+		{`let s = 0; for (i, x in [10, 20, 30]) { s += i * x }; s`, "80"},
+		{`let s = 0; for (i in 0..100000) { s += i }; s`, "4999950000"},
+		{`let n = 0; for (i in 5..2) { n += 1 }; n`, "0"},
+		{`let s = ""; for (c in "héllo") { s = c + s }; s`, "olléh"},
+		{`let s = ""; for (k, v in {"b": 2, "a": 1, "c": 3}) { s += k + str(v) }; s`, "a1b2c3"},
+		{`let s = 0; for (v in {"a": 1, "b": 2}) { s += v }; s`, "3"},
+		{`let s = 0; for (x in [1, 2, 3, 4, 5]) { if (x == 2) { continue } if (x == 4) { break } s += x }; s`, "4"},
+		{`let f = fn(xs) { for (x in xs) { if (x > 1) { return x } } -1 }; f([0, 1, 5, 7]) + f([])`, "4"},
+		{`let n = 0; for (i in 0..3) { for (j in 0..i) { n += 1 } }; n`, "3"},
+		{`let s = 0; for (x in [1, 2, 3]) { match (x) { 2 => { continue }, _ => 0 }; s += x }; s`, "4"},
+		{`let s = 0; for (x in [1, 2, 3]) { let a = [x]; if (x == 2) { break } else { 0 }; s += a[0] }; s`, "1"},
+		{`let n = 0; while (true) { match (n) { 3 => { break }, _ => { n += 1 } } }; n`, "3"},
+		{`let n = 0; for (x in 0..5) { try { if (x == 2) { continue } } finally { n += 1 } }; n`, "5"},
+		{`let s = 0; for (x in [1, 2]) { let f = fn(y) { if (y) { 10 } else { 1 } }; s += [x, f(x == 2)][1] }; s`, "11"},
+		{`let a = [0, if (true) { let i = 0; while (true) { i += 1; if (i == 3) { break } }; i }]; a[1]`, "3"},
+		{"0..3", "0..3"},
+		{"for (x in 5) { x }", "ERROR: 1:1: cannot iterate over INTEGER"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		if evaluated.Inspect() != tt.expected {
+			t.Errorf("wrong result for %q. want=%q, got=%q", tt.input, tt.expected, evaluated.Inspect())
+		}
+	}
+}
+
+func TestTryCatch(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`try { throw "boom" } catch (e) { e }`, "boom"},
+		{`try { 1 } catch (e) { 2 }`, "1"},
+		{`try { throw {"code": 7} } catch (e) { e["code"] }`, "7"},
+		{`try { 10 / 0 } catch (e) { e }`, "division by zero"},
+		{`try { len(1) } catch (e) { e }`, "argument to `len` not supported, got INTEGER"},
+		{`let log = []; try { throw 1 } catch (e) { append(log, e) } finally { append(log, 2) }; log`, "[1, 2]"},
+		{`let log = []; try { try { throw 1 } finally { append(log, "f") } } catch (e) { append(log, e) }; log`, "[f, 1]"},
+		{`try { try { throw 1 } catch (e) { throw e + 1 } } catch (e) { e }`, "2"},
+		{`let f = fn() { throw "deep" }; let g = fn() { f() + 1 }; try { g() } catch (e) { e }`, "deep"},
+		{`try { [1, 2].map(fn(x) { if (x == 2) { throw x } x }) } catch (e) { e * 10 }`, "20"},
+		{`let n = 0; for (i in 0..5) { try { if (i == 3) { break } } finally { n += 1 } }; n`, "4"},
+		{`let log = []; let f = fn() { try { return 1 } finally { append(log, "f") } }; f() + len(log)`, "2"},
+		{`throw "boom"`, "ERROR: 1:1: uncaught exception: boom"},
+		{"try {\n  1 / 0\n} finally { 1 }", "ERROR: 2:5: division by zero"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		if evaluated.Inspect() != tt.expected {
+			t.Errorf("wrong result for %q. want=%q, got=%q", tt.input, tt.expected, evaluated.Inspect())
+		}
+	}
+}
+
+func TestImports(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`import "lib/strings" as s; s.shout("hi")`, "HI!"},
+		{`import "lib/strings" as s; s.first + len(s.others)`, "3"},
+		{`import "lib/strings" as s; s["first"]`, "1"},
+		{`import "lib/strings" as s; s.Pair(1, 2) == s.Pair(1, 2)`, "true"},
+		{`import "lib/counter" as a; import "lib/counter" as b; a.tick(); b.tick(); a.count[0]`, "2"},
+		{`import "lib/counter" as c; c.loud`, "X!"},
+		{`import "lib/strings" as s; s.suffix`, "ERROR: 1:29: module lib/strings.monkey has no export suffix"},
+		{`import "lib/strings" as s; s.suffix()`, "ERROR: 1:29: undefined method suffix for MODULE"},
+		{`import "lib/missing" as m;`, `ERROR: 1:1: importing "lib/missing": module "lib/missing" not found`},
+		{`import "lib/cycle" as c;`, `ERROR: 1:1: importing "lib/cycle": lib/cycle.monkey:1:1: importing "cycle": import cycle: lib/cycle.monkey -> lib/cycle.monkey`},
+		{`import "lib/ping" as p;`, `ERROR: 1:1: importing "lib/ping": lib/ping.monkey:1:1: importing "pong": lib/pong.monkey:2:1: importing "ping": import cycle: lib/ping.monkey -> lib/pong.monkey -> lib/ping.monkey`},
+		{"let x = 1;\nimport \"lib/bad\" as b;", `ERROR: 2:1: importing "lib/bad": lib/bad.monkey:1:5: error[P0001]: expected next token to be IDENT, got = instead`},
+		{`import "lib/broken" as b;`, `ERROR: 1:1: importing "lib/broken": lib/broken.monkey:2:11: division by zero`},
+		{"let x = 1;\nimport \"lib/uses_broken\" as u;", `ERROR: 2:1: importing "lib/uses_broken": lib/uses_broken.monkey:2:1: importing "broken": lib/broken.monkey:2:11: division by zero`},
+	}
+
+	for _, tt := range tests {
+		program := parser.New(lexer.New(tt.input)).ParseProgram()
+		evaluated := Eval(program, NewModuleEnvironment(newTestLoader(), ""))
+		if evaluated.Inspect() != tt.expected {
+			t.Errorf("wrong result for %q. want=%q, got=%q", tt.input, tt.expected, evaluated.Inspect())
+		}
+	}
+}
+
+var testModules = map[string]string{
+	"lib/strings.monkey": `
+let suffix = "!";
+export let shout = fn(s) { upper(s) + suffix };
+export let [first, ...others] = [1, 2, 3];
+export struct Pair { left, right }
+`,
+	"lib/counter.monkey": `
+import "strings" as s;
+export let count = [0];
+export let tick = fn() { count[0] += 1 };
+export let loud = s.shout("x");
+`,
+	"lib/cycle.monkey": `import "cycle" as c;`,
+	"lib/ping.monkey":  `import "pong" as p;`,
+	"lib/pong.monkey":  "// ping and pong import each other\nimport \"ping\" as p;",
+	"lib/bad.monkey":   `let = 1;`,
+	"lib/broken.monkey": `export let x = 1;
+let y = 1 / 0;`,
+	"lib/uses_broken.monkey": `export let z = 2;
+import "broken" as b;`,
+}
+
+func newTestLoader() *module.Loader {
+	loader := module.NewLoader()
+	loader.ReadFile = func(filename string) ([]byte, error) {
+		source, ok := testModules[filename]
+		if !ok {
+			return nil, os.ErrNotExist
+		}
+		return []byte(source), nil
+	}
+	return loader
+}
+
+func TestConstants(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"const MAX = 100; let n = 0; for (i in 0..10) { n += MAX }; n", "1000"},
+		{"const xs = [1]; xs[0] = 2; xs", "[2]"},
+		{"const [a, b] = [1, 2]; a + b", "3"},
+		{"const x = 1; let f = fn() { let x = 5; x += 1; x }; f() + x", "7"},
+		{"const x = 1; x = 2", "ERROR: 1:16: cannot assign to constant x"},
+		{"const x = 1; let f = fn() { x += 1 }; f()", "ERROR: 1:31: cannot assign to constant x"},
+		{"const x = 1; let x = 2;", "ERROR: 1:14: cannot redeclare constant x"},
+		{"const [a] = [1]; a = 2", "ERROR: 1:20: cannot assign to constant a"},
+		{"const e = 1; let r = try { throw 2 } catch (e) { e }; r + e", "3"},
+		{"if (true) { const x = 1; let x = 2 }", "ERROR: 1:26: cannot redeclare constant x"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		if evaluated.Inspect() != tt.expected {
+			t.Errorf("wrong result for %q. want=%q, got=%q", tt.input, tt.expected, evaluated.Inspect())
+		}
+	}
+}
+
+func TestNullishAndOptionalChains(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"null", "null"},
+		{"null == null", "true"},
+		{"if (null) { 1 } else { 2 }", "2"},
+		{`{"a": 1}["b"] ?? 5`, "5"},
+		{"0 ?? 5", "0"},
+		{"false ?? 5", "false"},
+		{"null ?? null ?? 3", "3"},
+		{"let n = 0; let f = fn() { n += 1 }; 1 ?? f(); n", "0"},
+		{`let h = {"a": {"b": [1, 2]}}; h?.a?.b?[1]`, "2"},
+		{`let h = {}; h.x?.b.c.d`, "null"},
+		{`let h = {}; h.x?.len()`, "null"},
+		{`let h = {"s": "hey"}; h.s?.len()`, "3"},
+		{"let n = null; n?[0]", "null"},
+		{"let n = null; n?[1:2]", "null"},
+		{"[1, 2, 3]?[1:]", "[2, 3]"},
+		{"let n = 0; let f = fn() { n += 1 }; null?.m(f()); n", "0"},
+		{`let h = {"f": fn(x) { x * 2 }}; h?.f(4) + (h.g?[0] ?? 1)`, "9"},
+		{`let h = {}; [h.a?.b, 1][1]`, "1"},
+		{`let h = {}; h.a?.b ?? h.c.d`, "ERROR: 1:26: index operator not supported: NULL"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		if evaluated.Inspect() != tt.expected {
+			t.Errorf("wrong result for %q. want=%q, got=%q", tt.input, tt.expected, evaluated.Inspect())
+		}
+	}
+}
+
+func TestStructs(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"struct Point { x, y }; Point", "struct Point"},
+		{"struct Point { x, y }; Point(1, 2)", "Point{x: 1, y: 2}"},
+		{"struct Empty {}; Empty()", "Empty{}"},
+		{`struct Point { x, y }; let p = Point(1, 2); p.x + p["y"]`, "3"},
+		{"struct Point { x, y }; let p = Point(1, 2); p.x = 10; p.y += 1; p", "Point{x: 10, y: 3}"},
+		{"struct Point { x, y }; Point(1, 2) == Point(1, 2.0)", "true"},
+		{"struct Point { x, y }; Point(1, 2) != Point(2, 1)", "true"},
+		{"struct A { x }; struct B { x }; A(1) == B(1)", "false"},
+		{"struct Box { v }; Box([1]) == Box([1])", "false"},
+		{"struct Box { v }; Box(Box(null)) == Box(Box(null))", "true"},
+		{"struct Node { next }; let n = Node(null); n.next = n; n", "Node{next: Node{...}}"},
+		{"struct Node { next }; let a = Node(null); a.next = a; let b = Node(null); b.next = b; a == b", "true"},
+		{"struct Point { x, y }; map([[1, 2]], fn(a) { Point(...a) })", "[Point{x: 1, y: 2}]"},
+		{"struct Counter { n, step }; let c = Counter(1, fn(n) { n + 1 }); c.step(c.n)", "2"},
+		{"struct Point { x, y }; let p = Point(1, 2); p?.x", "1"},
+		{"if (true) { struct Inner { a } }; Inner", "ERROR: 1:35: identifier not found: Inner"},
+		{"struct Point { x, y }; Point(1, 2).z", "ERROR: 1:35: struct Point has no field z"},
+		{"struct Point { x, y }; let p = Point(1, 2); p.z = 1", "ERROR: 1:49: struct Point has no field z"},
+		{"struct Point { x, y }; let p = Point(1, 2); p[0] = 1", "ERROR: 1:50: struct field name must be a string, got INTEGER"},
+		{"struct Point { x, y }; Point(1)", "ERROR: 1:29: wrong number of arguments. want=2, got=1"},
+		{"struct Point { x, y }; Point = 1", "ERROR: 1:30: cannot assign to constant Point"},
+		{"struct Point { x, y }; Point(1, 2) < Point(1, 2)", "ERROR: 1:36: unknown operator: STRUCT < STRUCT"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		if evaluated.Inspect() != tt.expected {
+			t.Errorf("wrong result for %q. want=%q, got=%q", tt.input, tt.expected, evaluated.Inspect())
+		}
+	}
+}
+
+func TestBlockScoping(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"if (true) { let x = 1 }; x", "ERROR: 1:26: identifier not found: x"},
+		{"let x = 1; if (true) { let x = 2; x += 1 }; x", "1"},
+		{"let x = 1; if (true) { x = 2 }; x", "2"},
+		{"let x = 1; let y = if (true) { let x = x + 1; x * 10 }; x + y", "21"},
+		{"let f = fn() { if (true) { let a = 1 } else { let b = 2 }; a }; f()", "ERROR: 1:60: identifier not found: a"},
+		{"for (let i = 0; i < 3; i += 1) { }; i", "ERROR: 1:37: identifier not found: i"},
+		{"for (x in [1]) { }; x", "ERROR: 1:21: identifier not found: x"},
+		{"match (1) { n => n }; n", "ERROR: 1:23: identifier not found: n"},
+		{"try { throw 1 } catch (e) { e }; e", "ERROR: 1:34: identifier not found: e"},
+		{"let fs = []; for (x in 0..3) { fs = push(fs, fn() { x }) }; fs[0]() + fs[2]()", "2"},
+		{"let fs = []; let i = 0; while (i < 3) { let j = i; fs = push(fs, fn() { j }); i += 1 }; fs[0]() + fs[2]()", "2"},
+		{"let fs = []; for (let i = 0; i < 3; i += 1) { fs = push(fs, fn() { i }) }; fs[0]() + fs[2]()", "6"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		if evaluated.Inspect() != tt.expected {
+			t.Errorf("wrong result for %q. want=%q, got=%q", tt.input, tt.expected, evaluated.Inspect())
+		}
+	}
+}
+
+func TestMatchExpressions(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`match (2) { 1 => "one", 2 => "two", _ => "many" }`, "two"},
+		{`match (7) { 1 => "one", _ => "many" }`, "many"},
+		{`match (2.0) { 2 => "int", _ => "other" }`, "int"},
+		{`match ("b") { "a" => 1, "b" => 2 }`, "2"},
+		{`match (-1) { -1 => true, _ => false }`, "true"},
+		{`match (5) { n if n < 0 => -n, n => n * 2 }`, "10"},
+		{`match (-5) { n if n < 0 => -n, n => n * 2 }`, "5"},
+		{`match ([1, 2, 3]) { [] => 0, [h, ...t] => h + len(t) }`, "3"},
+		{`match ([]) { [] => 0, [h, ...t] => h }`, "0"},
+		{`match ([1]) { [a, b] => a + b, [a] => a * 10 }`, "10"},
+		{`match ([1, [2, 3]]) { [a, [b, c]] => a + b + c }`, "6"},
+		{`match ([1, [2]]) { [a, [b, c]] => 0, [a, [b]] => b }`, "2"},
+		{`match ([1, 2, 3]) { [_, ...rest] => rest }`, "[2, 3]"},
+		{`match ({"type": "user", "id": 7}) { {"type": "admin"} => 0, {"type": "user", "id": id} => id }`, "7"},
+		{`match ({"a": 1}) { {"a": 1, "b": _} => 1, {"a": _} => 2 }`, "2"},
+		{`match ({"p": [1, 2]}) { {"p": [x, y]} if x < y => y, _ => 0 }`, "2"},
+		{`let f = fn(v) { match (v) { [x, ...xs] => x + f(xs), [] => 0 } }; f([1, 2, 3, 4])`, "10"},
+		{`let f = fn(v) { match (v) { [a, b] => match (b) { [c] => a + c, _ => a } } }; f([1, [2]]) + f([3, 4])`, "6"},
+		{`match (3) { x => { let y = x * 2; y + 1 } }`, "7"},
+		{`match (1) { 1 => { let y = 2; } }`, "null"},
+		{`match (null) { null => 1, _ => 2 }`, "1"},
+		{`match (0) { null => 1, _ => 2 }`, "2"},
+		{`match ({"a": 1}["b"]) { null => "missing", v => v }`, "missing"},
+		{`match ([1, null]) { [_, null] => "hole", _ => "full" }`, "hole"},
+		{"let x = 3;\nmatch (x) { 1 => 1, 2 => 2 }", "ERROR: 2:1: no match arm matched 3"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		if evaluated.Inspect() != tt.expected {
+			t.Errorf("wrong result for %q. want=%q, got=%q", tt.input, tt.expected, evaluated.Inspect())
+		}
+	}
+}
+
+func TestDestructuring(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`let [a, b, ...rest] = [1, 2, 3, 4]; a + b + len(rest)`, "5"},
+		{`let [first, ...others] = [1]; others`, "[]"},
+		{`let {name, age} = {"name": "Ann", "age": 30}; name + str(age)`, "Ann30"},
+		{`let {"n": [x, y]} = {"n": [1, 2]}; x * y`, "2"},
+		{`let [_, second] = [1, 2]; second`, "2"},
+		{`let f = fn([x, y]) { x + y }; f([3, 4])`, "7"},
+		{`let f = fn(a, {b}) { a + b }; f(1, {"b": 2})`, "3"},
+		{`let f = fn() { let [a, [b, c]] = [1, [2, 3]]; a * b * c }; f()`, "6"},
+		{`let swap = fn([a, b]) { [b, a] }; swap([1, 2])`, "[2, 1]"},
+		{`let f = fn([a]) { fn() { a } }; f([9])()`, "9"},
+		{`let sum = fn(xs) { match (xs) { [] => 0, [h, ...t] => h + sum(t) } }; let [a, ...b] = [5, 6, 7]; a + sum(b)`, "18"},
+		{"let [a, b] = [1];", "ERROR: 1:5: cannot destructure [1] into [a, b]"},
+		{`let {name} = {"age": 1};`, "ERROR: 1:5: cannot destructure {age:1} into {name}"},
+		{"let f = fn(a, [x]) { x };\nf(1, 5)", "ERROR: 1:15: cannot destructure 5 into [x]"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		if evaluated.Inspect() != tt.expected {
+			t.Errorf("wrong result for %q. want=%q, got=%q", tt.input, tt.expected, evaluated.Inspect())
+		}
+	}
+}
+
+func TestFunctionParameters(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`let f = fn(a, b = 10) { a + b }; f(1)`, "11"},
+		{`let f = fn(a, b = 10) { a + b }; f(1, 2)`, "3"},
+		{`let f = fn(a, b = a * 2) { a + b }; f(3)`, "9"},
+		{`let f = fn(n = 1) { fn() { n } }; f()()`, "1"},
+		{`let f = fn([x, y] = [1, 2]) { x + y }; f()`, "3"},
+		{`let f = fn(...xs) { xs }; f()`, "[]"},
+		{`let f = fn(...xs) { xs }; f(1, 2)`, "[1, 2]"},
+		{`let f = fn(a, b = 2, ...rest) { len(rest) }; f(1, 3, 4, 5)`, "2"},
+		{`let f = fn(a, b, c) { a + b + c }; let xs = [1, 2, 3]; f(...xs)`, "6"},
+		{`let f = fn(a, ...rest) { len(rest) }; f(...[1, 2], ...[3], 4)`, "3"},
+		{`len(...["abc"])`, "3"},
+		{`let a = [1, 2]; let b = [3]; [...a, ...b, 4, ...a]`, "[1, 2, 3, 4, 1, 2]"},
+		{`let a = [1]; let b = [...a, 2]; a`, "[1]"},
+		{"let f = fn(a) { a };\nf()", "ERROR: 2:2: wrong number of arguments. want=1, got=0"},
+		{"let f = fn(a, b = 1) { a };\nf(1, 2, 3)", "ERROR: 2:2: wrong number of arguments. want=1 to 2, got=3"},
+		{"let f = fn(a, ...rest) { a };\nf()", "ERROR: 2:2: wrong number of arguments. want=at least 1, got=0"},
+		{"let a = [1];\n[0, ...a, ...2]", "ERROR: 2:11: cannot spread INTEGER"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		if evaluated.Inspect() != tt.expected {
+			t.Errorf("wrong result for %q. want=%q, got=%q", tt.input, tt.expected, evaluated.Inspect())
+		}
+	}
+}
+
 func TestFunctionApplication(t *testing.T) {
 	tests := []struct {
 		input    string
@@ -366,6 +1001,63 @@ func TestStringConcatenation(t *testing.T) {
 	}
 }
 
+func TestInterpolatedStrings(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`let name = "Bob"; "Hello ${name}!"`, "Hello Bob!"},
+		{`let items = [1, 2]; "${len(items)} items, first ${items[0]}"`, "2 items, first 1"},
+		{`"${true}${"${1 + 1}"}"`, "true2"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		str, ok := evaluated.(*object.String)
+		if !ok {
+			t.Fatalf("object is not String. got=%T (%+v)", evaluated, evaluated)
+		}
+		if str.Value != tt.expected {
+			t.Errorf("String has wrong value. want=%q, got=%q", tt.expected, str.Value)
+		}
+	}
+}
+
+func TestUnicodeStrings(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`len("héllo")`, 5},
+		{`len("日本語")`, 3},
+		{`"héllo"[1]`, "é"},
+		{`"日本語"[2]`, "語"},
+		{`let größe = "groß"; größe[3]`, "ß"},
+		{`"日本語"[3]`, nil},
+		{`"abc"[-1]`, nil},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case string:
+			str, ok := evaluated.(*object.String)
+			if !ok {
+				t.Errorf("object is not String. got=%T (%+v)", evaluated, evaluated)
+				continue
+			}
+			if str.Value != expected {
+				t.Errorf("String has wrong value. want=%q, got=%q", expected, str.Value)
+			}
+		case nil:
+			testNullObject(t, evaluated)
+		}
+	}
+}
+
 func TestBuiltinFunctions(t *testing.T) {
 	tests := []struct {
 		input    string
@@ -450,6 +1142,34 @@ func TestArrayLiterals(t *testing.T) {
 
 }
 
+func TestSliceExpressions(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`[1, 2, 3, 4][1:3]`, "[2, 3]"},
+		{`[1, 2, 3, 4][:2]`, "[1, 2]"},
+		{`[1, 2, 3, 4][2:]`, "[3, 4]"},
+		{`[1, 2, 3, 4][-3:-1]`, "[2, 3]"},
+		{`[1, 2, 3, 4][:]`, "[1, 2, 3, 4]"},
+		{`[1, 2, 3][3:1]`, "[]"},
+		{`[1, 2, 3][-10:10]`, "[1, 2, 3]"},
+		{`"hello"[1:4]`, "ell"},
+		{`"héllo"[-4:]`, "éllo"},
+		{`"abc"[5:]`, ""},
+		{`let take = fn(xs, n) { xs[:n] }; let drop = fn(xs, n) { xs[n:] }; take(drop([1, 2, 3, 4, 5], 1), 2)`, "[2, 3]"},
+		{"let n = 1;\nn[0:1]", "ERROR: 2:2: slice operator not supported: INTEGER"},
+		{`[1, 2]["a":]`, "ERROR: 1:7: slice index must be an integer, got STRING"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		if evaluated.Inspect() != tt.expected {
+			t.Errorf("wrong result for %q. want=%q, got=%q", tt.input, tt.expected, evaluated.Inspect())
+		}
+	}
+}
+
 func TestArrayIndexExpressions(t *testing.T) {
 	tests := []struct {
 		input    string
@@ -581,6 +1301,18 @@ func TestHashIndexExpressions(t *testing.T) {
 			`{false: 5}[false]`,
 			5,
 		},
+		{
+			`{1: 5}[1.0]`,
+			5,
+		},
+		{
+			`{2.0: 5}[2]`,
+			5,
+		},
+		{
+			`{1: 5}[1.5]`,
+			nil,
+		},
 	}
 
 	for _, tt := range tests {
@@ -0,0 +1,129 @@
+package evaluator
+
+import (
+	"monkey/ast"
+	"monkey/object"
+)
+
+func evalMatchExpression(me *ast.MatchExpression, env *object.Environment) object.Object {
+	subject := Eval(me.Subject, env)
+	if isError(subject) {
+		return subject
+	}
+
+	for _, arm := range me.Arms {
+		bindings := map[string]object.Object{}
+		matched, err := matchPattern(arm.Pattern, subject, bindings, env)
+		if err != nil {
+			return err
+		}
+		if !matched {
+			continue
+		}
+		armEnv := object.NewEnclosedEnvironment(env)
+		for name, value := range bindings {
+			armEnv.Set(name, value)
+		}
+
+		if arm.Guard != nil {
+			guard := Eval(arm.Guard, armEnv)
+			if isError(guard) {
+				return guard
+			}
+			if !isTruthy(guard) {
+				continue
+			}
+		}
+
+		if result := Eval(arm.Body, armEnv); result != nil {
+			return result
+		}
+		return NULL
+	}
+
+	return newError("no match arm matched %s", subject.Inspect())
+}
+
+// destructure binds the identifiers in pattern to the parts of value, as
+// constants if constant is set. It returns an error, positioned at the
+// pattern, if value does not have the pattern's shape.
+func destructure(pattern ast.Expression, value object.Object, env *object.Environment, constant bool) object.Object {
+	bindings := map[string]object.Object{}
+	matched, err := matchPattern(pattern, value, bindings, env)
+	if err != nil {
+		return err
+	}
+	if !matched {
+		err := newError("cannot destructure %s into %s", value.Inspect(), pattern.String())
+		err.Pos = pattern.Pos()
+		return err
+	}
+	for name, value := range bindings {
+		if err := env.Define(name, value, constant); err != nil {
+			return newError("%s", err)
+		}
+	}
+	return nil
+}
+
+// matchPattern reports whether value matches pattern, collecting the values
+// bound by the pattern's identifiers in bindings.
+func matchPattern(pattern ast.Expression, value object.Object, bindings map[string]object.Object, env *object.Environment) (bool, *object.Error) {
+	switch pattern := pattern.(type) {
+	case *ast.Identifier:
+		if pattern.Value != "_" {
+			bindings[pattern.Value] = value
+		}
+		return true, nil
+
+	case *ast.ArrayPattern:
+		array, ok := value.(*object.Array)
+		if !ok {
+			return false, nil
+		}
+		n := len(pattern.Elements)
+		if len(array.Elements) < n || (pattern.Rest == nil && len(array.Elements) != n) {
+			return false, nil
+		}
+		for i, element := range pattern.Elements {
+			matched, err := matchPattern(element, array.Elements[i], bindings, env)
+			if err != nil || !matched {
+				return false, err
+			}
+		}
+		if pattern.Rest != nil && pattern.Rest.Value != "_" {
+			rest := make([]object.Object, len(array.Elements)-n)
+			copy(rest, array.Elements[n:])
+			bindings[pattern.Rest.Value] = &object.Array{Elements: rest}
+		}
+		return true, nil
+
+	case *ast.HashPattern:
+		hash, ok := value.(*object.Hash)
+		if !ok {
+			return false, nil
+		}
+		for i, keyNode := range pattern.Keys {
+			key := Eval(keyNode, env)
+			if isError(key) {
+				return false, key.(*object.Error)
+			}
+			pair, ok := hash.Pairs[key.(object.Hashable).HashKey()]
+			if !ok {
+				return false, nil
+			}
+			matched, err := matchPattern(pattern.Values[i], pair.Value, bindings, env)
+			if err != nil || !matched {
+				return false, err
+			}
+		}
+		return true, nil
+
+	default:
+		literal := Eval(pattern, env)
+		if isError(literal) {
+			return false, literal.(*object.Error)
+		}
+		return evalInfixExpression("==", value, literal) == TRUE, nil
+	}
+}
@@ -0,0 +1,75 @@
+package evaluator
+
+import (
+	"monkey/ast"
+	"monkey/module"
+	"monkey/object"
+)
+
+// NewModuleEnvironment returns an environment for evaluating the file
+// filename, which imports modules through loader. filename is empty for
+// code that is not in a file.
+func NewModuleEnvironment(loader *module.Loader, filename string) *object.Environment {
+	env := object.NewEnvironment()
+	env.SetImporter(&importer{
+		loader:   loader,
+		filename: filename,
+		failed:   make(map[*object.Error]*module.ImportError),
+	})
+	return env
+}
+
+// importer evaluates each module imported by the code of one file the
+// first time it is imported.
+type importer struct {
+	loader   *module.Loader
+	filename string
+	// failed maps the error values of the file's failed imports to the
+	// failures they report, which are passed on to the importing file.
+	failed map[*object.Error]*module.ImportError
+}
+
+func (i *importer) Import(path string) (*object.Module, error) {
+	value, err := i.loader.Import(path, i.filename, i.evalModule)
+	if err != nil {
+		return nil, err
+	}
+	return value.(*object.Module), nil
+}
+
+func (i *importer) evalModule(filename string, program *ast.Program) (object.Object, error) {
+	env := NewModuleEnvironment(i.loader, filename)
+	result := Eval(program, env)
+	if err, ok := result.(*object.Error); ok {
+		if failed, ok := env.Importer().(*importer).failed[err]; ok {
+			return nil, failed
+		}
+		return nil, err
+	}
+
+	mod := &object.Module{Name: filename, Exports: make(map[string]object.Object)}
+	for _, name := range module.Exports(program) {
+		mod.Exports[name], _ = env.Get(name)
+	}
+	return mod, nil
+}
+
+func evalImportStatement(node *ast.ImportStatement, env *object.Environment) object.Object {
+	imp := env.Importer()
+	if imp == nil {
+		return newError("cannot import %q: no module loader", node.Path)
+	}
+	mod, err := imp.Import(node.Path)
+	if err != nil {
+		failed := &module.ImportError{Pos: node.Pos(), Path: node.Path, Err: err}
+		errObj := &object.Error{Message: failed.Message(), Pos: failed.Pos}
+		if i, ok := imp.(*importer); ok {
+			i.failed[errObj] = failed
+		}
+		return errObj
+	}
+	if err := env.Define(node.Name.Value, mod, false); err != nil {
+		return newError("%s", err)
+	}
+	return nil
+}
@@ -1,44 +1,94 @@
 package lexer
 
-import "monkey/token"
+import (
+	"fmt"
+	"monkey/diagnostic"
+	"monkey/token"
+	"unicode"
+	"unicode/utf8"
+)
 
 type Lexer struct {
 	input        string
+	filename     string
 	position     int  // current position in input (points to current char)
 	readPosition int  // current reading position in input (after current char)
-	ch           byte // current char under examination
+	ch           rune // current char under examination
+	line         int  // line of the current char
+	column       int  // column of the current char, counted in runes
+	diagnostics  []diagnostic.Diagnostic
+
+	// interpolations holds, for each "${" that is still open, the number of
+	// unclosed braces inside it, so the "}" that ends it can be recognized.
+	interpolations []int
 }
 
 func New(input string) *Lexer {
-	l := &Lexer{input: input}
+	return NewWithFilename("", input)
+}
+
+// NewWithFilename returns a lexer whose token positions are reported
+// relative to the given file name.
+func NewWithFilename(filename, input string) *Lexer {
+	l := &Lexer{input: input, filename: filename, line: 1}
 	l.readChar()
 	return l
 }
 
 func (l *Lexer) readChar() {
-	if l.readPosition >= len(l.input) {
-		l.ch = 0
-	} else {
-		l.ch = l.input[l.readPosition]
+	if l.readPosition > len(l.input) {
+		return // already at the end of the input
 	}
+	if l.ch == '\n' {
+		l.line++
+		l.column = 0
+	}
+	l.column++
 	l.position = l.readPosition
-	l.readPosition += 1
+	if l.readPosition == len(l.input) {
+		l.ch = 0
+		l.readPosition++
+		return
+	}
+	r, width := utf8.DecodeRuneInString(l.input[l.readPosition:])
+	l.ch = r
+	l.readPosition += width
+	if l.invalidEncoding() {
+		pos := l.currentPosition()
+		end := pos
+		end.Offset++
+		end.Column++
+		l.errorAt(pos, end, diagnostic.InvalidEncoding, "invalid UTF-8 encoding: byte %#x", l.input[l.position])
+	}
+}
+
+// invalidEncoding reports whether the current char is a byte that does not
+// start a valid UTF-8 sequence, as opposed to a literal U+FFFD.
+func (l *Lexer) invalidEncoding() bool {
+	return l.ch == utf8.RuneError && l.readPosition-l.position == 1
 }
 
 func (l *Lexer) NextToken() token.Token {
+	leading := l.readComments()
+	tok := l.readToken()
+	tok.Leading = leading
+	if tok.Type != token.EOF {
+		tok.Trailing = l.readTrailingComments()
+	}
+	return tok
+}
+
+func (l *Lexer) readToken() token.Token {
 	var tok token.Token
 
-	l.skipWhitespace()
+	pos := l.currentPosition()
 
 	switch l.ch {
 	case '=':
-		if l.peekChar() == '=' {
-			ch := l.ch
-			l.readChar()
-			literal := string(ch) + string(l.ch)
-			tok = token.Token{Type: token.EQ, Literal: literal}
+		if l.peekChar() == '>' {
+			tok = l.readOperator(token.ASSIGN, '>', token.ARROW)
 		} else {
-			tok = newToken(token.ASSIGN, l.ch)
+			tok = l.readOperator(token.ASSIGN, '=', token.EQ)
 		}
 	case ';':
 		tok = newToken(token.SEMICOLON, l.ch)
@@ -49,9 +99,9 @@ func (l *Lexer) NextToken() token.Token {
 	case ',':
 		tok = newToken(token.COMMA, l.ch)
 	case '+':
-		tok = newToken(token.PLUS, l.ch)
+		tok = l.readOperator(token.PLUS, '=', token.PLUS_ASSIGN)
 	case '-':
-		tok = newToken(token.MINUS, l.ch)
+		tok = l.readOperator(token.MINUS, '=', token.MINUS_ASSIGN)
 	case '!':
 		if l.peekChar() == '=' {
 			ch := l.ch
@@ -61,27 +111,99 @@ func (l *Lexer) NextToken() token.Token {
 		} else {
 			tok = newToken(token.BANG, l.ch)
 		}
+	case '&':
+		tok = l.readOperator(token.AMPERSAND, '&', token.AND)
+	case '|':
+		tok = l.readOperator(token.PIPE, '|', token.OR)
+	case '?':
+		switch l.peekChar() {
+		case '?':
+			tok = l.readOperator(token.ILLEGAL, '?', token.NULLISH)
+		case '.':
+			tok = l.readOperator(token.ILLEGAL, '.', token.QUESTION_DOT)
+		case '[':
+			tok = l.readOperator(token.ILLEGAL, '[', token.QUESTION_BRACKET)
+		default:
+			return l.readIllegal()
+		}
+	case '^':
+		tok = newToken(token.CARET, l.ch)
+	case '~':
+		tok = newToken(token.TILDE, l.ch)
+	case '%':
+		tok = newToken(token.PERCENT, l.ch)
 	case '/':
-		tok = newToken(token.SLASH, l.ch)
+		tok = l.readOperator(token.SLASH, '=', token.SLASH_ASSIGN)
 	case '*':
-		tok = newToken(token.ASTERISK, l.ch)
+		if l.peekChar() == '=' {
+			tok = l.readOperator(token.ASTERISK, '=', token.ASTERISK_ASSIGN)
+		} else {
+			tok = l.readOperator(token.ASTERISK, '*', token.POWER)
+		}
 	case '<':
-		tok = newToken(token.LT, l.ch)
+		if l.peekChar() == '=' {
+			tok = l.readOperator(token.LT, '=', token.LT_EQ)
+		} else {
+			tok = l.readOperator(token.LT, '<', token.SHL)
+		}
 	case '>':
-		tok = newToken(token.GT, l.ch)
+		if l.peekChar() == '=' {
+			tok = l.readOperator(token.GT, '=', token.GT_EQ)
+		} else {
+			tok = l.readOperator(token.GT, '>', token.SHR)
+		}
 	case '{':
 		tok = newToken(token.LBRACE, l.ch)
+		if n := len(l.interpolations); n > 0 {
+			l.interpolations[n-1]++
+		}
 	case '}':
+		if n := len(l.interpolations); n > 0 && l.interpolations[n-1] == 0 {
+			l.interpolations = l.interpolations[:n-1]
+			l.readChar()
+			literal, more := l.readStringPart(pos)
+			tok = token.Token{Type: token.INTERP_END, Literal: literal}
+			if more {
+				tok.Type = token.INTERP_MID
+			}
+			break
+		}
 		tok = newToken(token.RBRACE, l.ch)
+		if n := len(l.interpolations); n > 0 {
+			l.interpolations[n-1]--
+		}
 	case '[':
 		tok = newToken(token.LBRACKET, l.ch)
 	case ']':
 		tok = newToken(token.RBRACKET, l.ch)
 	case ':':
 		tok = newToken(token.COLON, l.ch)
+	case '.':
+		if l.peekChar() != '.' {
+			tok = newToken(token.DOT, l.ch)
+			break
+		}
+		l.readChar()
+		tok = token.Token{Type: token.DOTDOT, Literal: ".."}
+		if l.peekChar() == '.' {
+			l.readChar()
+			tok = token.Token{Type: token.ELLIPSIS, Literal: "..."}
+		}
 	case '"':
-		tok = newToken(token.STRING, l.ch)
-		tok.Literal = l.readString()
+		tok.Type = token.STRING
+		if l.peekChar() == '"' && l.peekCharN(2) == '"' {
+			tok.Literal = l.readHeredoc()
+		} else {
+			l.readChar()
+			literal, more := l.readStringPart(pos)
+			tok.Literal = literal
+			if more {
+				tok.Type = token.INTERP_START
+			}
+		}
+	case '`':
+		tok.Type = token.STRING
+		tok.Literal = l.readRawString()
 	case 0:
 		tok.Literal = ""
 		tok.Type = token.EOF
@@ -89,52 +211,157 @@ func (l *Lexer) NextToken() token.Token {
 		if isLetter(l.ch) {
 			tok.Literal = l.readIdentifier()
 			tok.Type = token.LookupIdent(tok.Literal)
+			tok.Pos, tok.End = pos, l.currentPosition()
 			return tok
 		} else if isDigit(l.ch) {
-			tok.Type = token.INT
-			tok.Literal = l.readNumber()
+			tok.Type, tok.Literal = l.readNumber()
+			tok.Pos, tok.End = pos, l.currentPosition()
 			return tok
 		} else {
-			tok = newToken(token.ILLEGAL, l.ch)
+			return l.readIllegal()
 		}
 	}
 	l.readChar()
+	tok.Pos, tok.End = pos, l.currentPosition()
 	return tok
 }
 
-func (l *Lexer) readString() string {
-	position := l.position + 1
-	for {
-		l.readChar()
-		if l.ch == '"' || l.ch == 0 {
-			break
-		}
+// readOperator returns a two-char token of type long if the next char is
+// next, and a one-char token of type short otherwise.
+func (l *Lexer) readOperator(short token.TokenType, next rune, long token.TokenType) token.Token {
+	if l.peekChar() != next {
+		return newToken(short, l.ch)
 	}
-	return l.input[position:l.position]
+	literal := string(l.ch)
+	l.readChar()
+	return token.Token{Type: long, Literal: literal + string(l.ch)}
+}
+
+func (l *Lexer) readIllegal() token.Token {
+	pos := l.currentPosition()
+	tok := newToken(token.ILLEGAL, l.ch)
+	invalid := l.invalidEncoding()
+	if invalid {
+		tok.Literal = l.input[l.position:l.readPosition]
+	}
+	l.readChar()
+	tok.Pos, tok.End = pos, l.currentPosition()
+	if !invalid {
+		l.errorAt(tok.Pos, tok.End, diagnostic.IllegalCharacter, "illegal character %q", tok.Literal)
+	}
+	return tok
+}
+
+// Diagnostics returns the problems found in the input so far.
+func (l *Lexer) Diagnostics() []diagnostic.Diagnostic {
+	return l.diagnostics
+}
+
+func (l *Lexer) errorAt(start, end token.Position, code diagnostic.Code, format string, a ...interface{}) {
+	l.diagnostics = append(l.diagnostics, diagnostic.Diagnostic{
+		Severity: diagnostic.Error,
+		Code:     code,
+		Message:  fmt.Sprintf(format, a...),
+		Start:    start,
+		End:      end,
+	})
 }
 
-func (l *Lexer) peekChar() byte {
+func (l *Lexer) currentPosition() token.Position {
+	return token.Position{
+		Filename: l.filename,
+		Offset:   l.position,
+		Line:     l.line,
+		Column:   l.column,
+	}
+}
+
+func (l *Lexer) peekChar() rune {
 	if l.readPosition >= len(l.input) {
 		return 0
-	} else {
-		return l.input[l.readPosition]
 	}
+	r, _ := utf8.DecodeRuneInString(l.input[l.readPosition:])
+	return r
+}
+
+// peekCharN returns the char n positions after the current one.
+func (l *Lexer) peekCharN(n int) rune {
+	offset := l.readPosition
+	for i := 1; i < n && offset < len(l.input); i++ {
+		_, width := utf8.DecodeRuneInString(l.input[offset:])
+		offset += width
+	}
+	if offset >= len(l.input) {
+		return 0
+	}
+	r, _ := utf8.DecodeRuneInString(l.input[offset:])
+	return r
 }
 
 func (l *Lexer) readIdentifier() string {
 	position := l.position
-	for isLetter(l.ch) {
+	for isLetter(l.ch) || unicode.IsDigit(l.ch) {
 		l.readChar()
 	}
 	return l.input[position:l.position]
 }
 
-func (l *Lexer) readNumber() string {
-	position := l.position
-	for isDigit(l.ch) {
+// readComments skips whitespace and returns the comments found in between.
+func (l *Lexer) readComments() []token.Comment {
+	var comments []token.Comment
+	for {
+		l.skipWhitespace()
+		if !l.atComment() {
+			return comments
+		}
+		comments = append(comments, l.readComment())
+	}
+}
+
+// readTrailingComments returns the comments that follow the current token
+// on the same line. The newline itself is left for readComments.
+func (l *Lexer) readTrailingComments() []token.Comment {
+	var comments []token.Comment
+	for {
+		for l.ch == ' ' || l.ch == '\t' || l.ch == '\r' {
+			l.readChar()
+		}
+		if !l.atComment() {
+			return comments
+		}
+		comment := l.readComment()
+		comments = append(comments, comment)
+		if comment.Text[1] == '/' {
+			return comments
+		}
+	}
+}
+
+func (l *Lexer) atComment() bool {
+	return l.ch == '/' && (l.peekChar() == '/' || l.peekChar() == '*')
+}
+
+func (l *Lexer) readComment() token.Comment {
+	pos := l.currentPosition()
+	if l.peekChar() == '/' {
+		for l.ch != '\n' && l.ch != 0 {
+			l.readChar()
+		}
+	} else {
+		l.readChar()
+		l.readChar()
+		for !(l.ch == '*' && l.peekChar() == '/') {
+			if l.ch == 0 {
+				comment := token.Comment{Text: l.input[pos.Offset:l.position], Pos: pos, End: l.currentPosition()}
+				l.errorAt(comment.Pos, comment.End, diagnostic.UnterminatedComment, "block comment is not terminated")
+				return comment
+			}
+			l.readChar()
+		}
+		l.readChar()
 		l.readChar()
 	}
-	return l.input[position:l.position]
+	return token.Comment{Text: l.input[pos.Offset:l.position], Pos: pos, End: l.currentPosition()}
 }
 
 func (l *Lexer) skipWhitespace() {
@@ -143,14 +370,16 @@ func (l *Lexer) skipWhitespace() {
 	}
 }
 
-func isDigit(ch byte) bool {
+func isDigit(ch rune) bool {
 	return '0' <= ch && ch <= '9'
 }
 
-func isLetter(ch byte) bool {
-	return 'a' <= ch && ch <= 'z' || 'A' <= ch && ch <= 'Z' || ch == '_'
+// isLetter reports whether ch may start an identifier: any Unicode letter or
+// an underscore. Identifiers may also contain digits after the first char.
+func isLetter(ch rune) bool {
+	return ch == '_' || unicode.IsLetter(ch)
 }
 
-func newToken(tokenType token.TokenType, ch byte) token.Token {
+func newToken(tokenType token.TokenType, ch rune) token.Token {
 	return token.Token{Type: tokenType, Literal: string(ch)}
 }
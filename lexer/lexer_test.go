@@ -3,6 +3,7 @@ package lexer
 import (
 	"testing"
 
+	"monkey/diagnostic"
 	"monkey/token"
 )
 
@@ -15,7 +16,7 @@ let add = fn(x, y) {
 };
 
 let result = add(five, ten);
-!-/*5;
+!-/ *5;
 5 < 10 > 5;
 
 if (5 < 10) {
@@ -155,3 +156,550 @@ macro(x, y) { x + y; };
 		}
 	}
 }
+
+func TestTokenPositions(t *testing.T) {
+	input := "let x = 5;\n  x + 10;"
+
+	tests := []struct {
+		expectedType   token.TokenType
+		expectedLine   int
+		expectedColumn int
+		expectedOffset int
+	}{
+		{token.LET, 1, 1, 0},
+		{token.IDENT, 1, 5, 4},
+		{token.ASSIGN, 1, 7, 6},
+		{token.INT, 1, 9, 8},
+		{token.SEMICOLON, 1, 10, 9},
+		{token.IDENT, 2, 3, 13},
+		{token.PLUS, 2, 5, 15},
+		{token.INT, 2, 7, 17},
+		{token.SEMICOLON, 2, 9, 19},
+		{token.EOF, 2, 10, 20},
+	}
+
+	l := NewWithFilename("main.monkey", input)
+
+	for i, tt := range tests {
+		tok := l.NextToken()
+
+		if tok.Type != tt.expectedType {
+			t.Fatalf("tests[%d] - tokentype wrong. expected=%q, got=%q",
+				i, tt.expectedType, tok.Type)
+		}
+		if tok.Pos.Line != tt.expectedLine || tok.Pos.Column != tt.expectedColumn {
+			t.Fatalf("tests[%d] - position wrong. expected=%d:%d, got=%d:%d",
+				i, tt.expectedLine, tt.expectedColumn, tok.Pos.Line, tok.Pos.Column)
+		}
+		if tok.Pos.Offset != tt.expectedOffset {
+			t.Fatalf("tests[%d] - offset wrong. expected=%d, got=%d",
+				i, tt.expectedOffset, tok.Pos.Offset)
+		}
+		if tok.Pos.Filename != "main.monkey" {
+			t.Fatalf("tests[%d] - filename wrong. got=%q", i, tok.Pos.Filename)
+		}
+	}
+}
+
+func TestComments(t *testing.T) {
+	input := `// leading
+/* block
+   comment */ let x = 5; // trailing
+x / 2 /* inline */ * 3;
+// dangling`
+
+	l := New(input)
+
+	let := l.NextToken()
+	if let.Type != token.LET {
+		t.Fatalf("first token wrong. got=%q", let.Type)
+	}
+	if len(let.Leading) != 2 {
+		t.Fatalf("let has wrong number of leading comments. got=%d", len(let.Leading))
+	}
+	if let.Leading[0].Text != "// leading" {
+		t.Errorf("leading[0] wrong. got=%q", let.Leading[0].Text)
+	}
+	if let.Leading[1].Text != "/* block\n   comment */" {
+		t.Errorf("leading[1] wrong. got=%q", let.Leading[1].Text)
+	}
+	if let.Leading[1].Pos.Line != 2 || let.Leading[1].End.Line != 3 {
+		t.Errorf("leading[1] has wrong span. got=%s-%s", let.Leading[1].Pos, let.Leading[1].End)
+	}
+	if let.Pos.Line != 3 || let.Pos.Column != 15 {
+		t.Errorf("let has wrong position. got=%s", let.Pos)
+	}
+
+	var semicolon token.Token
+	for i := 0; i < 4; i++ {
+		semicolon = l.NextToken()
+	}
+	if semicolon.Type != token.SEMICOLON {
+		t.Fatalf("expected SEMICOLON, got=%q", semicolon.Type)
+	}
+	if len(semicolon.Trailing) != 1 || semicolon.Trailing[0].Text != "// trailing" {
+		t.Errorf("semicolon has wrong trailing comments. got=%+v", semicolon.Trailing)
+	}
+
+	expected := []token.TokenType{token.IDENT, token.SLASH, token.INT, token.ASTERISK, token.INT, token.SEMICOLON}
+	var tok token.Token
+	for i, tt := range expected {
+		tok = l.NextToken()
+		if tok.Type != tt {
+			t.Fatalf("tokens[%d] wrong. expected=%q, got=%q", i, tt, tok.Type)
+		}
+		if i == 2 && (len(tok.Trailing) != 1 || tok.Trailing[0].Text != "/* inline */") {
+			t.Errorf("INT has wrong trailing comments. got=%+v", tok.Trailing)
+		}
+	}
+
+	eof := l.NextToken()
+	if eof.Type != token.EOF {
+		t.Fatalf("expected EOF, got=%q", eof.Type)
+	}
+	if len(eof.Leading) != 1 || eof.Leading[0].Text != "// dangling" {
+		t.Errorf("EOF has wrong leading comments. got=%+v", eof.Leading)
+	}
+	if len(l.Diagnostics()) != 0 {
+		t.Errorf("unexpected diagnostics: %v", l.Diagnostics())
+	}
+}
+
+func TestUnterminatedBlockComment(t *testing.T) {
+	l := New("let x = 1; /* never closed")
+
+	for tok := l.NextToken(); tok.Type != token.EOF; tok = l.NextToken() {
+	}
+
+	diagnostics := l.Diagnostics()
+	if len(diagnostics) != 1 {
+		t.Fatalf("wrong number of diagnostics. want=1, got=%d", len(diagnostics))
+	}
+	if diagnostics[0].Code != diagnostic.UnterminatedComment {
+		t.Errorf("wrong diagnostic code. got=%s", diagnostics[0].Code)
+	}
+	if diagnostics[0].Start.Column != 12 {
+		t.Errorf("wrong diagnostic position. got=%s", diagnostics[0].Start)
+	}
+}
+
+func TestUnicodeInput(t *testing.T) {
+	input := `let größe = "日本語"; π2 + größe`
+
+	tests := []struct {
+		expectedType    token.TokenType
+		expectedLiteral string
+		expectedColumn  int
+	}{
+		{token.LET, "let", 1},
+		{token.IDENT, "größe", 5},
+		{token.ASSIGN, "=", 11},
+		{token.STRING, "日本語", 13},
+		{token.SEMICOLON, ";", 18},
+		{token.IDENT, "π2", 20},
+		{token.PLUS, "+", 23},
+		{token.IDENT, "größe", 25},
+		{token.EOF, "", 30},
+	}
+
+	l := New(input)
+
+	for i, tt := range tests {
+		tok := l.NextToken()
+
+		if tok.Type != tt.expectedType {
+			t.Fatalf("tests[%d] - tokentype wrong. expected=%q, got=%q",
+				i, tt.expectedType, tok.Type)
+		}
+		if tok.Literal != tt.expectedLiteral {
+			t.Fatalf("tests[%d] - literal wrong. expected=%q, got=%q",
+				i, tt.expectedLiteral, tok.Literal)
+		}
+		if tok.Pos.Column != tt.expectedColumn {
+			t.Fatalf("tests[%d] - column wrong. expected=%d, got=%d",
+				i, tt.expectedColumn, tok.Pos.Column)
+		}
+	}
+}
+
+func TestInvalidEncoding(t *testing.T) {
+	l := New("let x = \xff;")
+
+	expected := []token.TokenType{token.LET, token.IDENT, token.ASSIGN, token.ILLEGAL, token.SEMICOLON, token.EOF}
+	for i, tt := range expected {
+		tok := l.NextToken()
+		if tok.Type != tt {
+			t.Fatalf("tokens[%d] - tokentype wrong. expected=%q, got=%q", i, tt, tok.Type)
+		}
+	}
+
+	diagnostics := l.Diagnostics()
+	if len(diagnostics) != 1 {
+		t.Fatalf("wrong number of diagnostics. want=1, got=%d (%v)", len(diagnostics), diagnostics)
+	}
+	if diagnostics[0].Code != diagnostic.InvalidEncoding {
+		t.Errorf("wrong diagnostic code. got=%s", diagnostics[0].Code)
+	}
+	if diagnostics[0].Start.Offset != 8 || diagnostics[0].Start.Column != 9 {
+		t.Errorf("wrong diagnostic position. got=%+v", diagnostics[0].Start)
+	}
+}
+
+func TestStringLiterals(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`"a\nb\tc"`, "a\nb\tc"},
+		{`"say \"hi\" \\ bye"`, `say "hi" \ bye`},
+		{`"\u{48}\u{e9}\u{1F600}"`, "Hé😀"},
+		{"`raw \\n ${x}\nline`", "raw \\n ${x}\nline"},
+		{"\"\"\"\n    first\n      second\\t!\n    \"\"\"", "first\n  second\t!"},
+		{`"""inline"""`, "inline"},
+	}
+
+	for i, tt := range tests {
+		l := New(tt.input)
+		tok := l.NextToken()
+		if tok.Type != token.STRING {
+			t.Fatalf("tests[%d] - tokentype wrong. expected=%q, got=%q", i, token.STRING, tok.Type)
+		}
+		if tok.Literal != tt.expected {
+			t.Errorf("tests[%d] - literal wrong. expected=%q, got=%q", i, tt.expected, tok.Literal)
+		}
+		if next := l.NextToken(); next.Type != token.EOF {
+			t.Errorf("tests[%d] - expected EOF after string, got=%q", i, next.Type)
+		}
+		if len(l.Diagnostics()) != 0 {
+			t.Errorf("tests[%d] - unexpected diagnostics: %v", i, l.Diagnostics())
+		}
+	}
+}
+
+func TestStringLiteralErrors(t *testing.T) {
+	tests := []struct {
+		input        string
+		expectedCode diagnostic.Code
+		expectedPos  string
+	}{
+		{"let s = \"abc\nlet t = 1;", diagnostic.UnterminatedString, "1:9"},
+		{"`abc", diagnostic.UnterminatedString, "1:1"},
+		{"\"\"\"\nabc", diagnostic.UnterminatedString, "1:1"},
+		{`"a\qb"`, diagnostic.InvalidEscape, "1:3"},
+		{`"\u{110000}"`, diagnostic.InvalidEscape, "1:2"},
+		{"\"\"\"\n  x\n  \\z\n  \"\"\"", diagnostic.InvalidEscape, "3:3"},
+	}
+
+	for i, tt := range tests {
+		l := New(tt.input)
+		for tok := l.NextToken(); tok.Type != token.EOF; tok = l.NextToken() {
+		}
+		diagnostics := l.Diagnostics()
+		if len(diagnostics) != 1 {
+			t.Fatalf("tests[%d] - wrong number of diagnostics. want=1, got=%d (%v)", i, len(diagnostics), diagnostics)
+		}
+		if diagnostics[0].Code != tt.expectedCode {
+			t.Errorf("tests[%d] - wrong diagnostic code. want=%s, got=%s", i, tt.expectedCode, diagnostics[0].Code)
+		}
+		if diagnostics[0].Start.String() != tt.expectedPos {
+			t.Errorf("tests[%d] - wrong diagnostic position. want=%s, got=%s", i, tt.expectedPos, diagnostics[0].Start)
+		}
+	}
+}
+
+func TestUnterminatedStringKeepsLexing(t *testing.T) {
+	l := New("let s = \"abc\nlet t = 1;")
+
+	expected := []token.TokenType{token.LET, token.IDENT, token.ASSIGN, token.STRING,
+		token.LET, token.IDENT, token.ASSIGN, token.INT, token.SEMICOLON, token.EOF}
+	for i, tt := range expected {
+		tok := l.NextToken()
+		if tok.Type != tt {
+			t.Fatalf("tokens[%d] - tokentype wrong. expected=%q, got=%q", i, tt, tok.Type)
+		}
+	}
+}
+
+func TestInterpolatedStrings(t *testing.T) {
+	input := `"Hello ${name}, ${ {"a": "x${1}"}["a"] }!" "\${no}"`
+
+	tests := []struct {
+		expectedType    token.TokenType
+		expectedLiteral string
+	}{
+		{token.INTERP_START, "Hello "},
+		{token.IDENT, "name"},
+		{token.INTERP_MID, ", "},
+		{token.LBRACE, "{"},
+		{token.STRING, "a"},
+		{token.COLON, ":"},
+		{token.INTERP_START, "x"},
+		{token.INT, "1"},
+		{token.INTERP_END, ""},
+		{token.RBRACE, "}"},
+		{token.LBRACKET, "["},
+		{token.STRING, "a"},
+		{token.RBRACKET, "]"},
+		{token.INTERP_END, "!"},
+		{token.STRING, "${no}"},
+		{token.EOF, ""},
+	}
+
+	l := New(input)
+	for i, tt := range tests {
+		tok := l.NextToken()
+		if tok.Type != tt.expectedType {
+			t.Fatalf("tests[%d] - tokentype wrong. expected=%q, got=%q", i, tt.expectedType, tok.Type)
+		}
+		if tok.Literal != tt.expectedLiteral {
+			t.Fatalf("tests[%d] - literal wrong. expected=%q, got=%q", i, tt.expectedLiteral, tok.Literal)
+		}
+	}
+}
+
+func TestNumberLiterals(t *testing.T) {
+	input := `1 1.5 0.25 1e10 2.5E-3 6e+2 1. 3.x 4e`
+
+	tests := []struct {
+		expectedType    token.TokenType
+		expectedLiteral string
+	}{
+		{token.INT, "1"},
+		{token.FLOAT, "1.5"},
+		{token.FLOAT, "0.25"},
+		{token.FLOAT, "1e10"},
+		{token.FLOAT, "2.5E-3"},
+		{token.FLOAT, "6e+2"},
+		{token.INT, "1"},
+		{token.DOT, "."},
+		{token.INT, "3"},
+		{token.DOT, "."},
+		{token.IDENT, "x"},
+		{token.INT, "4"},
+		{token.IDENT, "e"},
+		{token.EOF, ""},
+	}
+
+	l := New(input)
+	for i, tt := range tests {
+		tok := l.NextToken()
+		if tok.Type != tt.expectedType {
+			t.Fatalf("tests[%d] - tokentype wrong. expected=%q, got=%q", i, tt.expectedType, tok.Type)
+		}
+		if tok.Literal != tt.expectedLiteral {
+			t.Fatalf("tests[%d] - literal wrong. expected=%q, got=%q", i, tt.expectedLiteral, tok.Literal)
+		}
+	}
+}
+
+func TestRadixLiterals(t *testing.T) {
+	input := `0xFF 0o755 0b1010 1_000_000 0x_dead_BEEF 1_0.5e1_0 0755`
+
+	expected := []string{"0xFF", "0o755", "0b1010", "1_000_000", "0x_dead_BEEF", "1_0.5e1_0", "0755"}
+	l := New(input)
+	for i, literal := range expected {
+		tok := l.NextToken()
+		if tok.Type != token.INT && tok.Type != token.FLOAT {
+			t.Fatalf("tests[%d] - tokentype wrong. got=%q", i, tok.Type)
+		}
+		if tok.Literal != literal {
+			t.Fatalf("tests[%d] - literal wrong. expected=%q, got=%q", i, literal, tok.Literal)
+		}
+	}
+	if len(l.Diagnostics()) != 0 {
+		t.Errorf("unexpected diagnostics: %v", l.Diagnostics())
+	}
+}
+
+func TestInvalidNumberLiterals(t *testing.T) {
+	tests := []struct {
+		input           string
+		expectedMessage string
+	}{
+		{"0x", "hexadecimal literal has no digits"},
+		{"0b102", "invalid digit '2' in binary literal"},
+		{"0o8", "invalid digit '8' in octal literal"},
+		{"0xFG", "invalid digit 'G' in hexadecimal literal"},
+		{"1__000", "'_' must separate successive digits"},
+		{"1000_", "'_' must separate successive digits"},
+		{"0b1_", "'_' must separate successive digits"},
+		{"1_.5", "'_' must separate successive digits"},
+	}
+
+	for i, tt := range tests {
+		l := New("let x = " + tt.input + ";")
+		var illegal token.Token
+		for tok := l.NextToken(); tok.Type != token.EOF; tok = l.NextToken() {
+			if tok.Type == token.ILLEGAL {
+				illegal = tok
+			}
+		}
+		if illegal.Literal != tt.input {
+			t.Errorf("tests[%d] - wrong ILLEGAL token. want=%q, got=%q", i, tt.input, illegal.Literal)
+		}
+		diagnostics := l.Diagnostics()
+		if len(diagnostics) != 1 {
+			t.Fatalf("tests[%d] - wrong number of diagnostics. want=1, got=%d (%v)", i, len(diagnostics), diagnostics)
+		}
+		d := diagnostics[0]
+		if d.Code != diagnostic.InvalidNumber || d.Message != tt.expectedMessage {
+			t.Errorf("tests[%d] - wrong diagnostic. want=%s %q, got=%s %q", i, diagnostic.InvalidNumber, tt.expectedMessage, d.Code, d.Message)
+		}
+		if d.Start.Column != 9 || d.End.Column != 9+len(tt.input) {
+			t.Errorf("tests[%d] - wrong diagnostic span. got=%s-%s", i, d.Start, d.End)
+		}
+	}
+}
+
+func TestLogicalOperatorTokens(t *testing.T) {
+	input := `a && b || c`
+
+	expected := []token.TokenType{token.IDENT, token.AND, token.IDENT, token.OR, token.IDENT, token.EOF}
+	l := New(input)
+	for i, tt := range expected {
+		tok := l.NextToken()
+		if tok.Type != tt {
+			t.Fatalf("tokens[%d] - tokentype wrong. expected=%q, got=%q", i, tt, tok.Type)
+		}
+	}
+}
+
+func TestOperatorTokens(t *testing.T) {
+	input := `<= >= < > % ** * & | ^ ~ << >> && ||`
+
+	expected := []token.TokenType{
+		token.LT_EQ, token.GT_EQ, token.LT, token.GT, token.PERCENT, token.POWER, token.ASTERISK,
+		token.AMPERSAND, token.PIPE, token.CARET, token.TILDE, token.SHL, token.SHR, token.AND, token.OR,
+		token.EOF,
+	}
+	l := New(input)
+	for i, tt := range expected {
+		tok := l.NextToken()
+		if tok.Type != tt {
+			t.Fatalf("tokens[%d] - tokentype wrong. expected=%q, got=%q", i, tt, tok.Type)
+		}
+		if tt != token.EOF && tok.Literal != string(tt) {
+			t.Fatalf("tokens[%d] - literal wrong. expected=%q, got=%q", i, tt, tok.Literal)
+		}
+	}
+}
+
+func TestAssignmentTokens(t *testing.T) {
+	input := `x = 1; x += 2; x -= 3; x *= 4; x /= 5; x ** 2 == x`
+
+	expected := []token.TokenType{
+		token.IDENT, token.ASSIGN, token.INT, token.SEMICOLON,
+		token.IDENT, token.PLUS_ASSIGN, token.INT, token.SEMICOLON,
+		token.IDENT, token.MINUS_ASSIGN, token.INT, token.SEMICOLON,
+		token.IDENT, token.ASTERISK_ASSIGN, token.INT, token.SEMICOLON,
+		token.IDENT, token.SLASH_ASSIGN, token.INT, token.SEMICOLON,
+		token.IDENT, token.POWER, token.INT, token.EQ, token.IDENT,
+		token.EOF,
+	}
+	l := New(input)
+	for i, tt := range expected {
+		tok := l.NextToken()
+		if tok.Type != tt {
+			t.Fatalf("tokens[%d] - tokentype wrong. expected=%q, got=%q", i, tt, tok.Type)
+		}
+	}
+}
+
+func TestLoopKeywords(t *testing.T) {
+	input := `while (x) { break; } for (;;) { continue; }`
+
+	expected := []token.TokenType{
+		token.WHILE, token.LPAREN, token.IDENT, token.RPAREN,
+		token.LBRACE, token.BREAK, token.SEMICOLON, token.RBRACE,
+		token.FOR, token.LPAREN, token.SEMICOLON, token.SEMICOLON, token.RPAREN,
+		token.LBRACE, token.CONTINUE, token.SEMICOLON, token.RBRACE,
+		token.EOF,
+	}
+	l := New(input)
+	for i, tt := range expected {
+		tok := l.NextToken()
+		if tok.Type != tt {
+			t.Fatalf("tokens[%d] - tokentype wrong. expected=%q, got=%q", i, tt, tok.Type)
+		}
+	}
+}
+
+func TestRangeAndInTokens(t *testing.T) {
+	input := `for (k, v in 0..10) {} 1.5..2`
+
+	expected := []struct {
+		expectedType    token.TokenType
+		expectedLiteral string
+	}{
+		{token.FOR, "for"},
+		{token.LPAREN, "("},
+		{token.IDENT, "k"},
+		{token.COMMA, ","},
+		{token.IDENT, "v"},
+		{token.IN, "in"},
+		{token.INT, "0"},
+		{token.DOTDOT, ".."},
+		{token.INT, "10"},
+		{token.RPAREN, ")"},
+		{token.LBRACE, "{"},
+		{token.RBRACE, "}"},
+		{token.FLOAT, "1.5"},
+		{token.DOTDOT, ".."},
+		{token.INT, "2"},
+		{token.EOF, ""},
+	}
+	l := New(input)
+	for i, tt := range expected {
+		tok := l.NextToken()
+		if tok.Type != tt.expectedType || tok.Literal != tt.expectedLiteral {
+			t.Fatalf("tests[%d] - wrong token. expected=%q %q, got=%q %q", i, tt.expectedType, tt.expectedLiteral, tok.Type, tok.Literal)
+		}
+	}
+}
+
+func TestNullTokens(t *testing.T) {
+	input := `null ?? a?.b?[0] ? x`
+
+	expected := []struct {
+		expectedType    token.TokenType
+		expectedLiteral string
+	}{
+		{token.NULL, "null"},
+		{token.NULLISH, "??"},
+		{token.IDENT, "a"},
+		{token.QUESTION_DOT, "?."},
+		{token.IDENT, "b"},
+		{token.QUESTION_BRACKET, "?["},
+		{token.INT, "0"},
+		{token.RBRACKET, "]"},
+		{token.ILLEGAL, "?"},
+		{token.IDENT, "x"},
+		{token.EOF, ""},
+	}
+	l := New(input)
+	for i, tt := range expected {
+		tok := l.NextToken()
+		if tok.Type != tt.expectedType || tok.Literal != tt.expectedLiteral {
+			t.Fatalf("tests[%d] - wrong token. expected=%q %q, got=%q %q", i, tt.expectedType, tt.expectedLiteral, tok.Type, tok.Literal)
+		}
+	}
+}
+
+func TestMatchTokens(t *testing.T) {
+	input := `match (x) { [h, ...t] if h >= 0 => h, _ => 0 }`
+
+	expected := []token.TokenType{
+		token.MATCH, token.LPAREN, token.IDENT, token.RPAREN, token.LBRACE,
+		token.LBRACKET, token.IDENT, token.COMMA, token.ELLIPSIS, token.IDENT, token.RBRACKET,
+		token.IF, token.IDENT, token.GT_EQ, token.INT, token.ARROW, token.IDENT, token.COMMA,
+		token.IDENT, token.ARROW, token.INT, token.RBRACE,
+		token.EOF,
+	}
+	l := New(input)
+	for i, tt := range expected {
+		tok := l.NextToken()
+		if tok.Type != tt {
+			t.Fatalf("tokens[%d] - tokentype wrong. expected=%q, got=%q", i, tt, tok.Type)
+		}
+	}
+}
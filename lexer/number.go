@@ -0,0 +1,128 @@
+package lexer
+
+import (
+	"monkey/diagnostic"
+	"monkey/token"
+	"strings"
+)
+
+// readNumber reads an integer or a float literal. Integers may carry a 0x,
+// 0o or 0b prefix; a float has a fraction, an exponent or both, and its '.'
+// must be followed by a digit. Digits may be separated by underscores.
+// A malformed literal is reported and returned as an ILLEGAL token.
+func (l *Lexer) readNumber() (token.TokenType, string) {
+	start := l.currentPosition()
+
+	if l.ch == '0' {
+		if base, name := numberBase(l.peekChar()); base != 0 {
+			l.readChar()
+			l.readChar()
+			digits := l.position
+			for isLetter(l.ch) || isDigit(l.ch) {
+				l.readChar()
+			}
+			literal := l.input[start.Offset:l.position]
+			if !l.checkDigits(start, l.input[digits:l.position], base, name) {
+				return token.ILLEGAL, literal
+			}
+			return token.INT, literal
+		}
+	}
+
+	tokenType := token.TokenType(token.INT)
+	l.readDigits()
+	if l.ch == '.' && isDigit(l.peekChar()) {
+		tokenType = token.FLOAT
+		l.readChar()
+		l.readDigits()
+	}
+	if l.ch == 'e' || l.ch == 'E' {
+		next := l.peekChar()
+		if (next == '+' || next == '-') && isDigit(l.peekCharN(2)) {
+			l.readChar()
+			next = l.peekChar()
+		}
+		if isDigit(next) {
+			tokenType = token.FLOAT
+			l.readChar()
+			l.readDigits()
+		}
+	}
+
+	literal := l.input[start.Offset:l.position]
+	if !l.checkSeparators(start, literal) {
+		return token.ILLEGAL, literal
+	}
+	return tokenType, literal
+}
+
+func (l *Lexer) readDigits() {
+	for isDigit(l.ch) || l.ch == '_' {
+		l.readChar()
+	}
+}
+
+// numberBase returns the base and name of the integer literal prefix "0"
+// followed by ch, or 0 if ch does not start a prefix.
+func numberBase(ch rune) (int, string) {
+	switch ch {
+	case 'x', 'X':
+		return 16, "hexadecimal"
+	case 'o', 'O':
+		return 8, "octal"
+	case 'b', 'B':
+		return 2, "binary"
+	default:
+		return 0, ""
+	}
+}
+
+// checkDigits reports whether digits, the part of a prefixed integer
+// literal after its prefix, is valid in base. An underscore may follow the
+// prefix or separate two digits.
+func (l *Lexer) checkDigits(start token.Position, digits string, base int, name string) bool {
+	if strings.Trim(digits, "_") == "" {
+		l.errorAt(start, l.currentPosition(), diagnostic.InvalidNumber, "%s literal has no digits", name)
+		return false
+	}
+	for _, ch := range digits {
+		if ch != '_' && digitValue(ch) >= base {
+			l.errorAt(start, l.currentPosition(), diagnostic.InvalidNumber, "invalid digit %q in %s literal", ch, name)
+			return false
+		}
+	}
+	if strings.Contains(digits, "__") || strings.HasSuffix(digits, "_") {
+		l.errorAt(start, l.currentPosition(), diagnostic.InvalidNumber, "'_' must separate successive digits")
+		return false
+	}
+	return true
+}
+
+// checkSeparators reports whether every underscore in the decimal or float
+// literal sits between two digits.
+func (l *Lexer) checkSeparators(start token.Position, literal string) bool {
+	for i := 0; i < len(literal); i++ {
+		if literal[i] != '_' {
+			continue
+		}
+		if i+1 == len(literal) || !isDigit(rune(literal[i-1])) || !isDigit(rune(literal[i+1])) {
+			l.errorAt(start, l.currentPosition(), diagnostic.InvalidNumber, "'_' must separate successive digits")
+			return false
+		}
+	}
+	return true
+}
+
+// digitValue returns the value of ch as a digit, or 36 if ch is not one.
+func digitValue(ch rune) int {
+	switch {
+	case '0' <= ch && ch <= '9':
+		return int(ch - '0')
+	case 'a' <= ch && ch <= 'z':
+		return int(ch-'a') + 10
+	case 'A' <= ch && ch <= 'Z':
+		return int(ch-'A') + 10
+	default:
+		return 36
+	}
+}
@@ -0,0 +1,202 @@
+package lexer
+
+import (
+	"monkey/diagnostic"
+	"monkey/token"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// readStringPart reads the contents of a "..." literal up to the closing
+// quote or the next "${", and returns their unescaped value. The current
+// char is the first char of the contents; on return it is the closing quote
+// or the '{' of "${". more reports whether an interpolation was opened.
+// A string may not span lines, so a missing closing quote is reported at
+// the end of the line instead of swallowing the rest of the input.
+func (l *Lexer) readStringPart(start token.Position) (literal string, more bool) {
+	contentStart := l.currentPosition()
+	for l.ch != '"' {
+		if l.ch == '\n' || l.ch == 0 {
+			l.errorAt(start, l.currentPosition(), diagnostic.UnterminatedString, "string literal is not terminated")
+			break
+		}
+		if l.ch == '$' && l.peekChar() == '{' {
+			literal = l.unescape(l.input[contentStart.Offset:l.position], contentStart)
+			l.readChar()
+			l.interpolations = append(l.interpolations, 0)
+			return literal, true
+		}
+		if l.ch == '\\' && l.peekChar() != '\n' && l.peekChar() != 0 {
+			l.readChar()
+		}
+		l.readChar()
+	}
+	return l.unescape(l.input[contentStart.Offset:l.position], contentStart), false
+}
+
+// readRawString reads a `...` literal. Raw strings may span lines and do not
+// interpret escape sequences.
+func (l *Lexer) readRawString() string {
+	start := l.currentPosition()
+	l.readChar()
+	position := l.position
+	for l.ch != '`' {
+		if l.ch == 0 {
+			l.errorAt(start, l.currentPosition(), diagnostic.UnterminatedString, "raw string literal is not terminated")
+			break
+		}
+		l.readChar()
+	}
+	return l.input[position:l.position]
+}
+
+// readHeredoc reads a """...""" literal. Heredocs may span lines and
+// interpret escape sequences. A newline right after the opening quotes is
+// dropped, and if the closing quotes are on a line of their own, that line's
+// indentation is stripped from every line of the literal. Heredocs are not
+// interpolated.
+func (l *Lexer) readHeredoc() string {
+	start := l.currentPosition()
+	l.readChar()
+	l.readChar()
+	l.readChar()
+	contentStart := l.currentPosition()
+	for !(l.ch == '"' && l.peekChar() == '"' && l.peekCharN(2) == '"') {
+		if l.ch == 0 {
+			l.errorAt(start, l.currentPosition(), diagnostic.UnterminatedString, "heredoc string literal is not terminated")
+			break
+		}
+		if l.ch == '\\' && l.peekChar() != 0 {
+			l.readChar()
+		}
+		l.readChar()
+	}
+	raw := l.input[contentStart.Offset:l.position]
+	if l.ch != 0 {
+		l.readChar()
+		l.readChar()
+	}
+
+	type line struct {
+		text string
+		pos  token.Position
+	}
+	lines := []line{}
+	pos := contentStart
+	for {
+		i := strings.IndexByte(raw, '\n')
+		if i < 0 {
+			lines = append(lines, line{raw, pos})
+			break
+		}
+		lines = append(lines, line{raw[:i], pos})
+		raw = raw[i+1:]
+		pos = token.Position{Filename: pos.Filename, Offset: pos.Offset + i + 1, Line: pos.Line + 1, Column: 1}
+	}
+
+	if len(lines) > 1 && strings.TrimSpace(lines[0].text) == "" {
+		lines = lines[1:]
+	}
+	indent := ""
+	if last := lines[len(lines)-1].text; len(lines) > 1 && strings.TrimLeft(last, " \t") == "" {
+		indent = last
+		lines = lines[:len(lines)-1]
+	}
+
+	var out strings.Builder
+	for i, ln := range lines {
+		if i > 0 {
+			out.WriteByte('\n')
+		}
+		text := strings.TrimSuffix(ln.text, "\r")
+		if strings.HasPrefix(text, indent) {
+			text = text[len(indent):]
+			ln.pos.Offset += len(indent)
+			ln.pos.Column += utf8.RuneCountInString(indent)
+		}
+		out.WriteString(l.unescape(text, ln.pos))
+	}
+	return out.String()
+}
+
+// unescape interprets the escape sequences in raw, a single line of source
+// starting at pos. Invalid escapes are reported and kept verbatim.
+func (l *Lexer) unescape(raw string, pos token.Position) string {
+	if strings.IndexByte(raw, '\\') < 0 {
+		return raw
+	}
+
+	var out strings.Builder
+	for i := 0; i < len(raw); {
+		if raw[i] != '\\' || i+1 == len(raw) {
+			r, width := utf8.DecodeRuneInString(raw[i:])
+			out.WriteRune(r)
+			i += width
+			continue
+		}
+
+		n := 2
+		switch raw[i+1] {
+		case 'n':
+			out.WriteByte('\n')
+		case 't':
+			out.WriteByte('\t')
+		case 'r':
+			out.WriteByte('\r')
+		case '"':
+			out.WriteByte('"')
+		case '$':
+			out.WriteByte('$')
+		case '\\':
+			out.WriteByte('\\')
+		case 'u':
+			r, width, ok := decodeUnicodeEscape(raw[i:])
+			n = width
+			if ok {
+				out.WriteRune(r)
+				break
+			}
+			l.errorAt(offsetPosition(raw, pos, i), offsetPosition(raw, pos, i+n), diagnostic.InvalidEscape,
+				"invalid unicode escape %q", raw[i:i+n])
+			out.WriteString(raw[i : i+n])
+		default:
+			_, width := utf8.DecodeRuneInString(raw[i+1:])
+			n = 1 + width
+			l.errorAt(offsetPosition(raw, pos, i), offsetPosition(raw, pos, i+n), diagnostic.InvalidEscape,
+				"unknown escape sequence %q", raw[i:i+n])
+			out.WriteString(raw[i : i+n])
+		}
+		i += n
+	}
+	return out.String()
+}
+
+// decodeUnicodeEscape decodes a \u{XXXX} escape at the start of s. It returns
+// the number of bytes that belong to the escape even if it is invalid.
+func decodeUnicodeEscape(s string) (rune, int, bool) {
+	if len(s) < 3 || s[2] != '{' {
+		return 0, 2, false
+	}
+	end := strings.IndexByte(s, '}')
+	if end < 0 {
+		return 0, len(s), false
+	}
+	digits := s[3:end]
+	if len(digits) == 0 || len(digits) > 6 {
+		return 0, end + 1, false
+	}
+	value, err := strconv.ParseUint(digits, 16, 32)
+	if err != nil || !utf8.ValidRune(rune(value)) {
+		return 0, end + 1, false
+	}
+	return rune(value), end + 1, true
+}
+
+// offsetPosition returns the position of byte offset i within raw, a single
+// line of source starting at pos.
+func offsetPosition(raw string, pos token.Position, i int) token.Position {
+	pos.Offset += i
+	pos.Column += utf8.RuneCountInString(raw[:i])
+	return pos
+}
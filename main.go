@@ -5,14 +5,25 @@ import (
 	"monkey/repl"
 	"os"
 	"os/user"
+	"path/filepath"
 )
 
 func main() {
+	// MONKEYPATH lists the directories searched for imported modules.
+	searchPath := filepath.SplitList(os.Getenv("MONKEYPATH"))
+
+	if len(os.Args) > 1 {
+		if repl.RunFile(os.Args[1], os.Stderr, searchPath...) != nil {
+			os.Exit(1)
+		}
+		return
+	}
+
 	user, err := user.Current()
 	if err != nil {
 		panic(err)
 	}
 	fmt.Printf("Hello %s! Welcome to the Monkey programming language !\n", user.Username)
 	fmt.Printf("Feel free to type in commands\n")
-	repl.Start(os.Stdin, os.Stdout)
+	repl.Start(os.Stdin, os.Stdout, searchPath...)
 }
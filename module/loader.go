@@ -0,0 +1,163 @@
+// Package module finds, parses and caches the source files of the modules
+// a program imports.
+package module
+
+import (
+	"fmt"
+	"monkey/ast"
+	"monkey/lexer"
+	"monkey/object"
+	"monkey/parser"
+	"monkey/token"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Extension is added to import paths that do not have one.
+const Extension = ".monkey"
+
+// LoadFunc runs the parsed program of a module and returns its value, which
+// the Loader caches.
+type LoadFunc func(filename string, program *ast.Program) (object.Object, error)
+
+// Loader resolves import paths to files and loads each file at most once.
+// It is meant for the modules of a single program and engine.
+type Loader struct {
+	// SearchPath lists the directories searched for a module that is not
+	// found relative to the importing file.
+	SearchPath []string
+	// ReadFile reads a source file. It defaults to os.ReadFile.
+	ReadFile func(filename string) ([]byte, error)
+
+	modules map[string]object.Object
+	loading []string // files being loaded, outermost first
+}
+
+// ImportError is an import statement that failed. Err is itself an
+// *ImportError when an import of the imported module failed, so that the
+// message reads as the chain of imports that led to the failure.
+type ImportError struct {
+	Pos  token.Position // of the import statement
+	Path string
+	Err  error
+}
+
+func (e *ImportError) Error() string {
+	if e.Pos.IsValid() {
+		return e.Pos.String() + ": " + e.Message()
+	}
+	return e.Message()
+}
+
+// Message returns the error without the position of the import statement.
+func (e *ImportError) Message() string {
+	return fmt.Sprintf("importing %q: %s", e.Path, e.Err)
+}
+
+func NewLoader(searchPath ...string) *Loader {
+	return &Loader{
+		SearchPath: searchPath,
+		ReadFile:   os.ReadFile,
+		modules:    make(map[string]object.Object),
+	}
+}
+
+// Load loads the file filename, which is usually the main file of the
+// program, so that an import of it from one of its modules is reported as
+// a cycle.
+func (l *Loader) Load(filename string, load LoadFunc) (object.Object, error) {
+	filename = filepath.Clean(filename)
+	source, err := l.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	return l.load(filename, source, load)
+}
+
+// Import loads the module at path for the file from, which is empty for
+// code that is not in a file.
+func (l *Loader) Import(path, from string, load LoadFunc) (object.Object, error) {
+	filename, source, err := l.find(path, from)
+	if err != nil {
+		return nil, err
+	}
+	return l.load(filename, source, load)
+}
+
+// find looks for path relative to the directory of from, or the working
+// directory if from is empty, and then in each directory of the search
+// path. An absolute path is only looked for as is.
+func (l *Loader) find(path, from string) (string, []byte, error) {
+	name := path
+	if filepath.Ext(name) == "" {
+		name += Extension
+	}
+	candidates := []string{filepath.Join(filepath.Dir(from), name)}
+	if !filepath.IsAbs(name) {
+		for _, dir := range l.SearchPath {
+			candidates = append(candidates, filepath.Join(dir, name))
+		}
+	}
+	for _, filename := range candidates {
+		source, err := l.ReadFile(filename)
+		if err == nil {
+			return filename, source, nil
+		}
+	}
+	return "", nil, fmt.Errorf("module %q not found", path)
+}
+
+func (l *Loader) load(filename string, source []byte, load LoadFunc) (object.Object, error) {
+	if value, ok := l.modules[filename]; ok {
+		return value, nil
+	}
+	for i, loading := range l.loading {
+		if loading == filename {
+			cycle := append(l.loading[i:len(l.loading):len(l.loading)], filename)
+			return nil, fmt.Errorf("import cycle: %s", strings.Join(cycle, " -> "))
+		}
+	}
+
+	p := parser.New(lexer.NewWithFilename(filename, string(source)))
+	program := p.ParseProgram()
+	if diagnostics := p.Diagnostics(); len(diagnostics) > 0 {
+		messages := make([]string, len(diagnostics))
+		for i, d := range diagnostics {
+			messages[i] = d.String()
+		}
+		return nil, fmt.Errorf("%s", strings.Join(messages, "\n"))
+	}
+
+	l.loading = append(l.loading, filename)
+	value, err := load(filename, program)
+	l.loading = l.loading[:len(l.loading)-1]
+	if err != nil {
+		return nil, err
+	}
+	l.modules[filename] = value
+	return value, nil
+}
+
+// Exports returns the names of the variables a module's program exports.
+func Exports(program *ast.Program) []string {
+	names := []string{}
+	for _, stmt := range program.Statements {
+		switch stmt := stmt.(type) {
+		case *ast.LetStatement:
+			if !stmt.Export {
+				continue
+			}
+			if stmt.Pattern != nil {
+				names = append(names, ast.PatternNames(stmt.Pattern)...)
+			} else {
+				names = append(names, stmt.Name.Value)
+			}
+		case *ast.StructStatement:
+			if stmt.Export {
+				names = append(names, stmt.Name.Value)
+			}
+		}
+	}
+	return names
+}
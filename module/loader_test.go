@@ -0,0 +1,139 @@
+package module
+
+import (
+	"monkey/ast"
+	"monkey/object"
+	"os"
+	"reflect"
+	"testing"
+)
+
+func newTestLoader(files map[string]string, searchPath ...string) *Loader {
+	l := NewLoader(searchPath...)
+	l.ReadFile = func(filename string) ([]byte, error) {
+		source, ok := files[filename]
+		if !ok {
+			return nil, os.ErrNotExist
+		}
+		return []byte(source), nil
+	}
+	return l
+}
+
+// loadNames returns a LoadFunc that records the files it loads and
+// returns their names.
+func loadNames(loaded *[]string) LoadFunc {
+	return func(filename string, program *ast.Program) (object.Object, error) {
+		*loaded = append(*loaded, filename)
+		return &object.String{Value: filename}, nil
+	}
+}
+
+func TestImportResolution(t *testing.T) {
+	l := newTestLoader(map[string]string{
+		"app/lib/util.monkey": "1",
+		"app/util.monkey":     "2",
+		"std/text.monkey":     "3",
+		"app/text.txt":        "4",
+	}, "std")
+
+	tests := []struct {
+		path     string
+		from     string
+		expected string
+	}{
+		{"lib/util", "app/main.monkey", "app/lib/util.monkey"},
+		{"../util", "app/lib/util.monkey", "app/util.monkey"},
+		{"text", "app/main.monkey", "std/text.monkey"},
+		{"text.txt", "app/main.monkey", "app/text.txt"},
+		{"app/util", "", "app/util.monkey"},
+	}
+
+	for _, tt := range tests {
+		value, err := l.Import(tt.path, tt.from, loadNames(&[]string{}))
+		if err != nil {
+			t.Errorf("Import(%q, %q) failed: %s", tt.path, tt.from, err)
+			continue
+		}
+		if value.Inspect() != tt.expected {
+			t.Errorf("Import(%q, %q) resolved to %q, want %q", tt.path, tt.from, value.Inspect(), tt.expected)
+		}
+	}
+
+	_, err := l.Import("missing", "app/main.monkey", loadNames(&[]string{}))
+	if err == nil || err.Error() != `module "missing" not found` {
+		t.Errorf("wrong error for a missing module: %v", err)
+	}
+}
+
+func TestImportIsCached(t *testing.T) {
+	l := newTestLoader(map[string]string{"a.monkey": "1", "b/../a.monkey": "1"})
+	loaded := []string{}
+	for _, path := range []string{"a", "a.monkey", "b/../a"} {
+		_, err := l.Import(path, "", loadNames(&loaded))
+		if err != nil {
+			t.Fatalf("Import(%q) failed: %s", path, err)
+		}
+	}
+	if !reflect.DeepEqual(loaded, []string{"a.monkey"}) {
+		t.Errorf("wrong files loaded: %v", loaded)
+	}
+}
+
+func TestImportCycle(t *testing.T) {
+	l := newTestLoader(map[string]string{
+		"main.monkey": `import "a" as a;`,
+		"a.monkey":    `import "b" as b;`,
+		"b.monkey":    `import "a" as a;`,
+	})
+	var load LoadFunc
+	load = func(filename string, program *ast.Program) (object.Object, error) {
+		for _, stmt := range program.Statements {
+			stmt := stmt.(*ast.ImportStatement)
+			_, err := l.Import(stmt.Path, filename, load)
+			if err != nil {
+				return nil, &ImportError{Pos: stmt.Pos(), Path: stmt.Path, Err: err}
+			}
+		}
+		return &object.Null{}, nil
+	}
+
+	_, err := l.Load("main.monkey", load)
+	expected := `main.monkey:1:1: importing "a": a.monkey:1:1: importing "b": ` +
+		`b.monkey:1:1: importing "a": import cycle: a.monkey -> b.monkey -> a.monkey`
+	if err == nil || err.Error() != expected {
+		t.Errorf("wrong error. want=%q, got=%v", expected, err)
+	}
+}
+
+func TestImportParseErrors(t *testing.T) {
+	l := newTestLoader(map[string]string{"bad.monkey": "let = 1;"})
+	_, err := l.Import("bad", "", loadNames(&[]string{}))
+	expected := `bad.monkey:1:5: error[P0001]: expected next token to be IDENT, got = instead`
+	if err == nil || err.Error() != expected {
+		t.Errorf("wrong error. want=%q, got=%v", expected, err)
+	}
+}
+
+func TestExports(t *testing.T) {
+	l := newTestLoader(map[string]string{"m.monkey": `
+let hidden = 1;
+export let a = 2;
+export let [b, _, ...c] = [1, 2, 3];
+export let {"k": d} = {"k": 4};
+struct Hidden { x }
+export struct Point { x, y }
+a;
+`})
+	var names []string
+	_, err := l.Import("m", "", func(filename string, program *ast.Program) (object.Object, error) {
+		names = Exports(program)
+		return &object.Null{}, nil
+	})
+	if err != nil {
+		t.Fatalf("Import failed: %s", err)
+	}
+	if !reflect.DeepEqual(names, []string{"a", "b", "c", "d", "Point"}) {
+		t.Errorf("wrong exports: %v", names)
+	}
+}
@@ -1,6 +1,11 @@
 package object
 
-import "fmt"
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
 
 var Builtins = []struct {
 	Name    string
@@ -15,7 +20,7 @@ var Builtins = []struct {
 			case *Array:
 				return &Integer{Value: int64(len(arg.Elements))}
 			case *String:
-				return &Integer{Value: int64(len(arg.Value))}
+				return &Integer{Value: int64(arg.Len())}
 			default:
 				return newError("argument to `len` not supported, got %s", args[0].Type())
 			}
@@ -95,6 +100,272 @@ var Builtins = []struct {
 			return &Array{Elements: newElements}
 		},
 	}},
+	{"int", &Builtin{
+		Fn: func(args ...Object) Object {
+			if len(args) != 1 {
+				return newError("wrong number of arguments. got=%d, want=1", len(args))
+			}
+			switch arg := args[0].(type) {
+			case *Integer:
+				return arg
+			case *Float:
+				if math.IsNaN(arg.Value) || arg.Value >= math.MaxInt64 || arg.Value < math.MinInt64 {
+					return newError("cannot convert %s to INTEGER", arg.Inspect())
+				}
+				return &Integer{Value: int64(arg.Value)}
+			case *String:
+				value, err := strconv.ParseInt(strings.TrimSpace(arg.Value), 0, 64)
+				if err != nil {
+					return newError("cannot convert %q to INTEGER", arg.Value)
+				}
+				return &Integer{Value: value}
+			default:
+				return newError("argument to `int` not supported, got %s", args[0].Type())
+			}
+		},
+	}},
+	{"float", &Builtin{
+		Fn: func(args ...Object) Object {
+			if len(args) != 1 {
+				return newError("wrong number of arguments. got=%d, want=1", len(args))
+			}
+			switch arg := args[0].(type) {
+			case *Integer:
+				return &Float{Value: float64(arg.Value)}
+			case *Float:
+				return arg
+			case *String:
+				value, err := strconv.ParseFloat(strings.TrimSpace(arg.Value), 64)
+				if err != nil {
+					return newError("cannot convert %q to FLOAT", arg.Value)
+				}
+				return &Float{Value: value}
+			default:
+				return newError("argument to `float` not supported, got %s", args[0].Type())
+			}
+		},
+	}},
+	{"str", &Builtin{
+		Fn: func(args ...Object) Object {
+			if len(args) != 1 {
+				return newError("wrong number of arguments. got=%d, want=1", len(args))
+			}
+			if str, ok := args[0].(*String); ok {
+				return str
+			}
+			return &String{Value: args[0].Inspect()}
+		},
+	}},
+	{"append", &Builtin{
+		Fn: func(args ...Object) Object {
+			if len(args) < 1 {
+				return newError("wrong number of arguments. got=%d, want at least 1", len(args))
+			}
+			arr, ok := args[0].(*Array)
+			if !ok {
+				return newError("argument to `append` must be ARRAY. got=%s", args[0].Type())
+			}
+			arr.Elements = append(arr.Elements, args[1:]...)
+			return arr
+		},
+	}},
+	{"delete", &Builtin{
+		Fn: func(args ...Object) Object {
+			if len(args) != 2 {
+				return newError("wrong number of arguments. got=%d, want=2", len(args))
+			}
+			switch collection := args[0].(type) {
+			case *Array:
+				index, ok := args[1].(*Integer)
+				if !ok {
+					return newError("array index must be an integer, got %s", args[1].Type())
+				}
+				i := index.Value
+				if i < 0 || i >= int64(len(collection.Elements)) {
+					return nil
+				}
+				removed := collection.Elements[i]
+				collection.Elements = append(collection.Elements[:i], collection.Elements[i+1:]...)
+				return removed
+			case *Hash:
+				key, ok := args[1].(Hashable)
+				if !ok {
+					return newError("unusable as hash key: %s", args[1].Type())
+				}
+				pair, ok := collection.Pairs[key.HashKey()]
+				if !ok {
+					return nil
+				}
+				delete(collection.Pairs, key.HashKey())
+				return pair.Value
+			default:
+				return newError("argument to `delete` not supported, got %s", args[0].Type())
+			}
+		},
+	}},
+	{"upper", &Builtin{
+		Fn: func(args ...Object) Object {
+			if len(args) != 1 {
+				return newError("wrong number of arguments. got=%d, want=1", len(args))
+			}
+			str, ok := args[0].(*String)
+			if !ok {
+				return newError("argument to `upper` must be STRING. got=%s", args[0].Type())
+			}
+			return &String{Value: strings.ToUpper(str.Value)}
+		},
+	}},
+	{"lower", &Builtin{
+		Fn: func(args ...Object) Object {
+			if len(args) != 1 {
+				return newError("wrong number of arguments. got=%d, want=1", len(args))
+			}
+			str, ok := args[0].(*String)
+			if !ok {
+				return newError("argument to `lower` must be STRING. got=%s", args[0].Type())
+			}
+			return &String{Value: strings.ToLower(str.Value)}
+		},
+	}},
+	{"split", &Builtin{
+		Fn: func(args ...Object) Object {
+			if len(args) != 2 {
+				return newError("wrong number of arguments. got=%d, want=2", len(args))
+			}
+			str, ok := args[0].(*String)
+			sep, ok2 := args[1].(*String)
+			if !ok || !ok2 {
+				return newError("arguments to `split` must be STRING. got=%s, %s", args[0].Type(), args[1].Type())
+			}
+			parts := strings.Split(str.Value, sep.Value)
+			elements := make([]Object, len(parts))
+			for i, part := range parts {
+				elements[i] = &String{Value: part}
+			}
+			return &Array{Elements: elements}
+		},
+	}},
+	{"join", &Builtin{
+		Fn: func(args ...Object) Object {
+			if len(args) != 2 {
+				return newError("wrong number of arguments. got=%d, want=2", len(args))
+			}
+			arr, ok := args[0].(*Array)
+			sep, ok2 := args[1].(*String)
+			if !ok || !ok2 {
+				return newError("arguments to `join` must be ARRAY and STRING. got=%s, %s", args[0].Type(), args[1].Type())
+			}
+			parts := make([]string, len(arr.Elements))
+			for i, el := range arr.Elements {
+				parts[i] = el.Inspect()
+			}
+			return &String{Value: strings.Join(parts, sep.Value)}
+		},
+	}},
+	{"keys", &Builtin{
+		Fn: func(args ...Object) Object {
+			if len(args) != 1 {
+				return newError("wrong number of arguments. got=%d, want=1", len(args))
+			}
+			hash, ok := args[0].(*Hash)
+			if !ok {
+				return newError("argument to `keys` must be HASH. got=%s", args[0].Type())
+			}
+			keys := []Object{}
+			for _, pair := range hash.SortedPairs() {
+				keys = append(keys, pair.Key)
+			}
+			return &Array{Elements: keys}
+		},
+	}},
+	{"values", &Builtin{
+		Fn: func(args ...Object) Object {
+			if len(args) != 1 {
+				return newError("wrong number of arguments. got=%d, want=1", len(args))
+			}
+			hash, ok := args[0].(*Hash)
+			if !ok {
+				return newError("argument to `values` must be HASH. got=%s", args[0].Type())
+			}
+			values := []Object{}
+			for _, pair := range hash.SortedPairs() {
+				values = append(values, pair.Value)
+			}
+			return &Array{Elements: values}
+		},
+	}},
+	{"map", &Builtin{
+		HigherOrderFn: func(call CallFunction, args ...Object) Object {
+			if len(args) != 2 {
+				return newError("wrong number of arguments. got=%d, want=2", len(args))
+			}
+			arr, ok := args[0].(*Array)
+			if !ok {
+				return newError("argument to `map` must be ARRAY. got=%s", args[0].Type())
+			}
+			elements := make([]Object, len(arr.Elements))
+			for i, el := range arr.Elements {
+				result := call(args[1], el)
+				if result.Type() == ERROR_OBJ {
+					return result
+				}
+				elements[i] = result
+			}
+			return &Array{Elements: elements}
+		},
+	}},
+	{"filter", &Builtin{
+		HigherOrderFn: func(call CallFunction, args ...Object) Object {
+			if len(args) != 2 {
+				return newError("wrong number of arguments. got=%d, want=2", len(args))
+			}
+			arr, ok := args[0].(*Array)
+			if !ok {
+				return newError("argument to `filter` must be ARRAY. got=%s", args[0].Type())
+			}
+			elements := []Object{}
+			for _, el := range arr.Elements {
+				result := call(args[1], el)
+				if result.Type() == ERROR_OBJ {
+					return result
+				}
+				if truthy(result) {
+					elements = append(elements, el)
+				}
+			}
+			return &Array{Elements: elements}
+		},
+	}},
+	{"reduce", &Builtin{
+		HigherOrderFn: func(call CallFunction, args ...Object) Object {
+			if len(args) != 3 {
+				return newError("wrong number of arguments. got=%d, want=3", len(args))
+			}
+			arr, ok := args[0].(*Array)
+			if !ok {
+				return newError("argument to `reduce` must be ARRAY. got=%s", args[0].Type())
+			}
+			acc := args[2]
+			for _, el := range arr.Elements {
+				acc = call(args[1], acc, el)
+				if acc.Type() == ERROR_OBJ {
+					return acc
+				}
+			}
+			return acc
+		},
+	}},
+}
+
+func truthy(obj Object) bool {
+	switch obj := obj.(type) {
+	case *Boolean:
+		return obj.Value
+	case *Null:
+		return false
+	default:
+		return true
+	}
 }
 
 func newError(format string, a ...interface{}) *Error {
@@ -109,3 +380,45 @@ func GetBuiltinByName(name string) *Builtin {
 	}
 	return nil
 }
+
+// Method resolves receiver.name(...) to the function it calls: the value
+// under the key name if receiver is a hash that has one, the export name of
+// a module, and otherwise the builtin name with receiver bound as its first
+// argument.
+func Method(receiver Object, name string) (Object, bool) {
+	if module, ok := receiver.(*Module); ok {
+		value, ok := module.Exports[name]
+		return value, ok
+	}
+	if s, ok := receiver.(*Struct); ok {
+		if value, err := s.Field(name); err == nil {
+			return value, true
+		}
+	}
+	if hash, ok := receiver.(*Hash); ok {
+		key := &String{Value: name}
+		if pair, ok := hash.Pairs[key.HashKey()]; ok {
+			return pair.Value, true
+		}
+	}
+	if builtin := GetBuiltinByName(name); builtin != nil {
+		return builtin.Bind(receiver), true
+	}
+	return nil, false
+}
+
+// Bind returns a builtin that calls b with receiver before its arguments.
+func (b *Builtin) Bind(receiver Object) *Builtin {
+	bound := &Builtin{}
+	if b.Fn != nil {
+		bound.Fn = func(args ...Object) Object {
+			return b.Fn(append([]Object{receiver}, args...)...)
+		}
+	}
+	if b.HigherOrderFn != nil {
+		bound.HigherOrderFn = func(call CallFunction, args ...Object) Object {
+			return b.HigherOrderFn(call, append([]Object{receiver}, args...)...)
+		}
+	}
+	return bound
+}
@@ -0,0 +1,145 @@
+package object
+
+import (
+	"fmt"
+	"sort"
+)
+
+// Iterable is implemented by the objects a for-in loop can iterate over.
+type Iterable interface {
+	Object
+	NewIterator() Iterator
+}
+
+// Iterator steps through the elements of an Iterable. Next returns the key
+// and value of the next element, with ok set to false once there are none
+// left. Keys are indexes for arrays, strings and ranges.
+type Iterator interface {
+	Object
+	Next() (key, value Object, ok bool)
+}
+
+// Range is the half-open integer range start..end. It is iterated without
+// allocating its elements.
+type Range struct {
+	Start int64
+	End   int64
+}
+
+func (r *Range) Type() ObjectType { return RANGE_OBJ }
+func (r *Range) Inspect() string  { return fmt.Sprintf("%d..%d", r.Start, r.End) }
+
+func (r *Range) NewIterator() Iterator {
+	return &rangeIterator{next: r.Start, end: r.End}
+}
+
+func (a *Array) NewIterator() Iterator {
+	return &arrayIterator{elements: a.Elements}
+}
+
+func (i *String) NewIterator() Iterator {
+	return &stringIterator{runes: []rune(i.Value)}
+}
+
+// NewIterator iterates over the pairs of h ordered by key, so that the
+// order does not depend on Go's map iteration order.
+func (h *Hash) NewIterator() Iterator {
+	return &hashIterator{pairs: h.SortedPairs()}
+}
+
+// SortedPairs returns the pairs of the hash in the order a for-in loop
+// visits them: numeric keys by value, and other keys by type and then by
+// their Inspect form.
+func (h *Hash) SortedPairs() []HashPair {
+	pairs := make([]HashPair, 0, len(h.Pairs))
+	for _, pair := range h.Pairs {
+		pairs = append(pairs, pair)
+	}
+	sort.Slice(pairs, func(i, j int) bool {
+		return lessKey(pairs[i].Key, pairs[j].Key)
+	})
+	return pairs
+}
+
+func lessKey(a, b Object) bool {
+	switch a := a.(type) {
+	case *Integer:
+		if b, ok := b.(*Integer); ok {
+			return a.Value < b.Value
+		}
+	case *Float:
+		if b, ok := b.(*Float); ok {
+			return a.Value < b.Value
+		}
+	}
+	if a.Type() != b.Type() {
+		return a.Type() < b.Type()
+	}
+	return a.Inspect() < b.Inspect()
+}
+
+type rangeIterator struct {
+	index int64
+	next  int64
+	end   int64
+}
+
+func (it *rangeIterator) Type() ObjectType { return ITERATOR_OBJ }
+func (it *rangeIterator) Inspect() string  { return "iterator" }
+func (it *rangeIterator) Next() (Object, Object, bool) {
+	if it.next >= it.end {
+		return nil, nil, false
+	}
+	key, value := &Integer{Value: it.index}, &Integer{Value: it.next}
+	it.index++
+	it.next++
+	return key, value, true
+}
+
+type arrayIterator struct {
+	elements []Object
+	index    int
+}
+
+func (it *arrayIterator) Type() ObjectType { return ITERATOR_OBJ }
+func (it *arrayIterator) Inspect() string  { return "iterator" }
+func (it *arrayIterator) Next() (Object, Object, bool) {
+	if it.index >= len(it.elements) {
+		return nil, nil, false
+	}
+	key, value := &Integer{Value: int64(it.index)}, it.elements[it.index]
+	it.index++
+	return key, value, true
+}
+
+type stringIterator struct {
+	runes []rune
+	index int
+}
+
+func (it *stringIterator) Type() ObjectType { return ITERATOR_OBJ }
+func (it *stringIterator) Inspect() string  { return "iterator" }
+func (it *stringIterator) Next() (Object, Object, bool) {
+	if it.index >= len(it.runes) {
+		return nil, nil, false
+	}
+	key, value := &Integer{Value: int64(it.index)}, &String{Value: string(it.runes[it.index])}
+	it.index++
+	return key, value, true
+}
+
+type hashIterator struct {
+	pairs []HashPair
+	index int
+}
+
+func (it *hashIterator) Type() ObjectType { return ITERATOR_OBJ }
+func (it *hashIterator) Inspect() string  { return "iterator" }
+func (it *hashIterator) Next() (Object, Object, bool) {
+	if it.index >= len(it.pairs) {
+		return nil, nil, false
+	}
+	pair := it.pairs[it.index]
+	it.index++
+	return pair.Key, pair.Value, true
+}
@@ -0,0 +1,28 @@
+package object
+
+import "fmt"
+
+// Module is the value an import statement binds: the exported variables of
+// a module, as they were when its top-level code finished.
+type Module struct {
+	Name    string
+	Exports map[string]Object
+}
+
+func (m *Module) Type() ObjectType { return MODULE_OBJ }
+func (m *Module) Inspect() string  { return fmt.Sprintf("module(%s)", m.Name) }
+
+// Export returns the exported variable name, or an error if the module does
+// not export it.
+func (m *Module) Export(name string) (Object, error) {
+	value, ok := m.Exports[name]
+	if !ok {
+		return nil, fmt.Errorf("module %s has no export %s", m.Name, name)
+	}
+	return value, nil
+}
+
+// Importer loads the modules imported by the code of one file.
+type Importer interface {
+	Import(path string) (*Module, error)
+}
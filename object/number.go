@@ -0,0 +1,27 @@
+package object
+
+// IsNumber reports whether obj is an Integer or a Float.
+func IsNumber(obj Object) bool {
+	return obj.Type() == INTEGER_OBJ || obj.Type() == FLOAT_OBJ
+}
+
+// ToFloat converts an Integer or a Float to a float64.
+func ToFloat(obj Object) float64 {
+	if i, ok := obj.(*Integer); ok {
+		return float64(i.Value)
+	}
+	return obj.(*Float).Value
+}
+
+// IntPow raises base to a non-negative exponent by repeated squaring.
+func IntPow(base, exponent int64) int64 {
+	result := int64(1)
+	for exponent > 0 {
+		if exponent&1 == 1 {
+			result *= base
+		}
+		base *= base
+		exponent >>= 1
+	}
+	return result
+}
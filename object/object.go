@@ -4,18 +4,25 @@ import (
 	"bytes"
 	"fmt"
 	"hash/fnv"
+	"math"
 	"monkey/ast"
 	"monkey/code"
+	"monkey/token"
+	"strconv"
 	"strings"
+	"unicode/utf8"
 )
 
 type ObjectType string
 
 const (
 	INTEGER_OBJ           = "INTEGER"
+	FLOAT_OBJ             = "FLOAT"
 	BOOLEAN_OBJ           = "BOOLEAN"
 	NULL_OBJ              = "NULL"
 	RETURN_VALUE_OBJ      = "RETURN_VALUE"
+	BREAK_OBJ             = "BREAK"
+	CONTINUE_OBJ          = "CONTINUE"
 	ERROR_OBJ             = "ERROR"
 	FUNCTION_OBJ          = "FUNCTION"
 	STRING_OBJ            = "STRING"
@@ -25,26 +32,80 @@ const (
 	QUOTE_OBJ             = "QUOTE"
 	MACRO_OBJ             = "MACRO"
 	COMPILED_FUNCTION_OBJ = "COMPILED_FUNCTION_OBJ"
-	CLOSURE_OBJ           = "CLOSURE_OBJ"
+	CLOSURE_OBJ           = "CLOSURE_OBJ" // Deprecated: a Closure has type FUNCTION_OBJ.
+	CELL_OBJ              = "CELL"
+	RANGE_OBJ             = "RANGE"
+	ITERATOR_OBJ          = "ITERATOR"
+	MODULE_OBJ            = "MODULE"
+	STRUCT_TYPE_OBJ       = "STRUCT_TYPE"
+	STRUCT_OBJ            = "STRUCT"
 )
 
+// Closure runs Fn with the global variables of the module it was created
+// in.
 type Closure struct {
-	Fn   *CompiledFunction
-	Free []Object
+	Fn      *CompiledFunction
+	Free    []Object
+	Globals []Object
 }
 
-func (c *Closure) Type() ObjectType { return CLOSURE_OBJ }
+func (c *Closure) Type() ObjectType { return FUNCTION_OBJ }
 func (c *Closure) Inspect() string  { return fmt.Sprintf("Closure[%p]", c) }
 
+// Cell boxes a local variable that a closure has captured, so that the
+// enclosing function and every closure sharing the cell see assignments
+// made by the others. Cells live only in stack slots and Closure.Free and
+// are never visible to Monkey code.
+type Cell struct {
+	Value Object
+}
+
+func (c *Cell) Type() ObjectType { return CELL_OBJ }
+func (c *Cell) Inspect() string  { return c.Value.Inspect() }
+
+// CompiledFunction takes NumParameters positional parameters, the last
+// NumDefaults of which are optional. A variadic function collects any
+// further arguments into an array in the local after its parameters.
 type CompiledFunction struct {
 	Instructions  code.Instructions
+	SourceMap     code.SourceMap
 	NumLocals     int
 	NumParameters int
+	NumDefaults   int
+	Variadic      bool
+	Module        string // file name, for the top-level code of a module
 }
 
 func (cf *CompiledFunction) Type() ObjectType { return COMPILED_FUNCTION_OBJ }
 func (cf *CompiledFunction) Inspect() string  { return fmt.Sprintf("CompiledFunction[%p]", cf) }
 
+func (cf *CompiledFunction) Arity() Arity {
+	return Arity{Min: cf.NumParameters - cf.NumDefaults, Max: cf.NumParameters, Variadic: cf.Variadic}
+}
+
+// Arity is the number of arguments a function accepts: between Min and Max,
+// or at least Min if it is variadic.
+type Arity struct {
+	Min      int
+	Max      int
+	Variadic bool
+}
+
+func (a Arity) Accepts(numArgs int) bool {
+	return numArgs >= a.Min && (a.Variadic || numArgs <= a.Max)
+}
+
+func (a Arity) String() string {
+	switch {
+	case a.Variadic:
+		return fmt.Sprintf("at least %d", a.Min)
+	case a.Min != a.Max:
+		return fmt.Sprintf("%d to %d", a.Min, a.Max)
+	default:
+		return strconv.Itoa(a.Min)
+	}
+}
+
 type Quote struct {
 	Node ast.Node
 }
@@ -61,6 +122,9 @@ type Object interface {
 
 type Function struct {
 	Parameters []*ast.Identifier
+	Patterns   []ast.Expression // see ast.FunctionLiteral
+	Defaults   []ast.Expression
+	Rest       *ast.Identifier
 	Body       *ast.BlockStatement
 	Env        *Environment
 }
@@ -84,6 +148,15 @@ func (i *Integer) HashKey() HashKey {
 	return HashKey{Type: i.Type(), Value: uint64(i.Value)}
 }
 
+// HashKey gives a float with an integral value the key of the equal
+// Integer, so that 1.0 finds the value stored under 1.
+func (f *Float) HashKey() HashKey {
+	if f.Value == math.Trunc(f.Value) && f.Value >= math.MinInt64 && f.Value < math.MaxInt64 {
+		return (&Integer{Value: int64(f.Value)}).HashKey()
+	}
+	return HashKey{Type: f.Type(), Value: math.Float64bits(f.Value)}
+}
+
 func (s *String) HashKey() HashKey {
 	h := fnv.New64a()
 	h.Write([]byte(s.Value))
@@ -91,16 +164,22 @@ func (s *String) HashKey() HashKey {
 }
 
 func (f *Function) Type() ObjectType { return FUNCTION_OBJ }
+
+func (f *Function) Arity() Arity {
+	arity := Arity{Min: len(f.Parameters), Max: len(f.Parameters), Variadic: f.Rest != nil}
+	for _, d := range f.Defaults {
+		if d != nil {
+			arity.Min--
+		}
+	}
+	return arity
+}
 func (f *Function) Inspect() string {
 	var out bytes.Buffer
 
-	params := []string{}
-	for _, p := range f.Parameters {
-		params = append(params, p.String())
-	}
 	out.WriteString("fn")
 	out.WriteString("(")
-	out.WriteString(strings.Join(params, ", "))
+	out.WriteString(ast.ParameterList(f.Parameters, f.Patterns, f.Defaults, f.Rest))
 	out.WriteString(") \n")
 	out.WriteString(f.Body.String())
 	out.WriteString("\n")
@@ -146,6 +225,25 @@ func (i *Integer) Type() ObjectType {
 	return INTEGER_OBJ
 }
 
+type Float struct {
+	Value float64
+}
+
+// Inspect formats the float with the fewest digits that read back as the
+// same value, keeping a ".0" on integral values so they don't look like
+// integers.
+func (f *Float) Inspect() string {
+	s := strconv.FormatFloat(f.Value, 'g', -1, 64)
+	if !strings.ContainsAny(s, ".eIN") {
+		s += ".0"
+	}
+	return s
+}
+
+func (f *Float) Type() ObjectType {
+	return FLOAT_OBJ
+}
+
 type Boolean struct {
 	Value bool
 }
@@ -170,6 +268,27 @@ func (i *String) Type() ObjectType {
 	return STRING_OBJ
 }
 
+// Len returns the number of code points in the string.
+func (i *String) Len() int {
+	return utf8.RuneCountInString(i.Value)
+}
+
+// CharAt returns the code point at index as a one-character string, or
+// false if index is out of range.
+func (i *String) CharAt(index int64) (*String, bool) {
+	if index < 0 {
+		return nil, false
+	}
+	var n int64
+	for _, r := range i.Value {
+		if n == index {
+			return &String{Value: string(r)}, true
+		}
+		n++
+	}
+	return nil, false
+}
+
 type Null struct {
 }
 
@@ -188,17 +307,57 @@ type ReturnValue struct {
 func (rv *ReturnValue) Type() ObjectType { return RETURN_VALUE_OBJ }
 func (rv *ReturnValue) Inspect() string  { return rv.Value.Inspect() }
 
+// Break and Continue carry a break or continue statement out of the blocks
+// nested in a loop, the way ReturnValue carries a return out of a function.
+type Break struct{}
+
+func (b *Break) Type() ObjectType { return BREAK_OBJ }
+func (b *Break) Inspect() string  { return "break" }
+
+type Continue struct{}
+
+func (c *Continue) Type() ObjectType { return CONTINUE_OBJ }
+func (c *Continue) Inspect() string  { return "continue" }
+
 type Error struct {
 	Message string
+	Pos     token.Position
+	// Value is the value thrown by a throw statement, and is nil for a
+	// runtime error.
+	Value Object
 }
 
-// Add stack trace with lines and column numbers @victor
 func (e *Error) Type() ObjectType { return ERROR_OBJ }
-func (e *Error) Inspect() string  { return "ERROR: " + e.Message }
+func (e *Error) Inspect() string {
+	if e.Pos.IsValid() {
+		return "ERROR: " + e.Pos.String() + ": " + e.Message
+	}
+	return "ERROR: " + e.Message
+}
+
+// Error formats the error as "pos: message", so that it can be passed on
+// as a Go error.
+func (e *Error) Error() string {
+	if e.Pos.IsValid() {
+		return e.Pos.String() + ": " + e.Message
+	}
+	return e.Message
+}
+
+// Thrown returns the value a catch clause binds for the error: the thrown
+// value, or the message of a runtime error.
+func (e *Error) Thrown() Object {
+	if e.Value != nil {
+		return e.Value
+	}
+	return &String{Value: e.Message}
+}
 
 type Environment struct {
-	store map[string]Object
-	outer *Environment
+	store    map[string]Object
+	consts   map[string]bool // names bound by const
+	outer    *Environment
+	importer Importer
 }
 
 func NewEnvironment() *Environment {
@@ -219,6 +378,53 @@ func (e *Environment) Set(name string, val Object) Object {
 	return val
 }
 
+// Define binds name in e, as a constant if constant is set. It fails if e
+// already binds name as a constant.
+func (e *Environment) Define(name string, val Object, constant bool) error {
+	if e.consts[name] {
+		return fmt.Errorf("cannot redeclare constant %s", name)
+	}
+	e.store[name] = val
+	if constant {
+		if e.consts == nil {
+			e.consts = make(map[string]bool)
+		}
+		e.consts[name] = true
+	}
+	return nil
+}
+
+// Assign updates an existing binding in the innermost environment that
+// defines name. It fails if name is not bound anywhere or is a constant.
+func (e *Environment) Assign(name string, val Object) error {
+	for env := e; env != nil; env = env.outer {
+		if _, ok := env.store[name]; ok {
+			if env.consts[name] {
+				return fmt.Errorf("cannot assign to constant %s", name)
+			}
+			env.store[name] = val
+			return nil
+		}
+	}
+	return fmt.Errorf("identifier not found: %s", name)
+}
+
+// SetImporter sets the importer for the code of a file evaluated in e.
+func (e *Environment) SetImporter(importer Importer) {
+	e.importer = importer
+}
+
+// Importer returns the importer of the innermost environment that has
+// one, or nil.
+func (e *Environment) Importer() Importer {
+	for env := e; env != nil; env = env.outer {
+		if env.importer != nil {
+			return env.importer
+		}
+	}
+	return nil
+}
+
 func NewEnclosedEnvironment(outer *Environment) *Environment {
 	env := NewEnvironment()
 	env.outer = outer
@@ -227,8 +433,14 @@ func NewEnclosedEnvironment(outer *Environment) *Environment {
 
 type BuiltinFunction func(args ...Object) Object
 
+// CallFunction calls a Monkey function on behalf of a builtin.
+type CallFunction func(fn Object, args ...Object) Object
+
 type Builtin struct {
 	Fn BuiltinFunction
+	// HigherOrderFn is set instead of Fn by builtins, such as map, that
+	// call functions passed to them. The engine running it supplies call.
+	HigherOrderFn func(call CallFunction, args ...Object) Object
 }
 
 func (b *Builtin) Type() ObjectType { return BUILTIN_OBJ }
@@ -239,19 +451,7 @@ type Array struct {
 }
 
 func (ao *Array) Type() ObjectType { return ARRAY_OBJ }
-func (ao *Array) Inspect() string {
-	var out bytes.Buffer
-	elements := []string{}
-
-	for _, e := range ao.Elements {
-		elements = append(elements, e.Inspect())
-	}
-	out.WriteString("[")
-	out.WriteString(strings.Join(elements, ", "))
-	out.WriteString("]")
-
-	return out.String()
-}
+func (ao *Array) Inspect() string  { return inspect(ao, map[Object]bool{}) }
 
 type HashPair struct {
 	Key   Object
@@ -263,18 +463,55 @@ type Hash struct {
 }
 
 func (h *Hash) Type() ObjectType { return HASH_OBJ }
-func (h *Hash) Inspect() string {
-	var out bytes.Buffer
-	pairs := []string{}
-
-	for _, pair := range h.Pairs {
-		pairs = append(pairs, fmt.Sprintf("%s:%s", pair.Key.Inspect(), pair.Value.Inspect()))
+func (h *Hash) Inspect() string  { return inspect(h, map[Object]bool{}) }
+
+// inspect formats obj, tracking the collections being formatted in seen so
+// that one which contains itself is shown as "[...]" or "{...}" where it
+// recurs.
+func inspect(obj Object, seen map[Object]bool) string {
+	switch obj := obj.(type) {
+	case *Array:
+		if seen[obj] {
+			return "[...]"
+		}
+		seen[obj] = true
+		defer delete(seen, obj)
+
+		elements := []string{}
+		for _, e := range obj.Elements {
+			elements = append(elements, inspect(e, seen))
+		}
+		return "[" + strings.Join(elements, ", ") + "]"
+
+	case *Hash:
+		if seen[obj] {
+			return "{...}"
+		}
+		seen[obj] = true
+		defer delete(seen, obj)
+
+		pairs := []string{}
+		for _, pair := range obj.Pairs {
+			pairs = append(pairs, fmt.Sprintf("%s:%s", inspect(pair.Key, seen), inspect(pair.Value, seen)))
+		}
+		return "{" + strings.Join(pairs, ", ") + "}"
+
+	case *Struct:
+		if seen[obj] {
+			return obj.Def.Name + "{...}"
+		}
+		seen[obj] = true
+		defer delete(seen, obj)
+
+		fields := []string{}
+		for i, name := range obj.Def.Fields {
+			fields = append(fields, name+": "+inspect(obj.Values[i], seen))
+		}
+		return obj.Def.Name + "{" + strings.Join(fields, ", ") + "}"
+
+	default:
+		return obj.Inspect()
 	}
-	out.WriteString("{")
-	out.WriteString(strings.Join(pairs, ", "))
-	out.WriteString("}")
-
-	return out.String()
 }
 
 type Hashable interface {
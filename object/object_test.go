@@ -1,6 +1,9 @@
 package object
 
-import "testing"
+import (
+	"math"
+	"testing"
+)
 
 func TestStringHashKey(t *testing.T) {
 	hello1 := &String{Value: "Hello World"}
@@ -58,3 +61,171 @@ func TestIntegerHashKey(t *testing.T) {
 		t.Errorf("integers with twoerent content have same hash keys")
 	}
 }
+
+func TestFloatHashKey(t *testing.T) {
+	tests := []struct {
+		float   float64
+		integer int64
+		same    bool
+	}{
+		{1.0, 1, true},
+		{-3.0, -3, true},
+		{0.0, 0, true},
+		{math.Copysign(0, -1), 0, true},
+		{1.5, 1, false},
+		{1e19, math.MaxInt64, false},
+	}
+
+	for _, tt := range tests {
+		f := &Float{Value: tt.float}
+		i := &Integer{Value: tt.integer}
+		if (f.HashKey() == i.HashKey()) != tt.same {
+			t.Errorf("float %v and integer %d: same hash key want=%t", tt.float, tt.integer, tt.same)
+		}
+	}
+
+	if (&Float{Value: 1.5}).HashKey() != (&Float{Value: 1.5}).HashKey() {
+		t.Errorf("floats with same content have different hash keys")
+	}
+}
+
+func TestStringCodePoints(t *testing.T) {
+	s := &String{Value: "añb€"}
+
+	if s.Len() != 4 {
+		t.Errorf("s.Len() wrong. want=4, got=%d", s.Len())
+	}
+
+	expected := []string{"a", "ñ", "b", "€"}
+	for i, want := range expected {
+		char, ok := s.CharAt(int64(i))
+		if !ok {
+			t.Fatalf("s.CharAt(%d) out of range", i)
+		}
+		if char.Value != want {
+			t.Errorf("s.CharAt(%d) wrong. want=%q, got=%q", i, want, char.Value)
+		}
+	}
+	if _, ok := s.CharAt(4); ok {
+		t.Errorf("s.CharAt(4) should be out of range")
+	}
+}
+
+func TestFloatInspect(t *testing.T) {
+	tests := []struct {
+		value    float64
+		expected string
+	}{
+		{1.5, "1.5"},
+		{2, "2.0"},
+		{-0.25, "-0.25"},
+		{1e21, "1e+21"},
+		{math.Inf(1), "+Inf"},
+		{math.NaN(), "NaN"},
+	}
+
+	for _, tt := range tests {
+		f := &Float{Value: tt.value}
+		if f.Inspect() != tt.expected {
+			t.Errorf("wrong Inspect. want=%q, got=%q", tt.expected, f.Inspect())
+		}
+	}
+}
+
+func TestNumbers(t *testing.T) {
+	powTests := []struct {
+		base, exponent, expected int64
+	}{
+		{2, 0, 1},
+		{2, 10, 1024},
+		{-3, 3, -27},
+		{0, 5, 0},
+	}
+	for _, tt := range powTests {
+		if got := IntPow(tt.base, tt.exponent); got != tt.expected {
+			t.Errorf("IntPow(%d, %d) wrong. want=%d, got=%d", tt.base, tt.exponent, tt.expected, got)
+		}
+	}
+
+	if !IsNumber(&Integer{Value: 1}) || !IsNumber(&Float{Value: 1}) || IsNumber(&String{Value: "1"}) {
+		t.Errorf("IsNumber wrong")
+	}
+	if ToFloat(&Integer{Value: 3}) != 3 || ToFloat(&Float{Value: 2.5}) != 2.5 {
+		t.Errorf("ToFloat wrong")
+	}
+}
+
+func TestIterators(t *testing.T) {
+	hash := &Hash{Pairs: map[HashKey]HashPair{}}
+	for _, key := range []Object{&String{Value: "b"}, &Integer{Value: 10}, &Integer{Value: 2}, &String{Value: "a"}} {
+		hash.Pairs[key.(Hashable).HashKey()] = HashPair{Key: key, Value: key}
+	}
+
+	tests := []struct {
+		iterable Iterable
+		expected []string
+	}{
+		{&Array{Elements: []Object{&Integer{Value: 5}, &String{Value: "x"}}}, []string{"0:5", "1:x"}},
+		{&String{Value: "héllo"}, []string{"0:h", "1:é", "2:l", "3:l", "4:o"}},
+		{&Range{Start: 3, End: 6}, []string{"0:3", "1:4", "2:5"}},
+		{&Range{Start: 3, End: 1}, nil},
+		{hash, []string{"2:2", "10:10", "a:a", "b:b"}},
+	}
+
+	for _, tt := range tests {
+		var got []string
+		it := tt.iterable.NewIterator()
+		for {
+			key, value, ok := it.Next()
+			if !ok {
+				break
+			}
+			got = append(got, key.Inspect()+":"+value.Inspect())
+		}
+		if len(got) != len(tt.expected) {
+			t.Fatalf("wrong elements for %s. want=%v, got=%v", tt.iterable.Inspect(), tt.expected, got)
+		}
+		for i := range got {
+			if got[i] != tt.expected[i] {
+				t.Errorf("wrong elements for %s. want=%v, got=%v", tt.iterable.Inspect(), tt.expected, got)
+				break
+			}
+		}
+	}
+}
+
+func TestEnvironmentConstants(t *testing.T) {
+	outer := NewEnvironment()
+	if err := outer.Define("max", &Integer{Value: 1}, true); err != nil {
+		t.Fatalf("Define failed: %s", err)
+	}
+	inner := NewEnclosedEnvironment(outer)
+
+	tests := []struct {
+		err      error
+		expected string
+	}{
+		{outer.Define("max", &Integer{Value: 2}, false), "cannot redeclare constant max"},
+		{inner.Assign("max", &Integer{Value: 2}), "cannot assign to constant max"},
+		{inner.Assign("min", &Integer{Value: 2}), "identifier not found: min"},
+		{inner.Define("max", &Integer{Value: 3}, false), ""},
+		{inner.Assign("max", &Integer{Value: 4}), ""},
+	}
+
+	for i, tt := range tests {
+		got := ""
+		if tt.err != nil {
+			got = tt.err.Error()
+		}
+		if got != tt.expected {
+			t.Errorf("tests[%d] wrong error. want=%q, got=%q", i, tt.expected, got)
+		}
+	}
+
+	if value, _ := outer.Get("max"); value.Inspect() != "1" {
+		t.Errorf("constant changed to %s", value.Inspect())
+	}
+	if value, _ := inner.Get("max"); value.Inspect() != "4" {
+		t.Errorf("shadowing variable is %s, want 4", value.Inspect())
+	}
+}
@@ -0,0 +1,66 @@
+package object
+
+import "fmt"
+
+// Sliceable is implemented by the objects that support left[start:end].
+type Sliceable interface {
+	Object
+	Len() int
+	// Slice returns a new object holding the elements from lo up to but
+	// not including hi, where 0 <= lo <= hi <= Len().
+	Slice(lo, hi int) Object
+}
+
+func (ao *Array) Len() int { return len(ao.Elements) }
+
+func (ao *Array) Slice(lo, hi int) Object {
+	elements := make([]Object, hi-lo)
+	copy(elements, ao.Elements[lo:hi])
+	return &Array{Elements: elements}
+}
+
+func (i *String) Slice(lo, hi int) Object {
+	runes := []rune(i.Value)
+	return &String{Value: string(runes[lo:hi])}
+}
+
+// SliceBounds converts the bounds of a slice of an object of the given
+// length into indices that Slice accepts. Each bound is an integer, which
+// counts from the end if it is negative, or null if it was omitted. Bounds
+// past either end are clamped, and an end before the start gives an empty
+// slice.
+func SliceBounds(start, end Object, length int) (lo, hi int, err error) {
+	lo, err = sliceBound(start, 0, length)
+	if err != nil {
+		return 0, 0, err
+	}
+	hi, err = sliceBound(end, length, length)
+	if err != nil {
+		return 0, 0, err
+	}
+	if hi < lo {
+		hi = lo
+	}
+	return lo, hi, nil
+}
+
+func sliceBound(bound Object, omitted, length int) (int, error) {
+	switch bound := bound.(type) {
+	case *Null:
+		return omitted, nil
+	case *Integer:
+		i := bound.Value
+		if i < 0 {
+			i += int64(length)
+		}
+		if i < 0 {
+			return 0, nil
+		}
+		if i > int64(length) {
+			return length, nil
+		}
+		return int(i), nil
+	default:
+		return 0, fmt.Errorf("slice index must be an integer, got %s", bound.Type())
+	}
+}
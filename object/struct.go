@@ -0,0 +1,124 @@
+package object
+
+import "fmt"
+
+// StructType is the value a struct declaration binds: the constructor of
+// the struct's values, which takes one argument per field.
+type StructType struct {
+	Name   string
+	Fields []string
+	index  map[string]int
+}
+
+func NewStructType(name string, fields []string) *StructType {
+	index := make(map[string]int, len(fields))
+	for i, field := range fields {
+		index[field] = i
+	}
+	return &StructType{Name: name, Fields: fields, index: index}
+}
+
+func (st *StructType) Type() ObjectType { return STRUCT_TYPE_OBJ }
+func (st *StructType) Inspect() string  { return "struct " + st.Name }
+
+// New returns a value of the struct with the given field values, or an
+// error if there is not exactly one for each field.
+func (st *StructType) New(values []Object) (*Struct, error) {
+	if len(values) != len(st.Fields) {
+		return nil, fmt.Errorf("wrong number of arguments. want=%d, got=%d", len(st.Fields), len(values))
+	}
+	return &Struct{Def: st, Values: append([]Object{}, values...)}, nil
+}
+
+// Struct is a value of a struct type. Values holds its fields in the order
+// they were declared.
+type Struct struct {
+	Def    *StructType
+	Values []Object
+}
+
+func (s *Struct) Type() ObjectType { return STRUCT_OBJ }
+func (s *Struct) Inspect() string  { return inspect(s, map[Object]bool{}) }
+
+// Field returns the value of the field name, or an error if the struct has
+// no such field.
+func (s *Struct) Field(name string) (Object, error) {
+	i, ok := s.Def.index[name]
+	if !ok {
+		return nil, fmt.Errorf("struct %s has no field %s", s.Def.Name, name)
+	}
+	return s.Values[i], nil
+}
+
+// SetField sets the field name, which must exist, to value.
+func (s *Struct) SetField(name string, value Object) error {
+	i, ok := s.Def.index[name]
+	if !ok {
+		return fmt.Errorf("struct %s has no field %s", s.Def.Name, name)
+	}
+	s.Values[i] = value
+	return nil
+}
+
+// Equal reports whether s and other are values of structs with the same
+// name and fields whose field values are equal. Fields are compared as ==
+// compares them, except that struct fields are compared structurally.
+func (s *Struct) Equal(other *Struct) bool {
+	return equalStructs(s, other, map[[2]*Struct]bool{})
+}
+
+// equalStructs compares a and b, assuming the pairs of structs being
+// compared in seen to be equal, so that cyclic structs compare equal when
+// their shapes are.
+func equalStructs(a, b *Struct, seen map[[2]*Struct]bool) bool {
+	if a == b || seen[[2]*Struct{a, b}] {
+		return true
+	}
+	if a.Def.Name != b.Def.Name || len(a.Def.Fields) != len(b.Def.Fields) {
+		return false
+	}
+	for i, field := range a.Def.Fields {
+		if b.Def.Fields[i] != field {
+			return false
+		}
+	}
+	seen[[2]*Struct{a, b}] = true
+	for i := range a.Values {
+		if !equalValues(a.Values[i], b.Values[i], seen) {
+			return false
+		}
+	}
+	return true
+}
+
+func equalValues(a, b Object, seen map[[2]*Struct]bool) bool {
+	switch a := a.(type) {
+	case *Integer:
+		switch b := b.(type) {
+		case *Integer:
+			return a.Value == b.Value
+		case *Float:
+			return float64(a.Value) == b.Value
+		}
+	case *Float:
+		switch b := b.(type) {
+		case *Integer:
+			return a.Value == float64(b.Value)
+		case *Float:
+			return a.Value == b.Value
+		}
+	case *String:
+		b, ok := b.(*String)
+		return ok && a.Value == b.Value
+	case *Boolean:
+		b, ok := b.(*Boolean)
+		return ok && a.Value == b.Value
+	case *Null:
+		_, ok := b.(*Null)
+		return ok
+	case *Struct:
+		b, ok := b.(*Struct)
+		return ok && equalStructs(a, b, seen)
+	}
+	return a == b
+}
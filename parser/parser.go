@@ -1,43 +1,98 @@
 package parser
 
 import (
+	"errors"
 	"fmt"
 	"monkey/ast"
+	"monkey/diagnostic"
 	"monkey/lexer"
 	"monkey/token"
 	"strconv"
+	"strings"
 )
 
 const (
 	_ int = iota
 	LOWEST
+	ASSIGN      // = or +=
+	NULLISH     // ??
+	LOGICAL_OR  // ||
+	LOGICAL_AND // &&
 	EQUALS      // ==
 	LESSGREATER // > or <
+	RANGE       // ..
+	BIT_OR      // |
+	BIT_XOR     // ^
+	BIT_AND     // &
+	SHIFT       // << or >>
 	SUM         // +
 	PRODUCT     // *
 	PREFIX      // -X or !X
+	POWER       // **
 	CALL        // myFunction(X)
 	INDEX       // array[index]
 )
 
 var precedences = map[token.TokenType]int{
-	token.EQ:       EQUALS,
-	token.NOT_EQ:   EQUALS,
-	token.LT:       LESSGREATER,
-	token.GT:       LESSGREATER,
-	token.PLUS:     SUM,
-	token.MINUS:    SUM,
-	token.SLASH:    PRODUCT,
-	token.ASTERISK: PRODUCT,
-	token.LPAREN:   CALL,
-	token.LBRACKET: INDEX,
+	token.ASSIGN:           ASSIGN,
+	token.PLUS_ASSIGN:      ASSIGN,
+	token.MINUS_ASSIGN:     ASSIGN,
+	token.ASTERISK_ASSIGN:  ASSIGN,
+	token.SLASH_ASSIGN:     ASSIGN,
+	token.NULLISH:          NULLISH,
+	token.OR:               LOGICAL_OR,
+	token.AND:              LOGICAL_AND,
+	token.EQ:               EQUALS,
+	token.NOT_EQ:           EQUALS,
+	token.LT:               LESSGREATER,
+	token.GT:               LESSGREATER,
+	token.LT_EQ:            LESSGREATER,
+	token.GT_EQ:            LESSGREATER,
+	token.DOTDOT:           RANGE,
+	token.PIPE:             BIT_OR,
+	token.CARET:            BIT_XOR,
+	token.AMPERSAND:        BIT_AND,
+	token.SHL:              SHIFT,
+	token.SHR:              SHIFT,
+	token.PLUS:             SUM,
+	token.MINUS:            SUM,
+	token.SLASH:            PRODUCT,
+	token.ASTERISK:         PRODUCT,
+	token.PERCENT:          PRODUCT,
+	token.POWER:            POWER,
+	token.LPAREN:           CALL,
+	token.LBRACKET:         INDEX,
+	token.DOT:              INDEX,
+	token.QUESTION_DOT:     INDEX,
+	token.QUESTION_BRACKET: INDEX,
 }
 
 type Parser struct {
-	l         *lexer.Lexer
-	curToken  token.Token
-	peekToken token.Token
-	errors    []string
+	l           *lexer.Lexer
+	curToken    token.Token
+	peekToken   token.Token
+	diagnostics []diagnostic.Diagnostic
+	comments    []token.Comment
+
+	// recovering is set after an error and cleared once the parser has
+	// skipped to the next statement boundary. Errors reported while
+	// recovering are dropped, as they are almost always follow-on errors.
+	recovering bool
+
+	// loopDepth counts the loops enclosing the current token within the
+	// current function, so break and continue can be checked.
+	loopDepth int
+
+	// valueDepth counts the expressions enclosing the current token within
+	// the innermost loop or function whose value is in use. Break and
+	// continue may not leave such an expression half evaluated.
+	valueDepth int
+	// statement is set while the expression of an expression statement is
+	// about to be parsed, as its value is not in use.
+	statement bool
+
+	// braceDepth counts the braces open at the current token.
+	braceDepth int
 
 	prefixParseFns map[token.TokenType]prefixParseFn
 	infixParseFns  map[token.TokenType]infixParseFn
@@ -52,6 +107,13 @@ func (p *Parser) registerInfix(tokenType token.TokenType, fn infixParseFn) {
 }
 
 func (p *Parser) parseExpression(precedence int) ast.Expression {
+	if p.statement {
+		p.statement = false
+	} else {
+		p.valueDepth++
+		defer func() { p.valueDepth-- }()
+	}
+
 	prefix := p.prefixParseFns[p.curToken.Type]
 	if prefix == nil {
 		p.noPrefixParseFnError(p.curToken.Type)
@@ -73,7 +135,7 @@ func (p *Parser) parseExpression(precedence int) ast.Expression {
 
 func New(l *lexer.Lexer) *Parser {
 
-	p := &Parser{l: l, errors: []string{}}
+	p := &Parser{l: l}
 
 	p.infixParseFns = make(map[token.TokenType]infixParseFn)
 
@@ -86,23 +148,51 @@ func New(l *lexer.Lexer) *Parser {
 	p.registerInfix(token.NOT_EQ, p.parseInfixExpression)
 	p.registerInfix(token.LT, p.parseInfixExpression)
 	p.registerInfix(token.GT, p.parseInfixExpression)
+	p.registerInfix(token.LT_EQ, p.parseInfixExpression)
+	p.registerInfix(token.GT_EQ, p.parseInfixExpression)
+	p.registerInfix(token.PERCENT, p.parseInfixExpression)
+	p.registerInfix(token.POWER, p.parseInfixExpression)
+	p.registerInfix(token.AMPERSAND, p.parseInfixExpression)
+	p.registerInfix(token.PIPE, p.parseInfixExpression)
+	p.registerInfix(token.CARET, p.parseInfixExpression)
+	p.registerInfix(token.SHL, p.parseInfixExpression)
+	p.registerInfix(token.SHR, p.parseInfixExpression)
+	p.registerInfix(token.DOTDOT, p.parseInfixExpression)
+	p.registerInfix(token.AND, p.parseInfixExpression)
+	p.registerInfix(token.OR, p.parseInfixExpression)
+	p.registerInfix(token.NULLISH, p.parseInfixExpression)
+	p.registerInfix(token.ASSIGN, p.parseAssignExpression)
+	p.registerInfix(token.PLUS_ASSIGN, p.parseAssignExpression)
+	p.registerInfix(token.MINUS_ASSIGN, p.parseAssignExpression)
+	p.registerInfix(token.ASTERISK_ASSIGN, p.parseAssignExpression)
+	p.registerInfix(token.SLASH_ASSIGN, p.parseAssignExpression)
 	p.registerInfix(token.LPAREN, p.parseCallExpression)
 	p.registerInfix(token.LBRACKET, p.parseIndexExpression)
+	p.registerInfix(token.DOT, p.parseDotExpression)
+	p.registerInfix(token.QUESTION_DOT, p.parseDotExpression)
+	p.registerInfix(token.QUESTION_BRACKET, p.parseIndexExpression)
 
 	p.prefixParseFns = make(map[token.TokenType]prefixParseFn)
 	p.registerPrefix(token.IDENT, p.parseIdentifier)
 	p.registerPrefix(token.INT, p.parseIntegerLiteral)
+	p.registerPrefix(token.FLOAT, p.parseFloatLiteral)
 	p.registerPrefix(token.BANG, p.parsePrefixExpression)
 	p.registerPrefix(token.MINUS, p.parsePrefixExpression)
+	p.registerPrefix(token.TILDE, p.parsePrefixExpression)
 	p.registerPrefix(token.TRUE, p.parseBoolean)
+	p.registerPrefix(token.NULL, p.parseNullLiteral)
 	p.registerPrefix(token.FALSE, p.parseBoolean)
 	p.registerPrefix(token.LPAREN, p.parseGroupedExpression)
 	p.registerPrefix(token.IF, p.parseIfExpression)
+	p.registerPrefix(token.MATCH, p.parseMatchExpression)
+	p.registerPrefix(token.TRY, p.parseTryExpression)
 	p.registerPrefix(token.FUNCTION, p.parseFunctionLiteral)
 	p.registerPrefix(token.STRING, p.parseStringLiteral)
+	p.registerPrefix(token.INTERP_START, p.parseInterpolatedString)
 	p.registerPrefix(token.LBRACKET, p.parseArrayLiteral)
 	p.registerPrefix(token.LBRACE, p.parseHashLiteral)
 	p.registerPrefix(token.MACRO, p.parseMacroLiteral)
+	p.registerPrefix(token.ILLEGAL, p.parseIllegal)
 
 	// Read two tokens to set curToken and peekToken
 	p.nextToken()
@@ -111,6 +201,13 @@ func New(l *lexer.Lexer) *Parser {
 	return p
 }
 
+// parseIllegal skips a token the lexer could not make sense of. The lexer has
+// already reported it, so the parser only needs to resynchronize.
+func (p *Parser) parseIllegal() ast.Expression {
+	p.recovering = true
+	return nil
+}
+
 func (p *Parser) parseMacroLiteral() ast.Expression {
 	lit := &ast.MacroLiteral{Token: p.curToken}
 
@@ -124,7 +221,7 @@ func (p *Parser) parseMacroLiteral() ast.Expression {
 		return nil
 	}
 
-	lit.Body = p.parseBlockStatement()
+	lit.Body = p.parseFunctionBody()
 
 	return lit
 }
@@ -159,9 +256,55 @@ func (p *Parser) parseHashLiteral() ast.Expression {
 }
 
 func (p *Parser) parseIndexExpression(left ast.Expression) ast.Expression {
-	exp := &ast.IndexExpression{Token: p.curToken, Left: left}
+	exp := &ast.IndexExpression{Token: p.curToken, Left: left, Optional: p.curTokenIs(token.QUESTION_BRACKET)}
+	if p.peekTokenIs(token.COLON) {
+		return p.parseSliceExpression(exp.Token, left, nil)
+	}
+
 	p.nextToken()
 	exp.Index = p.parseExpression(LOWEST)
+	if p.peekTokenIs(token.COLON) {
+		return p.parseSliceExpression(exp.Token, left, exp.Index)
+	}
+
+	if !p.expectPeek(token.RBRACKET) {
+		return nil
+	}
+
+	return exp
+}
+
+// parseDotExpression parses left.name, which is short for left["name"], and
+// the method call left.name(arguments), or their optional forms with "?.".
+func (p *Parser) parseDotExpression(left ast.Expression) ast.Expression {
+	tok := p.curToken
+	optional := tok.Type == token.QUESTION_DOT
+	if !p.expectPeek(token.IDENT) {
+		return nil
+	}
+	name := &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
+
+	if p.peekTokenIs(token.LPAREN) {
+		p.nextToken()
+		exp := &ast.MethodCallExpression{Token: tok, Receiver: left, Method: name, Optional: optional}
+		exp.Arguments = p.parseExpressionList(token.RPAREN)
+		return exp
+	}
+
+	key := &ast.StringLiteral{Token: name.Token, Value: name.Value}
+	return &ast.IndexExpression{Token: tok, Left: left, Index: key, Optional: optional, Dot: true}
+}
+
+// parseSliceExpression parses the rest of left[start:end] from the colon,
+// which is the peek token.
+func (p *Parser) parseSliceExpression(tok token.Token, left, start ast.Expression) ast.Expression {
+	exp := &ast.SliceExpression{Token: tok, Left: left, Start: start, Optional: tok.Type == token.QUESTION_BRACKET}
+	p.nextToken()
+
+	if !p.peekTokenIs(token.RBRACKET) {
+		p.nextToken()
+		exp.End = p.parseExpression(LOWEST)
+	}
 
 	if !p.expectPeek(token.RBRACKET) {
 		return nil
@@ -186,12 +329,12 @@ func (p *Parser) parseExpressionList(end token.TokenType) []ast.Expression {
 	}
 
 	p.nextToken()
-	list = append(list, p.parseExpression(LOWEST))
+	list = append(list, p.parseListElement())
 
 	for p.peekTokenIs(token.COMMA) {
 		p.nextToken()
 		p.nextToken()
-		list = append(list, p.parseExpression(LOWEST))
+		list = append(list, p.parseListElement())
 	}
 
 	if !p.expectPeek(end) {
@@ -201,6 +344,18 @@ func (p *Parser) parseExpressionList(end token.TokenType) []ast.Expression {
 	return list
 }
 
+// parseListElement parses an element of an array literal or argument list,
+// which may spread an array with "...".
+func (p *Parser) parseListElement() ast.Expression {
+	if !p.curTokenIs(token.ELLIPSIS) {
+		return p.parseExpression(LOWEST)
+	}
+	spread := &ast.SpreadExpression{Token: p.curToken}
+	p.nextToken()
+	spread.Value = p.parseExpression(LOWEST)
+	return spread
+}
+
 func (p *Parser) parseCallExpression(function ast.Expression) ast.Expression {
 	exp := &ast.CallExpression{Token: p.curToken, Function: function}
 	exp.Arguments = p.parseExpressionList(token.RPAREN)
@@ -211,19 +366,53 @@ func (p *Parser) parseStringLiteral() ast.Expression {
 	return &ast.StringLiteral{Token: p.curToken, Value: p.curToken.Literal}
 }
 
+func (p *Parser) parseInterpolatedString() ast.Expression {
+	str := &ast.InterpolatedString{Token: p.curToken}
+	str.Parts = appendStringPart(str.Parts, p.curToken)
+
+	for {
+		p.nextToken()
+		expr := p.parseExpression(LOWEST)
+		if expr == nil {
+			return nil
+		}
+		str.Parts = append(str.Parts, expr)
+
+		if p.peekTokenIs(token.INTERP_MID) {
+			p.nextToken()
+			str.Parts = appendStringPart(str.Parts, p.curToken)
+			continue
+		}
+		if !p.expectPeek(token.INTERP_END) {
+			return nil
+		}
+		str.Parts = appendStringPart(str.Parts, p.curToken)
+		return str
+	}
+}
+
+func appendStringPart(parts []ast.Expression, tok token.Token) []ast.Expression {
+	if tok.Literal == "" {
+		return parts
+	}
+	return append(parts, &ast.StringLiteral{Token: tok, Value: tok.Literal})
+}
+
 func (p *Parser) parseFunctionLiteral() ast.Expression {
 	lit := &ast.FunctionLiteral{Token: p.curToken}
 	if !p.expectPeek(token.LPAREN) {
 		return nil
 	}
 
-	lit.Parameters = p.parseFunctionParameters()
+	if !p.parseParameterList(lit) {
+		return nil
+	}
 
 	if !p.expectPeek(token.LBRACE) {
 		return nil
 	}
 
-	lit.Body = p.parseBlockStatement()
+	lit.Body = p.parseFunctionBody()
 
 	return lit
 }
@@ -236,17 +425,18 @@ func (p *Parser) parseFunctionParameters() []*ast.Identifier {
 		return identifiers
 	}
 
-	p.nextToken()
-
-	ident := &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
-	identifiers = append(identifiers, ident)
-
-	for p.peekTokenIs(token.COMMA) {
-		p.nextToken()
+	for {
 		p.nextToken()
-		ident := &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
-		identifiers = append(identifiers, ident)
+		if !p.curTokenIs(token.IDENT) {
+			p.errorAt(p.curToken, diagnostic.UnexpectedToken, "expected a parameter, got %s", describeToken(p.curToken))
+			return nil
+		}
+		identifiers = append(identifiers, &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal})
 
+		if !p.peekTokenIs(token.COMMA) {
+			break
+		}
+		p.nextToken()
 	}
 
 	if !p.expectPeek(token.RPAREN) {
@@ -256,6 +446,75 @@ func (p *Parser) parseFunctionParameters() []*ast.Identifier {
 	return identifiers
 }
 
+// parseParameterList parses the parameters of a function literal. Each may
+// be an identifier or a destructuring pattern, optionally followed by
+// "= default"; once one parameter has a default, the rest must too. A
+// final "...name" collects any remaining arguments.
+func (p *Parser) parseParameterList(lit *ast.FunctionLiteral) bool {
+	lit.Parameters = []*ast.Identifier{}
+
+	if p.peekTokenIs(token.RPAREN) {
+		p.nextToken()
+		return true
+	}
+
+	for {
+		p.nextToken()
+		i := len(lit.Parameters)
+		switch {
+		case p.curTokenIs(token.IDENT):
+			lit.Parameters = append(lit.Parameters, &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal})
+		case p.curTokenIs(token.LBRACKET) || p.curTokenIs(token.LBRACE):
+			if lit.Patterns == nil {
+				lit.Patterns = make([]ast.Expression, i)
+			}
+			placeholder := &ast.Identifier{Token: p.curToken, Value: fmt.Sprintf("$param%d", i)}
+			lit.Parameters = append(lit.Parameters, placeholder)
+			pattern := p.parsePattern()
+			if pattern == nil {
+				return false
+			}
+			lit.Patterns = append(lit.Patterns, pattern)
+		case p.curTokenIs(token.ELLIPSIS):
+			if !p.expectPeek(token.IDENT) {
+				return false
+			}
+			lit.Rest = &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
+			if !p.peekTokenIs(token.RPAREN) {
+				p.errorAt(p.peekToken, diagnostic.InvalidParameter, "a rest parameter must come last")
+				return false
+			}
+			p.nextToken()
+			return true
+		default:
+			p.errorAt(p.curToken, diagnostic.UnexpectedToken, "expected a parameter, got %s", describeToken(p.curToken))
+			return false
+		}
+		if lit.Patterns != nil && len(lit.Patterns) == i {
+			lit.Patterns = append(lit.Patterns, nil)
+		}
+
+		if p.peekTokenIs(token.ASSIGN) {
+			p.nextToken()
+			p.nextToken()
+			if lit.Defaults == nil {
+				lit.Defaults = make([]ast.Expression, i)
+			}
+			lit.Defaults = append(lit.Defaults, p.parseExpression(LOWEST))
+		} else if lit.Defaults != nil {
+			p.errorAt(lit.Parameters[i].Token, diagnostic.InvalidParameter, "a parameter without a default cannot follow one with a default")
+			return false
+		}
+
+		if !p.peekTokenIs(token.COMMA) {
+			break
+		}
+		p.nextToken()
+	}
+
+	return p.expectPeek(token.RPAREN)
+}
+
 func (p *Parser) parseIfExpression() ast.Expression {
 	expression := &ast.IfExpression{Token: p.curToken}
 	if !p.expectPeek(token.LPAREN) {
@@ -289,6 +548,7 @@ func (p *Parser) parseIfExpression() ast.Expression {
 func (p *Parser) parseBlockStatement() *ast.BlockStatement {
 	block := &ast.BlockStatement{Token: p.curToken}
 	block.Statements = []ast.Statement{}
+	depth := p.braceDepth
 
 	p.nextToken()
 	for !p.curTokenIs(token.RBRACE) && !p.curTokenIs(token.EOF) {
@@ -296,6 +556,12 @@ func (p *Parser) parseBlockStatement() *ast.BlockStatement {
 		if stmt != nil {
 			block.Statements = append(block.Statements, stmt)
 		}
+		if p.recovering {
+			p.synchronize(depth)
+			if p.curTokenIs(token.RBRACE) {
+				break
+			}
+		}
 		p.nextToken()
 	}
 	return block
@@ -324,14 +590,45 @@ func (p *Parser) parseBoolean() ast.Expression {
 	return &ast.Boolean{Token: p.curToken, Value: p.curTokenIs(token.TRUE)}
 }
 
+func (p *Parser) parseNullLiteral() ast.Expression {
+	return &ast.NullLiteral{Token: p.curToken}
+}
+
 func (p *Parser) parseInfixExpression(left ast.Expression) ast.Expression {
 	expression := &ast.InfixExpression{Token: p.curToken, Operator: p.curToken.Literal, Left: left}
 	precedence := p.curPrecedence()
+	if p.curTokenIs(token.POWER) {
+		precedence-- // ** is right-associative
+	}
 	p.nextToken()
 	expression.Right = p.parseExpression(precedence)
 	return expression
 }
 
+func (p *Parser) parseAssignExpression(target ast.Expression) ast.Expression {
+	expression := &ast.AssignExpression{Token: p.curToken, Target: target}
+	switch target := target.(type) {
+	case *ast.Identifier:
+	case *ast.IndexExpression:
+		if target.Optional {
+			p.errorAt(p.curToken, diagnostic.InvalidAssignment, "cannot assign to optional access %s", target.String())
+			return nil
+		}
+	default:
+		p.errorAt(p.curToken, diagnostic.InvalidAssignment, "cannot assign to %s", target.String())
+		return nil
+	}
+	expression.Operator = strings.TrimSuffix(p.curToken.Literal, "=")
+
+	// Assignment is right-associative: a = b = c is a = (b = c).
+	p.nextToken()
+	expression.Value = p.parseExpression(ASSIGN - 1)
+	if expression.Value == nil {
+		return nil
+	}
+	return expression
+}
+
 func (p *Parser) peekPrecedence() int {
 	if p, ok := precedences[p.peekToken.Type]; ok {
 		return p
@@ -350,18 +647,94 @@ func (p *Parser) parseIdentifier() ast.Expression {
 	return &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
 }
 
+// Errors returns the lexer and parser error messages, each prefixed with the
+// position it refers to.
 func (p *Parser) Errors() []string {
-	return p.errors
+	errors := []string{}
+	for _, d := range p.Diagnostics() {
+		if d.Severity != diagnostic.Error {
+			continue
+		}
+		msg := d.Message
+		if d.Start.IsValid() {
+			msg = d.Start.String() + ": " + msg
+		}
+		errors = append(errors, msg)
+	}
+	return errors
+}
+
+// Diagnostics returns everything the lexer and parser reported, ordered by
+// position.
+func (p *Parser) Diagnostics() []diagnostic.Diagnostic {
+	diagnostics := append([]diagnostic.Diagnostic{}, p.l.Diagnostics()...)
+	diagnostics = append(diagnostics, p.diagnostics...)
+	diagnostic.Sort(diagnostics)
+	return diagnostics
 }
 
 func (p *Parser) peekError(t token.TokenType) {
-	msg := fmt.Sprintf("expected next token to be %s, got %s instead", t, p.peekToken.Type)
-	p.errors = append(p.errors, msg)
+	p.errorAt(p.peekToken, diagnostic.UnexpectedToken,
+		"expected next token to be %s, got %s instead", t, describeToken(p.peekToken))
+}
+
+// errorAt reports an error spanning tok and puts the parser into recovery
+// mode. Nothing is reported while the parser is already recovering.
+func (p *Parser) errorAt(tok token.Token, code diagnostic.Code, format string, a ...interface{}) {
+	if p.recovering {
+		return
+	}
+	p.recovering = true
+	p.diagnostics = append(p.diagnostics, diagnostic.Diagnostic{
+		Severity: diagnostic.Error,
+		Code:     code,
+		Message:  fmt.Sprintf(format, a...),
+		Start:    tok.Pos,
+		End:      tok.End,
+	})
+}
+
+// synchronize skips ahead to the end of the statement that contained an
+// error: a ';' or the token before a '}' that closes the enclosing block,
+// whose braces are depth deep. Braces the statement opened, before or after
+// the error, are matched so that they do not end recovery early.
+func (p *Parser) synchronize(depth int) {
+	for !p.curTokenIs(token.EOF) && p.braceDepth >= depth {
+		if p.braceDepth == depth && (p.curTokenIs(token.SEMICOLON) ||
+			p.peekTokenIs(token.RBRACE) || p.peekTokenIs(token.EOF)) {
+			break
+		}
+		p.nextToken()
+	}
+	p.recovering = false
+}
+
+func describeToken(tok token.Token) string {
+	switch tok.Type {
+	case token.EOF:
+		return "end of input"
+	case token.IDENT, token.INT, token.FLOAT, token.STRING, token.ILLEGAL,
+		token.INTERP_START, token.INTERP_MID, token.INTERP_END:
+		return fmt.Sprintf("%s %q", tok.Type, tok.Literal)
+	default:
+		return string(tok.Type)
+	}
 }
 
 func (p *Parser) nextToken() {
 	p.curToken = p.peekToken
+	switch p.curToken.Type {
+	case token.LBRACE:
+		p.braceDepth++
+	case token.RBRACE:
+		// An unmatched '}' at the top level opens nothing to close.
+		if p.braceDepth > 0 {
+			p.braceDepth--
+		}
+	}
 	p.peekToken = p.l.NextToken()
+	p.comments = append(p.comments, p.peekToken.Leading...)
+	p.comments = append(p.comments, p.peekToken.Trailing...)
 }
 
 func (p *Parser) ParseProgram() *ast.Program {
@@ -373,25 +746,57 @@ func (p *Parser) ParseProgram() *ast.Program {
 		if stmt != nil {
 			program.Statements = append(program.Statements, stmt)
 		}
+		if p.recovering {
+			p.synchronize(0)
+		}
 		p.nextToken()
 	}
+	program.Comments = p.comments
 	return program
 }
 
 func (p *Parser) parseStatement() ast.Statement {
 	switch p.curToken.Type {
-	case token.LET:
-		return p.parseLetStatement()
+	case token.LET, token.CONST:
+		if stmt := p.parseLetStatement(); stmt != nil {
+			return stmt
+		}
+		return nil
 	case token.RETURN:
 		return p.parseReturnStatement()
+	case token.WHILE:
+		if stmt := p.parseWhileStatement(); stmt != nil {
+			return stmt
+		}
+		return nil
+	case token.FOR:
+		return p.parseForStatement()
+	case token.BREAK:
+		return p.parseBreakStatement()
+	case token.CONTINUE:
+		return p.parseContinueStatement()
+	case token.THROW:
+		return p.parseThrowStatement()
+	case token.IMPORT:
+		if stmt := p.parseImportStatement(); stmt != nil {
+			return stmt
+		}
+		return nil
+	case token.EXPORT:
+		return p.parseExportStatement()
+	case token.STRUCT:
+		if stmt := p.parseStructStatement(); stmt != nil {
+			return stmt
+		}
+		return nil
 	default:
 		return p.parseExpressionStatement()
 	}
 }
 
 func (p *Parser) noPrefixParseFnError(t token.TokenType) {
-	msg := fmt.Sprintf("no prefix parse function for %s found", t)
-	p.errors = append(p.errors, msg)
+	p.errorAt(p.curToken, diagnostic.MissingExpression,
+		"expected an expression, got %s", describeToken(p.curToken))
 }
 
 func (p *Parser) parseReturnStatement() *ast.ReturnStatement {
@@ -407,13 +812,346 @@ func (p *Parser) parseReturnStatement() *ast.ReturnStatement {
 	return stmt
 }
 
+func (p *Parser) parseThrowStatement() *ast.ThrowStatement {
+	stmt := &ast.ThrowStatement{Token: p.curToken}
+
+	p.nextToken()
+
+	stmt.Value = p.parseExpression(LOWEST)
+
+	if p.peekTokenIs(token.SEMICOLON) {
+		p.nextToken()
+	}
+	return stmt
+}
+
+func (p *Parser) parseImportStatement() *ast.ImportStatement {
+	stmt := &ast.ImportStatement{Token: p.curToken}
+	p.checkTopLevel()
+
+	if !p.expectPeek(token.STRING) {
+		return nil
+	}
+	stmt.Path = p.curToken.Literal
+	if !p.expectPeek(token.AS) {
+		return nil
+	}
+	if !p.expectPeek(token.IDENT) {
+		return nil
+	}
+	stmt.Name = &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
+
+	if p.peekTokenIs(token.SEMICOLON) {
+		p.nextToken()
+	}
+	return stmt
+}
+
+func (p *Parser) parseExportStatement() ast.Statement {
+	p.checkTopLevel()
+	p.nextToken()
+	switch p.curToken.Type {
+	case token.LET, token.CONST:
+		if stmt := p.parseLetStatement(); stmt != nil {
+			stmt.Export = true
+			return stmt
+		}
+	case token.STRUCT:
+		if stmt := p.parseStructStatement(); stmt != nil {
+			stmt.Export = true
+			return stmt
+		}
+	default:
+		p.errorAt(p.curToken, diagnostic.UnexpectedToken, "expected let, const or struct, got %s", describeToken(p.curToken))
+	}
+	return nil
+}
+
+func (p *Parser) parseStructStatement() *ast.StructStatement {
+	stmt := &ast.StructStatement{Token: p.curToken}
+	if !p.expectPeek(token.IDENT) {
+		return nil
+	}
+	stmt.Name = &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
+	if !p.expectPeek(token.LBRACE) {
+		return nil
+	}
+
+	stmt.Fields = []*ast.Identifier{}
+	seen := map[string]bool{}
+	for !p.peekTokenIs(token.RBRACE) {
+		if !p.expectPeek(token.IDENT) {
+			return nil
+		}
+		field := &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
+		if seen[field.Value] {
+			p.errorAt(p.curToken, diagnostic.DuplicateField, "duplicate field %s in struct %s", field.Value, stmt.Name.Value)
+		} else {
+			seen[field.Value] = true
+			stmt.Fields = append(stmt.Fields, field)
+		}
+		if !p.peekTokenIs(token.RBRACE) && !p.expectPeek(token.COMMA) {
+			return nil
+		}
+	}
+	p.nextToken()
+
+	if p.peekTokenIs(token.SEMICOLON) {
+		p.nextToken()
+	}
+	return stmt
+}
+
+// checkTopLevel reports an error if the current import or export token is
+// inside a block.
+func (p *Parser) checkTopLevel() {
+	if p.braceDepth > 0 {
+		p.errorAt(p.curToken, diagnostic.NotTopLevel, "%s is only allowed at the top level", p.curToken.Literal)
+	}
+}
+
+func (p *Parser) parseTryExpression() ast.Expression {
+	expression := &ast.TryExpression{Token: p.curToken}
+	if !p.expectPeek(token.LBRACE) {
+		return nil
+	}
+	expression.Block = p.parseBlockStatement()
+
+	if p.peekTokenIs(token.CATCH) {
+		p.nextToken()
+		if !p.expectPeek(token.LPAREN) || !p.expectPeek(token.IDENT) {
+			return nil
+		}
+		expression.CatchParam = &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
+		if !p.expectPeek(token.RPAREN) || !p.expectPeek(token.LBRACE) {
+			return nil
+		}
+		expression.Catch = p.parseBlockStatement()
+	}
+
+	if p.peekTokenIs(token.FINALLY) {
+		p.nextToken()
+		if !p.expectPeek(token.LBRACE) {
+			return nil
+		}
+		expression.Finally = p.parseBlockStatement()
+	}
+
+	if expression.Catch == nil && expression.Finally == nil {
+		p.errorAt(p.peekToken, diagnostic.UnexpectedToken, "expected catch or finally, got %s", describeToken(p.peekToken))
+		return nil
+	}
+
+	return expression
+}
+
+func (p *Parser) parseWhileStatement() *ast.WhileStatement {
+	stmt := &ast.WhileStatement{Token: p.curToken}
+	if !p.expectPeek(token.LPAREN) {
+		return nil
+	}
+
+	p.nextToken()
+	stmt.Condition = p.parseExpression(LOWEST)
+
+	if !p.expectPeek(token.RPAREN) {
+		return nil
+	}
+
+	if !p.expectPeek(token.LBRACE) {
+		return nil
+	}
+
+	stmt.Body = p.parseLoopBody()
+
+	if p.peekTokenIs(token.SEMICOLON) {
+		p.nextToken()
+	}
+	return stmt
+}
+
+// parseForStatement parses both C-style and for-in loops, which share the
+// "for (" prefix.
+func (p *Parser) parseForStatement() ast.Statement {
+	tok := p.curToken
+	if !p.expectPeek(token.LPAREN) {
+		return nil
+	}
+
+	p.nextToken()
+	if p.curTokenIs(token.IDENT) && (p.peekTokenIs(token.IN) || p.peekTokenIs(token.COMMA)) {
+		if stmt := p.parseForInStatement(tok); stmt != nil {
+			return stmt
+		}
+		return nil
+	}
+
+	stmt := &ast.ForStatement{Token: tok}
+	if !p.curTokenIs(token.SEMICOLON) {
+		if p.curTokenIs(token.LET) {
+			if init := p.parseLetStatement(); init != nil {
+				stmt.Init = init
+			}
+		} else {
+			stmt.Init = p.parseExpressionStatement()
+		}
+		if !p.curTokenIs(token.SEMICOLON) {
+			p.peekError(token.SEMICOLON)
+			return nil
+		}
+	}
+
+	if !p.peekTokenIs(token.SEMICOLON) {
+		p.nextToken()
+		stmt.Condition = p.parseExpression(LOWEST)
+	}
+	if !p.expectPeek(token.SEMICOLON) {
+		return nil
+	}
+
+	if !p.peekTokenIs(token.RPAREN) {
+		p.nextToken()
+		stmt.Step = p.parseExpression(LOWEST)
+	}
+	if !p.expectPeek(token.RPAREN) {
+		return nil
+	}
+
+	if !p.expectPeek(token.LBRACE) {
+		return nil
+	}
+
+	stmt.Body = p.parseLoopBody()
+
+	if p.peekTokenIs(token.SEMICOLON) {
+		p.nextToken()
+	}
+	return stmt
+}
+
+func (p *Parser) parseForInStatement(tok token.Token) *ast.ForInStatement {
+	stmt := &ast.ForInStatement{Token: tok}
+	stmt.Value = &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
+
+	if p.peekTokenIs(token.COMMA) {
+		p.nextToken()
+		if !p.expectPeek(token.IDENT) {
+			return nil
+		}
+		stmt.Key = stmt.Value
+		stmt.Value = &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
+	}
+
+	if !p.expectPeek(token.IN) {
+		return nil
+	}
+
+	p.nextToken()
+	stmt.Iterable = p.parseExpression(LOWEST)
+
+	if !p.expectPeek(token.RPAREN) {
+		return nil
+	}
+
+	if !p.expectPeek(token.LBRACE) {
+		return nil
+	}
+
+	stmt.Body = p.parseLoopBody()
+
+	if p.peekTokenIs(token.SEMICOLON) {
+		p.nextToken()
+	}
+	return stmt
+}
+
+func (p *Parser) parseLoopBody() *ast.BlockStatement {
+	valueDepth := p.valueDepth
+	p.loopDepth++
+	p.valueDepth = 0
+	body := p.parseBlockStatement()
+	p.loopDepth--
+	p.valueDepth = valueDepth
+	return body
+}
+
+// parseFunctionBody parses the body of a function or macro literal, which
+// break and continue cannot leave.
+func (p *Parser) parseFunctionBody() *ast.BlockStatement {
+	loopDepth, valueDepth := p.loopDepth, p.valueDepth
+	p.loopDepth, p.valueDepth = 0, 0
+	body := p.parseBlockStatement()
+	p.loopDepth, p.valueDepth = loopDepth, valueDepth
+	return body
+}
+
+// checkLoopControl reports a break or continue statement that is outside of
+// a loop or inside an expression whose value is in use.
+func (p *Parser) checkLoopControl() {
+	switch {
+	case p.loopDepth == 0:
+		p.errorAt(p.curToken, diagnostic.OutsideLoop, "%s outside of a loop", p.curToken.Literal)
+	case p.valueDepth > 0:
+		p.errorAt(p.curToken, diagnostic.OutsideLoop, "%s inside an expression whose value is used", p.curToken.Literal)
+	}
+}
+
+func (p *Parser) parseBreakStatement() *ast.BreakStatement {
+	stmt := &ast.BreakStatement{Token: p.curToken}
+	p.checkLoopControl()
+
+	if p.peekTokenIs(token.SEMICOLON) {
+		p.nextToken()
+	}
+	return stmt
+}
+
+func (p *Parser) parseContinueStatement() *ast.ContinueStatement {
+	stmt := &ast.ContinueStatement{Token: p.curToken}
+	p.checkLoopControl()
+
+	if p.peekTokenIs(token.SEMICOLON) {
+		p.nextToken()
+	}
+	return stmt
+}
+
 func (p *Parser) parseIntegerLiteral() ast.Expression {
 	lit := &ast.IntegerLiteral{Token: p.curToken}
 
-	value, err := strconv.ParseInt(p.curToken.Literal, 0, 64)
+	// Without a prefix the literal is decimal, even with a leading zero.
+	literal := p.curToken.Literal
+	base := 10
+	if len(literal) > 1 && literal[0] == '0' && strings.ContainsRune("xXoObB", rune(literal[1])) {
+		base = 0
+	} else {
+		literal = strings.ReplaceAll(literal, "_", "")
+	}
+
+	value, err := strconv.ParseInt(literal, base, 64)
 	if err != nil {
-		msg := fmt.Sprintf("could not parse %q as integer", p.curToken.Literal)
-		p.errors = append(p.errors, msg)
+		if errors.Is(err, strconv.ErrRange) {
+			p.errorAt(p.curToken, diagnostic.InvalidInteger, "integer literal %s is out of range", p.curToken.Literal)
+		} else {
+			p.errorAt(p.curToken, diagnostic.InvalidInteger, "could not parse %q as integer", p.curToken.Literal)
+		}
+		return nil
+	}
+
+	lit.Value = value
+	return lit
+}
+
+func (p *Parser) parseFloatLiteral() ast.Expression {
+	lit := &ast.FloatLiteral{Token: p.curToken}
+
+	value, err := strconv.ParseFloat(strings.ReplaceAll(p.curToken.Literal, "_", ""), 64)
+	if err != nil {
+		if errors.Is(err, strconv.ErrRange) {
+			p.errorAt(p.curToken, diagnostic.InvalidFloat, "float literal %s is out of range", p.curToken.Literal)
+		} else {
+			p.errorAt(p.curToken, diagnostic.InvalidFloat, "could not parse %q as float", p.curToken.Literal)
+		}
 		return nil
 	}
 
@@ -424,6 +1162,7 @@ func (p *Parser) parseIntegerLiteral() ast.Expression {
 func (p *Parser) parseExpressionStatement() *ast.ExpressionStatement {
 	stmt := &ast.ExpressionStatement{Token: p.curToken}
 
+	p.statement = true
 	stmt.Expression = p.parseExpression(LOWEST)
 
 	if p.peekTokenIs(token.SEMICOLON) {
@@ -435,12 +1174,19 @@ func (p *Parser) parseExpressionStatement() *ast.ExpressionStatement {
 
 func (p *Parser) parseLetStatement() *ast.LetStatement {
 	stmt := &ast.LetStatement{Token: p.curToken}
-	if !p.expectPeek(token.IDENT) {
-		return nil
+	if p.peekTokenIs(token.LBRACKET) || p.peekTokenIs(token.LBRACE) {
+		p.nextToken()
+		stmt.Pattern = p.parsePattern()
+		if stmt.Pattern == nil {
+			return nil
+		}
+	} else {
+		if !p.expectPeek(token.IDENT) {
+			return nil
+		}
+		stmt.Name = &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
 	}
 
-	stmt.Name = &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
-
 	if !p.expectPeek(token.ASSIGN) {
 		return nil
 	}
@@ -449,7 +1195,7 @@ func (p *Parser) parseLetStatement() *ast.LetStatement {
 
 	stmt.Value = p.parseExpression(LOWEST)
 
-	if fl, ok := stmt.Value.(*ast.FunctionLiteral); ok {
+	if fl, ok := stmt.Value.(*ast.FunctionLiteral); ok && stmt.Name != nil {
 		fl.Name = stmt.Name.Value
 	}
 
@@ -3,7 +3,9 @@ package parser
 import (
 	"fmt"
 	"monkey/ast"
+	"monkey/diagnostic"
 	"monkey/lexer"
+	"monkey/token"
 	"testing"
 )
 
@@ -175,6 +177,456 @@ func TestIntegerLiteralExpression(t *testing.T) {
 	}
 }
 
+func TestRadixIntegerLiterals(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected int64
+	}{
+		{"0xFF", 255},
+		{"0o755", 493},
+		{"0b1010", 10},
+		{"1_000_000", 1000000},
+		{"0x7FFF_FFFF_FFFF_FFFF", 9223372036854775807},
+		{"0755", 755},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		stmt := program.Statements[0].(*ast.ExpressionStatement)
+		literal, ok := stmt.Expression.(*ast.IntegerLiteral)
+		if !ok {
+			t.Fatalf("exp not *ast.IntegerLiteral. got=%T", stmt.Expression)
+		}
+		if literal.Value != tt.expected {
+			t.Errorf("literal.Value not %d. got=%d", tt.expected, literal.Value)
+		}
+	}
+}
+
+func TestIntegerLiteralOutOfRange(t *testing.T) {
+	l := lexer.New("let mask = 0xFFFF_FFFF_FFFF_FFFF;")
+	p := New(l)
+	p.ParseProgram()
+
+	diagnostics := p.Diagnostics()
+	if len(diagnostics) != 1 {
+		t.Fatalf("wrong number of diagnostics. want=1, got=%d (%v)", len(diagnostics), diagnostics)
+	}
+	expected := "1:12: error[P0003]: integer literal 0xFFFF_FFFF_FFFF_FFFF is out of range"
+	if diagnostics[0].String() != expected {
+		t.Errorf("wrong diagnostic. want=%q, got=%q", expected, diagnostics[0].String())
+	}
+}
+
+func TestAssignExpressionParsing(t *testing.T) {
+	tests := []struct {
+		input            string
+		expectedOperator string
+		expected         string
+	}{
+		{"x = 5;", "", "x = 5"},
+		{"x += y * 2;", "+", "x += (y * 2)"},
+		{"x -= 1", "-", "x -= 1"},
+		{"x *= 2", "*", "x *= 2"},
+		{"x /= 2", "/", "x /= 2"},
+		{"x = y = a || b", "", "x = y = (a || b)"},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		stmt := program.Statements[0].(*ast.ExpressionStatement)
+		assign, ok := stmt.Expression.(*ast.AssignExpression)
+		if !ok {
+			t.Fatalf("exp not *ast.AssignExpression. got=%T", stmt.Expression)
+		}
+		if !testIdentifier(t, assign.Target, "x") {
+			return
+		}
+		if assign.Operator != tt.expectedOperator {
+			t.Errorf("assign.Operator not %q. got=%q", tt.expectedOperator, assign.Operator)
+		}
+		if assign.String() != tt.expected {
+			t.Errorf("assign.String() not %q. got=%q", tt.expected, assign.String())
+		}
+	}
+}
+
+func TestInvalidAssignmentTarget(t *testing.T) {
+	l := lexer.New("1 + 2 = 3; let x = 1;")
+	p := New(l)
+	p.ParseProgram()
+
+	diagnostics := p.Diagnostics()
+	if len(diagnostics) != 1 {
+		t.Fatalf("wrong number of diagnostics. want=1, got=%d (%v)", len(diagnostics), diagnostics)
+	}
+	expected := "1:7: error[P0005]: cannot assign to (1 + 2)"
+	if diagnostics[0].String() != expected {
+		t.Errorf("wrong diagnostic. want=%q, got=%q", expected, diagnostics[0].String())
+	}
+}
+
+func TestIndexAssignmentParsing(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"a[0] = 1", "(a[0]) = 1"},
+		{`h["k"] += x * 2`, "(h[k]) += (x * 2)"},
+		{"a[i][j] = b[j] = 0", "((a[i])[j]) = (b[j]) = 0"},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		stmt := program.Statements[0].(*ast.ExpressionStatement)
+		assign, ok := stmt.Expression.(*ast.AssignExpression)
+		if !ok {
+			t.Fatalf("exp not *ast.AssignExpression. got=%T", stmt.Expression)
+		}
+		if _, ok := assign.Target.(*ast.IndexExpression); !ok {
+			t.Errorf("assign.Target not *ast.IndexExpression. got=%T", assign.Target)
+		}
+		if assign.String() != tt.expected {
+			t.Errorf("assign.String() not %q. got=%q", tt.expected, assign.String())
+		}
+	}
+
+	l := lexer.New("a[1:2] = b")
+	p := New(l)
+	p.ParseProgram()
+	expected := "1:8: error[P0005]: cannot assign to (a[1:2])"
+	if len(p.Diagnostics()) != 1 || p.Diagnostics()[0].String() != expected {
+		t.Errorf("wrong diagnostics. want=%q, got=%v", expected, p.Diagnostics())
+	}
+}
+
+func TestWhileStatement(t *testing.T) {
+	input := `while (x < 10) { x += 1; break; }`
+
+	l := lexer.New(input)
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	if len(program.Statements) != 1 {
+		t.Fatalf("program.Statements does not contain 1 statement. got=%d", len(program.Statements))
+	}
+	stmt, ok := program.Statements[0].(*ast.WhileStatement)
+	if !ok {
+		t.Fatalf("program.Statements[0] is not *ast.WhileStatement. got=%T", program.Statements[0])
+	}
+	if !testInfixExpression(t, stmt.Condition, "x", "<", 10) {
+		return
+	}
+	if len(stmt.Body.Statements) != 2 {
+		t.Fatalf("body does not contain 2 statements. got=%d", len(stmt.Body.Statements))
+	}
+	if _, ok := stmt.Body.Statements[1].(*ast.BreakStatement); !ok {
+		t.Errorf("body.Statements[1] is not *ast.BreakStatement. got=%T", stmt.Body.Statements[1])
+	}
+}
+
+func TestForStatement(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"for (let i = 0; i < 10; i += 1) { continue; }", "for (let i = 0; (i < 10); i += 1) continue;"},
+		{"for (i = 0; i < 10;) { i }", "for (i = 0; (i < 10); ) i"},
+		{"for (;;) { break }", "for (; ; ) break;"},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		if len(program.Statements) != 1 {
+			t.Fatalf("program.Statements does not contain 1 statement. got=%d", len(program.Statements))
+		}
+		stmt, ok := program.Statements[0].(*ast.ForStatement)
+		if !ok {
+			t.Fatalf("program.Statements[0] is not *ast.ForStatement. got=%T", program.Statements[0])
+		}
+		if stmt.String() != tt.expected {
+			t.Errorf("stmt.String() wrong. want=%q, got=%q", tt.expected, stmt.String())
+		}
+	}
+}
+
+func TestForInStatement(t *testing.T) {
+	tests := []struct {
+		input    string
+		key      string
+		value    string
+		expected string
+	}{
+		{"for (x in xs) { x }", "", "x", "for (x in xs) x"},
+		{"for (k, v in h) { break; }", "k", "v", "for (k, v in h) break;"},
+		{"for (i in 0..len(s)) { continue }", "", "i", "for (i in (0 .. len(s))) continue;"},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		if len(program.Statements) != 1 {
+			t.Fatalf("program.Statements does not contain 1 statement. got=%d", len(program.Statements))
+		}
+		stmt, ok := program.Statements[0].(*ast.ForInStatement)
+		if !ok {
+			t.Fatalf("program.Statements[0] is not *ast.ForInStatement. got=%T", program.Statements[0])
+		}
+		if tt.key == "" {
+			if stmt.Key != nil {
+				t.Errorf("stmt.Key not nil. got=%s", stmt.Key)
+			}
+		} else if !testIdentifier(t, stmt.Key, tt.key) {
+			return
+		}
+		if !testIdentifier(t, stmt.Value, tt.value) {
+			return
+		}
+		if stmt.String() != tt.expected {
+			t.Errorf("stmt.String() wrong. want=%q, got=%q", tt.expected, stmt.String())
+		}
+	}
+}
+
+func TestMatchExpression(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"match (x) { 1 => a, -2.5 => b, \"s\" => c, true => d, _ => e }",
+			"match (x) {1 => a, (-2.5) => b, s => c, true => d, _ => e}"},
+		{"match (xs) { [] => 0, [h, ...t] if h > 0 => h + 1, [_, [a, b],] => { a; b } }",
+			"match (xs) {[] => 0, [h, ...t] if (h > 0) => (h + 1), [_, [a, b]] => ab}"},
+		{`match (e) { {"type": "user", "id": id} => id, {} => 0, }`,
+			`match (e) {{type:user, id} => id, {} => 0}`},
+		{"match (v) { null => 0, [null, x] => x }",
+			"match (v) {null => 0, [null, x] => x}"},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		stmt := program.Statements[0].(*ast.ExpressionStatement)
+		match, ok := stmt.Expression.(*ast.MatchExpression)
+		if !ok {
+			t.Fatalf("stmt.Expression is not *ast.MatchExpression. got=%T", stmt.Expression)
+		}
+		if match.String() != tt.expected {
+			t.Errorf("match.String() wrong. want=%q, got=%q", tt.expected, match.String())
+		}
+	}
+}
+
+func TestInvalidPatterns(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"match (x) { a + 1 => 1 }", "1:15: error[P0001]: expected next token to be =>, got + instead"},
+		{"match (x) { fn() {} => 1 }", "1:13: error[P0007]: expected a pattern, got FUNCTION"},
+		{"match (x) { [...t, h] => 1 }", "1:20: error[P0007]: a rest pattern must come last"},
+		{"match (x) { {k: 1} => 1 }", "1:14: error[P0007]: expected a literal hash key, got IDENT \"k\""},
+		{"let {a: 1} = {}", "1:6: error[P0007]: expected a literal hash key, got IDENT \"a\""},
+		{`let {"a": {b: 1}, "c": c} = {}; let d = 1;`, "1:12: error[P0007]: expected a literal hash key, got IDENT \"b\""},
+		{`let {"a": fn} = {}; let d = 1;`, "1:11: error[P0007]: expected a pattern, got FUNCTION"},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		p.ParseProgram()
+
+		diagnostics := p.Diagnostics()
+		if len(diagnostics) != 1 {
+			t.Fatalf("wrong number of diagnostics for %q. want=1, got=%d (%v)", tt.input, len(diagnostics), diagnostics)
+		}
+		if diagnostics[0].String() != tt.expected {
+			t.Errorf("wrong diagnostic. want=%q, got=%q", tt.expected, diagnostics[0].String())
+		}
+	}
+}
+
+func TestDestructuringLetStatements(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"let [a, b, ...rest] = xs;", "let [a, b, ...rest] = xs;"},
+		{"let {name, age} = person;", "let {name, age} = person;"},
+		{`let {"pos": [x, _], 1: one} = h;`, "let {pos:[x, _], 1:one} = h;"},
+		{`let {name, "age": years, "id": id} = person;`, "let {name, age:years, id} = person;"},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		stmt, ok := program.Statements[0].(*ast.LetStatement)
+		if !ok {
+			t.Fatalf("program.Statements[0] is not *ast.LetStatement. got=%T", program.Statements[0])
+		}
+		if stmt.Name != nil {
+			t.Errorf("stmt.Name is not nil. got=%s", stmt.Name)
+		}
+		if stmt.String() != tt.expected {
+			t.Errorf("stmt.String() wrong. want=%q, got=%q", tt.expected, stmt.String())
+		}
+	}
+}
+
+func TestDestructuringParameters(t *testing.T) {
+	input := "fn(a, [x, y], {z}) { x }"
+
+	l := lexer.New(input)
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	function := program.Statements[0].(*ast.ExpressionStatement).Expression.(*ast.FunctionLiteral)
+	if len(function.Parameters) != 3 || len(function.Patterns) != 3 {
+		t.Fatalf("wrong number of parameters. want 3, got=%d parameters and %d patterns",
+			len(function.Parameters), len(function.Patterns))
+	}
+	testLiteralExpression(t, function.Parameters[0], "a")
+	if function.Patterns[0] != nil {
+		t.Errorf("function.Patterns[0] is not nil. got=%s", function.Patterns[0])
+	}
+	if _, ok := function.Patterns[1].(*ast.ArrayPattern); !ok {
+		t.Errorf("function.Patterns[1] is not *ast.ArrayPattern. got=%T", function.Patterns[1])
+	}
+	if _, ok := function.Patterns[2].(*ast.HashPattern); !ok {
+		t.Errorf("function.Patterns[2] is not *ast.HashPattern. got=%T", function.Patterns[2])
+	}
+	if function.String() != "fn(a, [x, y], {z})x" {
+		t.Errorf("function.String() wrong. got=%q", function.String())
+	}
+
+	l = lexer.New("fn(a, 1) { a }")
+	p = New(l)
+	p.ParseProgram()
+	expected := `1:7: error[P0001]: expected a parameter, got INT "1"`
+	if len(p.Diagnostics()) != 1 || p.Diagnostics()[0].String() != expected {
+		t.Errorf("wrong diagnostics. want=%q, got=%v", expected, p.Diagnostics())
+	}
+}
+
+func TestDefaultRestAndSpread(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"fn(a, b = 10) { a }", "fn(a, b = 10)a"},
+		{"fn(a, [x, y] = [1, 2], ...rest) { a }", "fn(a, [x, y] = [1, 2], ...rest)a"},
+		{"fn(...args) { args }", "fn(...args)args"},
+		{"f(...xs, 1)", "f(...xs, 1)"},
+		{"[...a, ...b + c]", "[...a, ...(b + c)]"},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		if program.String() != tt.expected {
+			t.Errorf("program.String() wrong. want=%q, got=%q", tt.expected, program.String())
+		}
+	}
+
+	errors := []struct {
+		input    string
+		expected string
+	}{
+		{"fn(a = 1, b) { b }", "1:11: error[P0008]: a parameter without a default cannot follow one with a default"},
+		{"fn(...rest, a) { a }", "1:11: error[P0008]: a rest parameter must come last"},
+	}
+
+	for _, tt := range errors {
+		l := lexer.New(tt.input)
+		p := New(l)
+		p.ParseProgram()
+		if len(p.Diagnostics()) == 0 || p.Diagnostics()[0].String() != tt.expected {
+			t.Errorf("wrong diagnostics for %q. want=%q, got=%v", tt.input, tt.expected, p.Diagnostics())
+		}
+	}
+}
+
+func TestLoopControlOutsideLoop(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"break;", "1:1: error[P0006]: break outside of a loop"},
+		{"if (true) { continue }", "1:13: error[P0006]: continue outside of a loop"},
+		{"while (true) { fn() { break; } }", "1:23: error[P0006]: break outside of a loop"},
+		{"for (x in xs) { let a = [x, if (x) { continue } else { 0 }] }", "1:38: error[P0006]: continue inside an expression whose value is used"},
+		{"for (x in xs) { s += if (x) { break } else { x } }", "1:31: error[P0006]: break inside an expression whose value is used"},
+		{"while (true) { let v = match (1) { _ => { break } } }", "1:43: error[P0006]: break inside an expression whose value is used"},
+		{"while (true) { f(try { continue } finally { 0 }) }", "1:24: error[P0006]: continue inside an expression whose value is used"},
+		{"while (true) { [if (true) { fn() { break } }] }", "1:36: error[P0006]: break outside of a loop"},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		p.ParseProgram()
+
+		diagnostics := p.Diagnostics()
+		if len(diagnostics) != 1 {
+			t.Fatalf("wrong number of diagnostics for %q. want=1, got=%d (%v)", tt.input, len(diagnostics), diagnostics)
+		}
+		if diagnostics[0].String() != tt.expected {
+			t.Errorf("wrong diagnostic. want=%q, got=%q", tt.expected, diagnostics[0].String())
+		}
+	}
+}
+
+func TestFloatLiteralExpression(t *testing.T) {
+	input := "2.5e-1;"
+
+	l := lexer.New(input)
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	stmt := program.Statements[0].(*ast.ExpressionStatement)
+	literal, ok := stmt.Expression.(*ast.FloatLiteral)
+	if !ok {
+		t.Fatalf("exp not *ast.FloatLiteral. got=%T", stmt.Expression)
+	}
+	if literal.Value != 0.25 {
+		t.Errorf("literal.Value not %g. got=%g", 0.25, literal.Value)
+	}
+	if literal.TokenLiteral() != "2.5e-1" {
+		t.Errorf("literal.TokenLiteral not %s. got=%s", "2.5e-1", literal.TokenLiteral())
+	}
+}
+
 func TestParsingPrefixExpressions(t *testing.T) {
 	prefixTests := []struct {
 		input    string
@@ -334,6 +786,62 @@ func TestOperatorPrecedenceParsing(t *testing.T) {
 		input    string
 		expected string
 	}{
+		{
+			"a || b && c == d",
+			"(a || (b && (c == d)))",
+		},
+		{
+			"0..n + 1 == r",
+			"((0 .. (n + 1)) == r)",
+		},
+		{
+			"a < b..c | d",
+			"(a < (b .. (c | d)))",
+		},
+		{
+			"a <= b == c >= d",
+			"((a <= b) == (c >= d))",
+		},
+		{
+			"a % b * c",
+			"((a % b) * c)",
+		},
+		{
+			"2 ** 3 ** 2",
+			"(2 ** (3 ** 2))",
+		},
+		{
+			"-2 ** 2",
+			"(-(2 ** 2))",
+		},
+		{
+			"a * b ** c",
+			"(a * (b ** c))",
+		},
+		{
+			"a | b ^ c & d",
+			"(a | (b ^ (c & d)))",
+		},
+		{
+			"a & b == c",
+			"((a & b) == c)",
+		},
+		{
+			"1 << 2 + 3",
+			"(1 << (2 + 3))",
+		},
+		{
+			"a & b << c",
+			"(a & (b << c))",
+		},
+		{
+			"~a & b",
+			"((~a) & b)",
+		},
+		{
+			"a && b || !c",
+			"((a && b) || (!c))",
+		},
 		{
 			"-a * b",
 			"((-a) * b)",
@@ -811,6 +1319,37 @@ func TestStringLiteralExpression(t *testing.T) {
 	}
 }
 
+func TestInterpolatedStringParsing(t *testing.T) {
+	input := `"Hello ${name}, you have ${len(items) + 1} items"`
+
+	l := lexer.New(input)
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	stmt := program.Statements[0].(*ast.ExpressionStatement)
+	str, ok := stmt.Expression.(*ast.InterpolatedString)
+	if !ok {
+		t.Fatalf("exp not *ast.InterpolatedString. got=%T", stmt.Expression)
+	}
+
+	if len(str.Parts) != 5 {
+		t.Fatalf("wrong number of parts. want=5, got=%d", len(str.Parts))
+	}
+	for _, i := range []int{0, 2, 4} {
+		if _, ok := str.Parts[i].(*ast.StringLiteral); !ok {
+			t.Errorf("parts[%d] not *ast.StringLiteral. got=%T", i, str.Parts[i])
+		}
+	}
+	testIdentifier(t, str.Parts[1], "name")
+	if str.Parts[3].String() != "(len(items) + 1)" {
+		t.Errorf("parts[3] wrong. got=%q", str.Parts[3].String())
+	}
+	if str.String() != `"Hello ${name}, you have ${(len(items) + 1)} items"` {
+		t.Errorf("str.String() wrong. got=%q", str.String())
+	}
+}
+
 func TestParsingArrayLiterals(t *testing.T) {
 	input := "[1, 2 * 2, 3 + 3]"
 
@@ -857,6 +1396,217 @@ func TestParsingIndexExpressions(t *testing.T) {
 	}
 }
 
+func TestParsingSliceExpressions(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"a[1:3]", "(a[1:3])"},
+		{"a[:n]", "(a[:n])"},
+		{"a[n + 1:]", "(a[(n + 1):])"},
+		{"a[:]", "(a[:])"},
+		{"a[-2:][0]", "((a[(-2):])[0])"},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		if program.String() != tt.expected {
+			t.Errorf("program.String() wrong. want=%q, got=%q", tt.expected, program.String())
+		}
+	}
+}
+
+func TestDotExpressions(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"user.address.city", "((user.address).city)"},
+		{"-a.b * c", "((-(a.b)) * c)"},
+		{`"abc".upper()`, "abc.upper()"},
+		{"xs.map(f)[0]", "(xs.map(f)[0])"},
+		{"a.b.c(1, ...d)", "(a.b).c(1, ...d)"},
+		{"h.n = 1", "(h.n) = 1"},
+		{`a.b == a["b"]`, "((a.b) == (a[b]))"},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		if program.String() != tt.expected {
+			t.Errorf("program.String() wrong. want=%q, got=%q", tt.expected, program.String())
+		}
+	}
+
+	l := lexer.New("a.1")
+	p := New(l)
+	p.ParseProgram()
+	expected := `1:3: error[P0001]: expected next token to be IDENT, got INT "1" instead`
+	if len(p.Diagnostics()) == 0 || p.Diagnostics()[0].String() != expected {
+		t.Errorf("wrong diagnostics. want=%q, got=%v", expected, p.Diagnostics())
+	}
+}
+
+func TestNullAndOptionalAccess(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"null", "null"},
+		{"a ?? b ?? c", "((a ?? b) ?? c)"},
+		{"a || b ?? c && d", "((a || b) ?? (c && d))"},
+		{"x = a ?? b", "x = (a ?? b)"},
+		{"a?.b.c", "((a?.b).c)"},
+		{"a?[0]?.m(1)", "(a?[0])?.m(1)"},
+		{"a?[1:]", "(a?[1:])"},
+		{"-a?.b ?? 0", "((-(a?.b)) ?? 0)"},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		if program.String() != tt.expected {
+			t.Errorf("program.String() wrong. want=%q, got=%q", tt.expected, program.String())
+		}
+	}
+
+	l := lexer.New("a?.b = 1")
+	p := New(l)
+	p.ParseProgram()
+	expected := "1:6: error[P0005]: cannot assign to optional access (a?.b)"
+	if len(p.Diagnostics()) == 0 || p.Diagnostics()[0].String() != expected {
+		t.Errorf("wrong diagnostics. want=%q, got=%v", expected, p.Diagnostics())
+	}
+}
+
+func TestTryExpressions(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"try { f() } catch (e) { e }", "try f() catch (e) e"},
+		{"try { f() } finally { g() }", "try f() finally g()"},
+		{"let x = try { 1 } catch (e) { 2 } finally { 3 };", "let x = try 1 catch (e) 2 finally 3;"},
+		{`throw "boom"; x`, `throw boom;x`},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		if program.String() != tt.expected {
+			t.Errorf("program.String() wrong. want=%q, got=%q", tt.expected, program.String())
+		}
+	}
+
+	l := lexer.New("try { 1 } 2")
+	p := New(l)
+	p.ParseProgram()
+	expected := `1:11: error[P0001]: expected catch or finally, got INT "2"`
+	if len(p.Diagnostics()) == 0 || p.Diagnostics()[0].String() != expected {
+		t.Errorf("wrong diagnostics. want=%q, got=%v", expected, p.Diagnostics())
+	}
+}
+
+func TestImportAndExport(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`import "lib/strings" as s; s.upper("a")`, `import "lib/strings" as s;s.upper(a)`},
+		{"export let x = 1;", "export let x = 1;"},
+		{"export let [a, b] = xs", "export let [a, b] = xs;"},
+		{"export const MAX = 10;", "export const MAX = 10;"},
+		{"const [a, b] = xs", "const [a, b] = xs;"},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		if program.String() != tt.expected {
+			t.Errorf("program.String() wrong. want=%q, got=%q", tt.expected, program.String())
+		}
+	}
+
+	errorTests := []struct {
+		input    string
+		expected string
+	}{
+		{`import lib as s;`, `1:8: error[P0001]: expected next token to be STRING, got IDENT "lib" instead`},
+		{`import "lib";`, `1:13: error[P0001]: expected next token to be AS, got ; instead`},
+		{"export x = 1;", `1:8: error[P0001]: expected let, const or struct, got IDENT "x"`},
+		{"fn() { export let x = 1; }", "1:8: error[P0009]: export is only allowed at the top level"},
+		{`if (true) { import "a" as a; }`, "1:13: error[P0009]: import is only allowed at the top level"},
+	}
+
+	for _, tt := range errorTests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		p.ParseProgram()
+		if len(p.Diagnostics()) == 0 || p.Diagnostics()[0].String() != tt.expected {
+			t.Errorf("wrong diagnostics for %q. want=%q, got=%v", tt.input, tt.expected, p.Diagnostics())
+		}
+	}
+}
+
+func TestStructStatements(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"struct Point { x, y }", "struct Point { x, y }"},
+		{"struct Point {\n  x,\n  y,\n}; Point(1, 2)", "struct Point { x, y }Point(1, 2)"},
+		{"struct Empty {}", "struct Empty {}"},
+		{"export struct Pair { a, b }", "export struct Pair { a, b }"},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		if program.String() != tt.expected {
+			t.Errorf("program.String() wrong. want=%q, got=%q", tt.expected, program.String())
+		}
+	}
+
+	errorTests := []struct {
+		input    string
+		expected string
+	}{
+		{"struct { x }", `1:8: error[P0001]: expected next token to be IDENT, got { instead`},
+		{"struct P { x, x }", "1:15: error[P0010]: duplicate field x in struct P"},
+		{"struct P { x, y, x, z }; let a = 1;", "1:18: error[P0010]: duplicate field x in struct P"},
+		{"struct P { x y }", `1:14: error[P0001]: expected next token to be ,, got IDENT "y" instead`},
+		{"struct P { 1 }", `1:12: error[P0001]: expected next token to be IDENT, got INT "1" instead`},
+	}
+
+	for _, tt := range errorTests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		p.ParseProgram()
+		if len(p.Diagnostics()) != 1 || p.Diagnostics()[0].String() != tt.expected {
+			t.Errorf("wrong diagnostics for %q. want=%q, got=%v", tt.input, tt.expected, p.Diagnostics())
+		}
+	}
+}
+
 func TestParsingEmptyHashLiteral(t *testing.T) {
 	input := "{}"
 
@@ -1077,3 +1827,134 @@ func TestMacroLiteralParsing(t *testing.T) {
 
 	testInfixExpression(t, bodyStmt.Expression, "x", "+", "y")
 }
+
+func TestErrorRecovery(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected []diagnostic.Diagnostic
+	}{
+		{
+			"let x 5; let y = 10;",
+			[]diagnostic.Diagnostic{
+				{Code: diagnostic.UnexpectedToken, Message: "expected next token to be =, got INT \"5\" instead",
+					Start: token.Position{Offset: 6, Line: 1, Column: 7}, End: token.Position{Offset: 7, Line: 1, Column: 8}},
+			},
+		},
+		{
+			"let = 1 + ; let y = );\nlet z = 3;",
+			[]diagnostic.Diagnostic{
+				{Code: diagnostic.UnexpectedToken, Message: "expected next token to be IDENT, got = instead",
+					Start: token.Position{Offset: 4, Line: 1, Column: 5}, End: token.Position{Offset: 5, Line: 1, Column: 6}},
+				{Code: diagnostic.MissingExpression, Message: "expected an expression, got )",
+					Start: token.Position{Offset: 20, Line: 1, Column: 21}, End: token.Position{Offset: 21, Line: 1, Column: 22}},
+			},
+		},
+		{
+			"fn() { let = 1; x + }; @; let a = 99999999999999999999;",
+			[]diagnostic.Diagnostic{
+				{Code: diagnostic.UnexpectedToken, Message: "expected next token to be IDENT, got = instead",
+					Start: token.Position{Offset: 11, Line: 1, Column: 12}, End: token.Position{Offset: 12, Line: 1, Column: 13}},
+				{Code: diagnostic.MissingExpression, Message: "expected an expression, got }",
+					Start: token.Position{Offset: 20, Line: 1, Column: 21}, End: token.Position{Offset: 21, Line: 1, Column: 22}},
+				{Code: diagnostic.IllegalCharacter, Message: "illegal character \"@\"",
+					Start: token.Position{Offset: 23, Line: 1, Column: 24}, End: token.Position{Offset: 24, Line: 1, Column: 25}},
+				{Code: diagnostic.InvalidInteger, Message: "integer literal 99999999999999999999 is out of range",
+					Start: token.Position{Offset: 34, Line: 1, Column: 35}, End: token.Position{Offset: 54, Line: 1, Column: 55}},
+			},
+		},
+		{
+			`let h = {"a" 1}; let y = 1;`,
+			[]diagnostic.Diagnostic{
+				{Code: diagnostic.UnexpectedToken, Message: "expected next token to be :, got INT \"1\" instead",
+					Start: token.Position{Offset: 13, Line: 1, Column: 14}, End: token.Position{Offset: 14, Line: 1, Column: 15}},
+			},
+		},
+		{
+			`fn() { let h = {"a" 1}; 2 }; let y = ;`,
+			[]diagnostic.Diagnostic{
+				{Code: diagnostic.UnexpectedToken, Message: "expected next token to be :, got INT \"1\" instead",
+					Start: token.Position{Offset: 20, Line: 1, Column: 21}, End: token.Position{Offset: 21, Line: 1, Column: 22}},
+				{Code: diagnostic.MissingExpression, Message: "expected an expression, got ;",
+					Start: token.Position{Offset: 37, Line: 1, Column: 38}, End: token.Position{Offset: 38, Line: 1, Column: 39}},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		p.ParseProgram()
+
+		diagnostics := p.Diagnostics()
+		if len(diagnostics) != len(tt.expected) {
+			t.Errorf("wrong number of diagnostics for %q. want=%d, got=%d", tt.input, len(tt.expected), len(diagnostics))
+			for _, d := range diagnostics {
+				t.Errorf("diagnostic: %s", d)
+			}
+			continue
+		}
+		for i, want := range tt.expected {
+			got := diagnostics[i]
+			if got.Severity != diagnostic.Error {
+				t.Errorf("diagnostics[%d] has wrong severity. got=%s", i, got.Severity)
+			}
+			if got.Code != want.Code || got.Message != want.Message {
+				t.Errorf("diagnostics[%d] wrong. want=%s %q, got=%s %q", i, want.Code, want.Message, got.Code, got.Message)
+			}
+			if got.Start != want.Start || got.End != want.End {
+				t.Errorf("diagnostics[%d] has wrong span. want=%+v-%+v, got=%+v-%+v", i, want.Start, want.End, got.Start, got.End)
+			}
+		}
+	}
+}
+
+func TestErrorRecoveryKeepsValidStatements(t *testing.T) {
+	l := lexer.New("let a = 1; let b = ; let c = 3; fn() { 1 +; 2 }; let d = 4;")
+	p := New(l)
+	program := p.ParseProgram()
+
+	if len(p.Errors()) != 2 {
+		t.Fatalf("wrong number of errors. want=2, got=%d (%q)", len(p.Errors()), p.Errors())
+	}
+
+	names := []string{}
+	for _, stmt := range program.Statements {
+		if let, ok := stmt.(*ast.LetStatement); ok {
+			names = append(names, let.Name.Value)
+		}
+	}
+	if fmt.Sprint(names) != "[a b c d]" {
+		t.Errorf("wrong let statements parsed. got=%v", names)
+	}
+}
+
+func TestCommentsAreKept(t *testing.T) {
+	input := `// add returns the sum of a and b.
+let add = fn(a, b) {
+	a + b; // no overflow checks
+};
+/* done */`
+
+	l := lexer.New(input)
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	expected := []string{"// add returns the sum of a and b.", "// no overflow checks", "/* done */"}
+	if len(program.Comments) != len(expected) {
+		t.Fatalf("wrong number of comments. want=%d, got=%d", len(expected), len(program.Comments))
+	}
+	for i, text := range expected {
+		if program.Comments[i].Text != text {
+			t.Errorf("comments[%d] wrong. want=%q, got=%q", i, text, program.Comments[i].Text)
+		}
+	}
+
+	let, ok := program.Statements[0].(*ast.LetStatement)
+	if !ok {
+		t.Fatalf("program.Statements[0] is not *ast.LetStatement. got=%T", program.Statements[0])
+	}
+	if len(let.Token.Leading) != 1 || let.Token.Leading[0].Text != expected[0] {
+		t.Errorf("doc comment not attached to let statement. got=%+v", let.Token.Leading)
+	}
+}
@@ -0,0 +1,205 @@
+package parser
+
+import (
+	"monkey/ast"
+	"monkey/diagnostic"
+	"monkey/token"
+)
+
+func (p *Parser) parseMatchExpression() ast.Expression {
+	expression := &ast.MatchExpression{Token: p.curToken}
+	if !p.expectPeek(token.LPAREN) {
+		return nil
+	}
+
+	p.nextToken()
+	expression.Subject = p.parseExpression(LOWEST)
+
+	if !p.expectPeek(token.RPAREN) {
+		return nil
+	}
+	if !p.expectPeek(token.LBRACE) {
+		return nil
+	}
+	depth := p.braceDepth
+
+	for !p.peekTokenIs(token.RBRACE) {
+		p.nextToken()
+		arm := p.parseMatchArm()
+		if arm == nil {
+			p.skipToClosingBrace(depth)
+			return nil
+		}
+		expression.Arms = append(expression.Arms, arm)
+
+		if !p.peekTokenIs(token.RBRACE) && !p.expectPeek(token.COMMA) {
+			return nil
+		}
+	}
+
+	if !p.expectPeek(token.RBRACE) {
+		return nil
+	}
+
+	return expression
+}
+
+// skipToClosingBrace skips to the '}' that closes the brace opened at the
+// given depth, so that recovery from an error in a match arm resumes after
+// the whole match expression.
+func (p *Parser) skipToClosingBrace(depth int) {
+	for !p.curTokenIs(token.EOF) && !(p.curTokenIs(token.RBRACE) && p.braceDepth < depth) {
+		p.nextToken()
+	}
+}
+
+// parseMatchArm parses "pattern if guard => body". A body starting with '{'
+// is a block; wrap a hash literal body in parentheses.
+func (p *Parser) parseMatchArm() *ast.MatchArm {
+	arm := &ast.MatchArm{Pattern: p.parsePattern()}
+	if arm.Pattern == nil {
+		return nil
+	}
+
+	if p.peekTokenIs(token.IF) {
+		p.nextToken()
+		p.nextToken()
+		arm.Guard = p.parseExpression(LOWEST)
+	}
+
+	if !p.expectPeek(token.ARROW) {
+		return nil
+	}
+
+	p.nextToken()
+	if p.curTokenIs(token.LBRACE) {
+		arm.Body = p.parseBlockStatement()
+		return arm
+	}
+
+	stmt := &ast.ExpressionStatement{Token: p.curToken}
+	stmt.Expression = p.parseExpression(LOWEST)
+	arm.Body = &ast.BlockStatement{Token: stmt.Token, Statements: []ast.Statement{stmt}}
+	return arm
+}
+
+// parsePattern parses a literal, an identifier, which binds the matched
+// value unless it is "_", or an array or hash pattern.
+func (p *Parser) parsePattern() ast.Expression {
+	switch p.curToken.Type {
+	case token.IDENT:
+		return p.parseIdentifier()
+	case token.INT, token.FLOAT, token.STRING, token.TRUE, token.FALSE, token.NULL:
+		return p.prefixParseFns[p.curToken.Type]()
+	case token.MINUS:
+		if p.peekTokenIs(token.INT) || p.peekTokenIs(token.FLOAT) {
+			return p.parsePrefixExpression()
+		}
+	case token.LBRACKET:
+		return p.parseArrayPattern()
+	case token.LBRACE:
+		return p.parseHashPattern()
+	}
+
+	p.errorAt(p.curToken, diagnostic.InvalidPattern, "expected a pattern, got %s", describeToken(p.curToken))
+	return nil
+}
+
+func (p *Parser) parseArrayPattern() ast.Expression {
+	pattern := &ast.ArrayPattern{Token: p.curToken}
+
+	for !p.peekTokenIs(token.RBRACKET) {
+		p.nextToken()
+		if p.curTokenIs(token.ELLIPSIS) {
+			if !p.expectPeek(token.IDENT) {
+				return nil
+			}
+			pattern.Rest = &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
+			if p.peekTokenIs(token.COMMA) {
+				p.nextToken()
+			}
+			if !p.peekTokenIs(token.RBRACKET) {
+				p.errorAt(p.peekToken, diagnostic.InvalidPattern, "a rest pattern must come last")
+				return nil
+			}
+			break
+		}
+
+		element := p.parsePattern()
+		if element == nil {
+			return nil
+		}
+		pattern.Elements = append(pattern.Elements, element)
+
+		if !p.peekTokenIs(token.RBRACKET) && !p.expectPeek(token.COMMA) {
+			return nil
+		}
+	}
+
+	if !p.expectPeek(token.RBRACKET) {
+		return nil
+	}
+
+	return pattern
+}
+
+// parseHashPattern parses a hash pattern. After an error it skips to the
+// pattern's closing '}', so that the rest of the pattern is not reported
+// again as statements.
+func (p *Parser) parseHashPattern() ast.Expression {
+	depth := p.braceDepth
+	pattern := p.parseHashPatternPairs()
+	if pattern == nil {
+		p.skipToClosingBrace(depth)
+		return nil
+	}
+	return pattern
+}
+
+func (p *Parser) parseHashPatternPairs() *ast.HashPattern {
+	pattern := &ast.HashPattern{Token: p.curToken}
+
+	for !p.peekTokenIs(token.RBRACE) {
+		p.nextToken()
+		switch p.curToken.Type {
+		case token.IDENT:
+			if p.peekTokenIs(token.COMMA) || p.peekTokenIs(token.RBRACE) {
+				// {name} is short for {"name": name}.
+				pattern.Keys = append(pattern.Keys, &ast.StringLiteral{Token: p.curToken, Value: p.curToken.Literal})
+				pattern.Values = append(pattern.Values, p.parseIdentifier())
+				if p.peekTokenIs(token.COMMA) {
+					p.nextToken()
+				}
+				continue
+			}
+			p.errorAt(p.curToken, diagnostic.InvalidPattern, "expected a literal hash key, got %s", describeToken(p.curToken))
+			return nil
+		case token.STRING, token.INT, token.TRUE, token.FALSE:
+			pattern.Keys = append(pattern.Keys, p.prefixParseFns[p.curToken.Type]())
+		default:
+			p.errorAt(p.curToken, diagnostic.InvalidPattern, "expected a literal hash key, got %s", describeToken(p.curToken))
+			return nil
+		}
+
+		if !p.expectPeek(token.COLON) {
+			return nil
+		}
+
+		p.nextToken()
+		value := p.parsePattern()
+		if value == nil {
+			return nil
+		}
+		pattern.Values = append(pattern.Values, value)
+
+		if !p.peekTokenIs(token.RBRACE) && !p.expectPeek(token.COMMA) {
+			return nil
+		}
+	}
+
+	if !p.expectPeek(token.RBRACE) {
+		return nil
+	}
+
+	return pattern
+}
@@ -4,8 +4,11 @@ import (
 	"bufio"
 	"fmt"
 	"io"
+	"monkey/ast"
 	"monkey/compiler"
+	"monkey/diagnostic"
 	"monkey/lexer"
+	"monkey/module"
 	"monkey/object"
 	"monkey/parser"
 	"monkey/vm"
@@ -13,8 +16,11 @@ import (
 
 const PROMPT = ">> "
 
-func Start(in io.Reader, out io.Writer) {
+// Start reads lines from in and runs them, resolving imports relative to
+// the working directory and then in searchPath.
+func Start(in io.Reader, out io.Writer, searchPath ...string) {
 	scanner := bufio.NewScanner(in)
+	loader := module.NewLoader(searchPath...)
 	constants := []object.Object{}
 	globals := make([]object.Object, vm.GlobalsSize)
 	symbolTable := compiler.NewSymbolTable()
@@ -34,19 +40,22 @@ func Start(in io.Reader, out io.Writer) {
 
 		program := p.ParseProgram()
 		if len(p.Errors()) != 0 {
-			printParserErrors(out, p.Errors())
+			printParserErrors(out, p.Diagnostics())
 			continue
 		}
 
 		comp := compiler.NewWithState(symbolTable, constants)
+		comp.SetModuleLoader(loader, "")
 		err := comp.Compile(program)
+		// Keep the constants of modules compiled before an error, as
+		// the loader has cached them for later lines.
+		constants = comp.Bytecode().Constants
 		if err != nil {
 			fmt.Fprintf(out, "Woops! Compilation failed:\n %s\n", err)
 			continue
 		}
 
 		code := comp.Bytecode()
-		constants = code.Constants
 		machine := vm.NewWithGlobalsStore(code, globals)
 		err = machine.Run()
 		if err != nil {
@@ -61,8 +70,28 @@ func Start(in io.Reader, out io.Writer) {
 	}
 
 }
-func printParserErrors(out io.Writer, errors []string) {
-	for _, msg := range errors {
-		io.WriteString(out, "\t"+msg+"\n")
+
+// RunFile compiles and runs the file filename, resolving imports relative
+// to the importing file and then in searchPath. Errors are written to out.
+func RunFile(filename string, out io.Writer, searchPath ...string) error {
+	loader := module.NewLoader(searchPath...)
+	_, err := loader.Load(filename, func(filename string, program *ast.Program) (object.Object, error) {
+		comp := compiler.New()
+		comp.SetModuleLoader(loader, filename)
+		err := comp.Compile(program)
+		if err != nil {
+			return nil, err
+		}
+		return nil, vm.New(comp.Bytecode()).Run()
+	})
+	if err != nil {
+		fmt.Fprintf(out, "%s\n", err)
+	}
+	return err
+}
+
+func printParserErrors(out io.Writer, diagnostics []diagnostic.Diagnostic) {
+	for _, d := range diagnostics {
+		io.WriteString(out, "\t"+d.String()+"\n")
 	}
 }
@@ -1,10 +1,56 @@
 package token
 
+import "fmt"
+
 type TokenType string
 
 type Token struct {
 	Type    TokenType
 	Literal string
+	Pos     Position // position of the first character
+	End     Position // position just past the last character
+
+	// Leading holds the comments between the previous token and this one.
+	// Trailing holds the comments that follow this token on the same line.
+	Leading  []Comment
+	Trailing []Comment
+}
+
+// Comment is a "//" line comment or a "/* */" block comment. Text includes
+// the comment delimiters.
+type Comment struct {
+	Text string
+	Pos  Position
+	End  Position
+}
+
+// Position describes a location in a source file. Line and Column are
+// 1-based, Offset is the 0-based byte offset into the input.
+type Position struct {
+	Filename string
+	Offset   int
+	Line     int
+	Column   int
+}
+
+// IsValid reports whether the position was set by the lexer.
+func (p Position) IsValid() bool {
+	return p.Line > 0
+}
+
+// String returns the position as "file:line:column", "line:column" when
+// there is no file name, or "-" when the position is unknown.
+func (p Position) String() string {
+	if !p.IsValid() {
+		if p.Filename != "" {
+			return p.Filename
+		}
+		return "-"
+	}
+	if p.Filename != "" {
+		return fmt.Sprintf("%s:%d:%d", p.Filename, p.Line, p.Column)
+	}
+	return fmt.Sprintf("%d:%d", p.Line, p.Column)
 }
 
 const (
@@ -13,22 +59,49 @@ const (
 
 	IDENT  = "IDENT" // add, foobar, x, y, ...
 	INT    = "INT"   // 123456
+	FLOAT  = "FLOAT" // 1.5, 2e10, 6.02e-23
 	STRING = "STRING"
 
+	// An interpolated string "a${x}b${y}c" is lexed as INTERP_START "a",
+	// the tokens of x, INTERP_MID "b", the tokens of y and INTERP_END "c".
+	INTERP_START = "INTERP_START"
+	INTERP_MID   = "INTERP_MID"
+	INTERP_END   = "INTERP_END"
+
 	// Operators
-	ASSIGN   = "="
+	ASSIGN          = "="
+	PLUS_ASSIGN     = "+="
+	MINUS_ASSIGN    = "-="
+	ASTERISK_ASSIGN = "*="
+	SLASH_ASSIGN    = "/="
+
 	PLUS     = "+"
 	MINUS    = "-"
 	BANG     = "!"
 	ASTERISK = "*"
 	SLASH    = "/"
+	PERCENT  = "%"
+	POWER    = "**"
+
+	AMPERSAND = "&"
+	PIPE      = "|"
+	CARET     = "^"
+	TILDE     = "~"
+	SHL       = "<<"
+	SHR       = ">>"
 
-	LT = "<"
-	GT = ">"
+	LT    = "<"
+	GT    = ">"
+	LT_EQ = "<="
+	GT_EQ = ">="
 
 	EQ     = "=="
 	NOT_EQ = "!="
 
+	AND     = "&&"
+	OR      = "||"
+	NULLISH = "??"
+
 	// Delimiters
 	COMMA     = ","
 	SEMICOLON = ";"
@@ -40,6 +113,14 @@ const (
 	LBRACKET = "["
 	RBRACKET = "]"
 	COLON    = ":"
+	DOT      = "."
+	DOTDOT   = ".."
+	ELLIPSIS = "..."
+	ARROW    = "=>"
+
+	// Optional access: a?.b, a?.m() and a?[i]
+	QUESTION_DOT     = "?."
+	QUESTION_BRACKET = "?["
 
 	// Keywords
 	FUNCTION = "FUNCTION"
@@ -50,17 +131,49 @@ const (
 	ELSE     = "ELSE"
 	RETURN   = "RETURN"
 	MACRO    = "MACRO"
+	WHILE    = "WHILE"
+	FOR      = "FOR"
+	BREAK    = "BREAK"
+	CONTINUE = "CONTINUE"
+	IN       = "IN"
+	MATCH    = "MATCH"
+	TRY      = "TRY"
+	CATCH    = "CATCH"
+	FINALLY  = "FINALLY"
+	THROW    = "THROW"
+	IMPORT   = "IMPORT"
+	EXPORT   = "EXPORT"
+	AS       = "AS"
+	CONST    = "CONST"
+	NULL     = "NULL"
+	STRUCT   = "STRUCT"
 )
 
 var keywords = map[string]TokenType{
-	"fn":     FUNCTION,
-	"let":    LET,
-	"true":   TRUE,
-	"false":  FALSE,
-	"if":     IF,
-	"else":   ELSE,
-	"return": RETURN,
-	"macro":  MACRO,
+	"fn":       FUNCTION,
+	"let":      LET,
+	"true":     TRUE,
+	"false":    FALSE,
+	"if":       IF,
+	"else":     ELSE,
+	"return":   RETURN,
+	"macro":    MACRO,
+	"while":    WHILE,
+	"for":      FOR,
+	"break":    BREAK,
+	"continue": CONTINUE,
+	"in":       IN,
+	"match":    MATCH,
+	"try":      TRY,
+	"catch":    CATCH,
+	"finally":  FINALLY,
+	"throw":    THROW,
+	"import":   IMPORT,
+	"export":   EXPORT,
+	"as":       AS,
+	"const":    CONST,
+	"null":     NULL,
+	"struct":   STRUCT,
 }
 
 func LookupIdent(ident string) TokenType {
@@ -0,0 +1,67 @@
+package vm
+
+import (
+	"monkey/object"
+)
+
+// handler is installed by OpTry: an error raised while it is in effect
+// resumes its frame at target with the stack cut back to sp.
+type handler struct {
+	target int
+	sp     int
+}
+
+// exception is an error on its way to a handler: a thrown value or a
+// runtime error, along with the position it was raised at.
+type exception struct {
+	err *object.Error
+}
+
+func (e *exception) Error() string {
+	if e.err.Pos.IsValid() {
+		return e.err.Pos.String() + ": " + e.err.Message
+	}
+	return e.err.Message
+}
+
+// raise returns the exception for a runtime error, positioned at the
+// instruction being executed.
+func (vm *VM) raise(err error) *exception {
+	if exc, ok := err.(*exception); ok {
+		return exc
+	}
+	errObj := &object.Error{Message: err.Error()}
+	errObj.Pos, _ = vm.currentFrame().Position()
+	return &exception{errObj}
+}
+
+// executeThrow raises value, or re-raises it unchanged if it is an error
+// a finally block caught on its way out.
+func (vm *VM) executeThrow(value object.Object) error {
+	if errObj, ok := value.(*object.Error); ok {
+		return &exception{errObj}
+	}
+	errObj := &object.Error{Message: "uncaught exception: " + value.Inspect(), Value: value}
+	errObj.Pos, _ = vm.currentFrame().Position()
+	return &exception{errObj}
+}
+
+// unwind passes err to the innermost handler in the frames above depth,
+// discarding the frames and stack values above it. It returns the error,
+// as an exception, if there is no such handler.
+func (vm *VM) unwind(err error, depth int) error {
+	exc := vm.raise(err)
+	for i := vm.framesIndex - 1; i >= depth; i-- {
+		frame := vm.frames[i]
+		if len(frame.handlers) == 0 {
+			continue
+		}
+		h := frame.handlers[len(frame.handlers)-1]
+		frame.handlers = frame.handlers[:len(frame.handlers)-1]
+		vm.framesIndex = i + 1
+		vm.sp = h.sp
+		frame.ip = h.target - 1
+		return vm.push(exc.err)
+	}
+	return exc
+}
@@ -3,12 +3,15 @@ package vm
 import (
 	"monkey/code"
 	"monkey/object"
+	"monkey/token"
 )
 
 type Frame struct {
 	cl          *object.Closure
 	ip          int
 	basePointer int
+	numArgs     int
+	handlers    []handler
 }
 
 func NewFrame(cl *object.Closure, basePointer int) *Frame {
@@ -18,3 +21,8 @@ func NewFrame(cl *object.Closure, basePointer int) *Frame {
 func (f *Frame) Instructions() code.Instructions {
 	return f.cl.Fn.Instructions
 }
+
+// Position returns the source position of the instruction being executed.
+func (f *Frame) Position() (token.Position, bool) {
+	return f.cl.Fn.SourceMap.Lookup(f.ip)
+}
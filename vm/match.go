@@ -0,0 +1,35 @@
+package vm
+
+import (
+	"fmt"
+	"monkey/object"
+)
+
+func (vm *VM) executeMatchArray(length int, hasRest bool) error {
+	array, ok := vm.pop().(*object.Array)
+	matched := ok && (len(array.Elements) == length || (hasRest && len(array.Elements) >= length))
+	return vm.push(nativeBoolToBooleanObject(matched))
+}
+
+func (vm *VM) executeMatchHash() error {
+	_, ok := vm.pop().(*object.Hash)
+	return vm.push(nativeBoolToBooleanObject(ok))
+}
+
+func (vm *VM) executeHasKey() error {
+	index := vm.pop()
+	hash := vm.pop().(*object.Hash)
+	key, ok := index.(object.Hashable)
+	if !ok {
+		return fmt.Errorf("unusable as hash key: %s", index.Type())
+	}
+	_, ok = hash.Pairs[key.HashKey()]
+	return vm.push(nativeBoolToBooleanObject(ok))
+}
+
+func (vm *VM) executeArrayRest(start int) error {
+	array := vm.pop().(*object.Array)
+	rest := make([]object.Object, len(array.Elements)-start)
+	copy(rest, array.Elements[start:])
+	return vm.push(&object.Array{Elements: rest})
+}
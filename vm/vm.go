@@ -1,10 +1,13 @@
 package vm
 
 import (
+	"errors"
 	"fmt"
 	"monkey/code"
 	"monkey/compiler"
+	"monkey/module"
 	"monkey/object"
+	"strings"
 )
 
 const StackSize = 2048
@@ -23,11 +26,17 @@ type VM struct {
 	globals     []object.Object
 	frames      []*Frame
 	framesIndex int
+	modules     map[*object.CompiledFunction]*object.Module // imported so far
 }
 
 func New(bytecode *compiler.Bytecode) *VM {
-	mainFn := &object.CompiledFunction{Instructions: bytecode.Instructions}
-	mainClosure := &object.Closure{Fn: mainFn, Free: nil}
+	mainFn := &object.CompiledFunction{
+		Instructions: bytecode.Instructions,
+		SourceMap:    bytecode.SourceMap,
+		NumLocals:    bytecode.NumLocals,
+	}
+	globals := make([]object.Object, GlobalsSize)
+	mainClosure := &object.Closure{Fn: mainFn, Free: nil, Globals: globals}
 	mainFrame := NewFrame(mainClosure, 0)
 
 	frames := make([]*Frame, MaxFrames)
@@ -36,10 +45,11 @@ func New(bytecode *compiler.Bytecode) *VM {
 	return &VM{
 		constants:   bytecode.Constants,
 		stack:       make([]object.Object, StackSize),
-		sp:          0,
-		globals:     make([]object.Object, GlobalsSize),
+		sp:          bytecode.NumLocals,
+		globals:     globals,
 		frames:      frames,
 		framesIndex: 1,
+		modules:     make(map[*object.CompiledFunction]*object.Module),
 	}
 }
 
@@ -60,6 +70,7 @@ func (vm *VM) popFrame() *Frame {
 func NewWithGlobalsStore(bytecode *compiler.Bytecode, s []object.Object) *VM {
 	vm := New(bytecode)
 	vm.globals = s
+	vm.frames[0].cl.Globals = s
 	return vm
 }
 
@@ -70,6 +81,15 @@ func (vm *VM) StackTop() object.Object {
 	return vm.stack[vm.sp-1]
 }
 
+// deref returns the value held by a captured variable's cell, or obj
+// itself if it is not a cell.
+func deref(obj object.Object) object.Object {
+	if cell, ok := obj.(*object.Cell); ok {
+		return cell.Value
+	}
+	return obj
+}
+
 func isTruthy(obj object.Object) bool {
 	switch obj := obj.(type) {
 	case *object.Boolean:
@@ -82,11 +102,32 @@ func isTruthy(obj object.Object) bool {
 }
 
 func (vm *VM) Run() error {
+	return vm.run(0)
+}
+
+// run executes instructions until the main function ends or, when a
+// higher-order builtin calls back into Monkey code, until the frames above
+// depth have returned. Errors are passed to the handlers in those frames,
+// and returned positioned where they were raised if there is none.
+func (vm *VM) run(depth int) error {
+	for {
+		err := vm.execute(depth)
+		if err == nil {
+			return nil
+		}
+		err = vm.unwind(err, depth)
+		if err != nil {
+			return err
+		}
+	}
+}
+
+func (vm *VM) execute(depth int) error {
 	var ip int
 	var ins code.Instructions
 	var op code.Opcode
 
-	for vm.currentFrame().ip < len(vm.currentFrame().Instructions())-1 {
+	for vm.framesIndex > depth && vm.currentFrame().ip < len(vm.currentFrame().Instructions())-1 {
 		vm.currentFrame().ip++
 		ip = vm.currentFrame().ip
 		ins = vm.currentFrame().Instructions()
@@ -102,6 +143,28 @@ func (vm *VM) Run() error {
 			if !isTruthy(condition) {
 				vm.currentFrame().ip = pos - 1
 			}
+		case code.OpJumpNotTruthyOrPop, code.OpJumpTruthyOrPop:
+			pos := int(code.ReadUInt16(ins[ip+1:]))
+			vm.currentFrame().ip += 2
+			if isTruthy(vm.stack[vm.sp-1]) == (op == code.OpJumpTruthyOrPop) {
+				vm.currentFrame().ip = pos - 1
+			} else {
+				vm.pop()
+			}
+		case code.OpJumpNotNullOrPop:
+			pos := int(code.ReadUInt16(ins[ip+1:]))
+			vm.currentFrame().ip += 2
+			if _, null := vm.stack[vm.sp-1].(*object.Null); !null {
+				vm.currentFrame().ip = pos - 1
+			} else {
+				vm.pop()
+			}
+		case code.OpJumpNull:
+			pos := int(code.ReadUInt16(ins[ip+1:]))
+			vm.currentFrame().ip += 2
+			if _, null := vm.stack[vm.sp-1].(*object.Null); null {
+				vm.currentFrame().ip = pos - 1
+			}
 		case code.OpArray:
 			numElements := int(code.ReadUInt16(ins[ip+1:]))
 			vm.currentFrame().ip += 2
@@ -111,6 +174,15 @@ func (vm *VM) Run() error {
 			if err != nil {
 				return err
 			}
+		case code.OpConcat:
+			numParts := int(code.ReadUInt16(ins[ip+1:]))
+			vm.currentFrame().ip += 2
+			str := vm.buildString(vm.sp-numParts, vm.sp)
+			vm.sp = vm.sp - numParts
+			err := vm.push(str)
+			if err != nil {
+				return err
+			}
 		case code.OpCall:
 			numArgs := code.ReadUInt8(ins[ip+1:])
 			vm.currentFrame().ip += 1
@@ -119,16 +191,51 @@ func (vm *VM) Run() error {
 				return err
 			}
 
+		case code.OpCallSpread:
+			err := vm.executeCallSpread()
+			if err != nil {
+				return err
+			}
+
+		case code.OpSpread:
+			err := vm.executeSpread()
+			if err != nil {
+				return err
+			}
+
+		case code.OpArgMissing:
+			paramIndex := code.ReadUInt8(ins[ip+1:])
+			vm.currentFrame().ip += 1
+			err := vm.push(nativeBoolToBooleanObject(int(paramIndex) >= vm.currentFrame().numArgs))
+			if err != nil {
+				return err
+			}
+
 		case code.OpSetLocal:
 			localIndex := code.ReadUInt8(ins[ip+1:])
 			vm.currentFrame().ip += 1
 			frame := vm.currentFrame()
 			vm.stack[frame.basePointer+int(localIndex)] = vm.pop()
+		case code.OpAssignLocal:
+			localIndex := code.ReadUInt8(ins[ip+1:])
+			vm.currentFrame().ip += 1
+			frame := vm.currentFrame()
+			slot := frame.basePointer + int(localIndex)
+			if cell, ok := vm.stack[slot].(*object.Cell); ok {
+				cell.Value = vm.pop()
+			} else {
+				vm.stack[slot] = vm.pop()
+			}
+		case code.OpAssignFree:
+			freeIndex := code.ReadUInt8(ins[ip+1:])
+			vm.currentFrame().ip += 1
+			currentClosure := vm.currentFrame().cl
+			currentClosure.Free[freeIndex].(*object.Cell).Value = vm.pop()
 		case code.OpGetFree:
 			freeIndex := code.ReadUInt8(ins[ip+1:])
 			vm.currentFrame().ip += 1
 			currentClosure := vm.currentFrame().cl
-			err := vm.push(currentClosure.Free[freeIndex])
+			err := vm.push(deref(currentClosure.Free[freeIndex]))
 			if err != nil {
 				return err
 			}
@@ -136,7 +243,29 @@ func (vm *VM) Run() error {
 			localIndex := code.ReadUInt8(ins[ip+1:])
 			vm.currentFrame().ip += 1
 			frame := vm.currentFrame()
-			err := vm.push(vm.stack[frame.basePointer+int(localIndex)])
+			err := vm.push(deref(vm.stack[frame.basePointer+int(localIndex)]))
+			if err != nil {
+				return err
+			}
+		case code.OpCaptureLocal:
+			localIndex := code.ReadUInt8(ins[ip+1:])
+			vm.currentFrame().ip += 1
+			frame := vm.currentFrame()
+			slot := frame.basePointer + int(localIndex)
+			cell, ok := vm.stack[slot].(*object.Cell)
+			if !ok {
+				cell = &object.Cell{Value: vm.stack[slot]}
+				vm.stack[slot] = cell
+			}
+			err := vm.push(cell)
+			if err != nil {
+				return err
+			}
+		case code.OpCaptureFree:
+			freeIndex := code.ReadUInt8(ins[ip+1:])
+			vm.currentFrame().ip += 1
+			currentClosure := vm.currentFrame().cl
+			err := vm.push(currentClosure.Free[freeIndex])
 			if err != nil {
 				return err
 			}
@@ -170,7 +299,7 @@ func (vm *VM) Run() error {
 		case code.OpSetGlobal:
 			globalIndex := code.ReadUInt16(ins[ip+1:])
 			vm.currentFrame().ip += 2
-			vm.globals[globalIndex] = vm.pop()
+			vm.currentFrame().cl.Globals[globalIndex] = vm.pop()
 		case code.OpGetBuiltin:
 			builtinIndex := code.ReadUInt8(ins[ip+1:])
 			vm.currentFrame().ip += 1
@@ -182,7 +311,7 @@ func (vm *VM) Run() error {
 		case code.OpGetGlobal:
 			globalIndex := code.ReadUInt16(ins[ip+1:])
 			vm.currentFrame().ip += 2
-			err := vm.push(vm.globals[globalIndex])
+			err := vm.push(vm.currentFrame().cl.Globals[globalIndex])
 			if err != nil {
 				return err
 			}
@@ -193,16 +322,14 @@ func (vm *VM) Run() error {
 			if err != nil {
 				return err
 			}
-		case code.OpAdd:
-			vm.executeBinaryOperation(op)
-		case code.OpSub:
-			right := vm.pop()
-			left := vm.pop()
-			leftValue := left.(*object.Integer).Value
-			rightValue := right.(*object.Integer).Value
-			result := leftValue - rightValue
-			vm.push(&object.Integer{Value: result})
-		case code.OpEqual, code.OpNotEqual, code.OpGreaterThan:
+		case code.OpAdd, code.OpSub, code.OpMul, code.OpDiv, code.OpMod, code.OpPow,
+			code.OpBitAnd, code.OpBitOr, code.OpBitXor, code.OpShiftLeft, code.OpShiftRight:
+			err := vm.executeBinaryOperation(op)
+			if err != nil {
+				return err
+			}
+		case code.OpEqual, code.OpNotEqual, code.OpGreaterThan, code.OpLessThan,
+			code.OpGreaterEqual, code.OpLessEqual:
 			err := vm.executeComparison(op)
 			if err != nil {
 				return err
@@ -217,20 +344,77 @@ func (vm *VM) Run() error {
 			if err != nil {
 				return err
 			}
-		case code.OpDiv:
-			right := vm.pop()
-			left := vm.pop()
-			leftValue := left.(*object.Integer).Value
-			rightValue := right.(*object.Integer).Value
-			result := leftValue / rightValue
-			vm.push(&object.Integer{Value: result})
-		case code.OpMul:
-			right := vm.pop()
-			left := vm.pop()
-			leftValue := left.(*object.Integer).Value
-			rightValue := right.(*object.Integer).Value
-			result := rightValue * leftValue
-			vm.push(&object.Integer{Value: result})
+		case code.OpBitNot:
+			err := vm.executeBitNotOperator()
+			if err != nil {
+				return err
+			}
+		case code.OpRange:
+			err := vm.executeRangeOperator()
+			if err != nil {
+				return err
+			}
+		case code.OpMatchArray:
+			length := int(code.ReadUInt16(ins[ip+1:]))
+			hasRest := code.ReadUInt8(ins[ip+3:]) == 1
+			vm.currentFrame().ip += 3
+			err := vm.executeMatchArray(length, hasRest)
+			if err != nil {
+				return err
+			}
+		case code.OpMatchHash:
+			err := vm.executeMatchHash()
+			if err != nil {
+				return err
+			}
+		case code.OpHasKey:
+			err := vm.executeHasKey()
+			if err != nil {
+				return err
+			}
+		case code.OpArrayRest:
+			start := int(code.ReadUInt16(ins[ip+1:]))
+			vm.currentFrame().ip += 2
+			err := vm.executeArrayRest(start)
+			if err != nil {
+				return err
+			}
+		case code.OpMatchError:
+			return fmt.Errorf("no match arm matched %s", vm.pop().Inspect())
+		case code.OpDestructureError:
+			constIndex := code.ReadUInt16(ins[ip+1:])
+			vm.currentFrame().ip += 2
+			return fmt.Errorf("cannot destructure %s into %s", vm.pop().Inspect(), vm.constants[constIndex].Inspect())
+		case code.OpGetIterator:
+			obj := vm.pop()
+			iterable, ok := obj.(object.Iterable)
+			if !ok {
+				return fmt.Errorf("cannot iterate over %s", obj.Type())
+			}
+			err := vm.push(iterable.NewIterator())
+			if err != nil {
+				return err
+			}
+		case code.OpIterNext:
+			pos := int(code.ReadUInt16(ins[ip+1:]))
+			vm.currentFrame().ip += 2
+			it, ok := vm.stack[vm.sp-1].(object.Iterator)
+			if !ok {
+				return fmt.Errorf("cannot iterate over %s", vm.stack[vm.sp-1].Type())
+			}
+			key, value, ok := it.Next()
+			if !ok {
+				vm.currentFrame().ip = pos - 1
+				break
+			}
+			err := vm.push(key)
+			if err != nil {
+				return err
+			}
+			err = vm.push(value)
+			if err != nil {
+				return err
+			}
 		case code.OpTrue:
 			err := vm.push(True)
 			if err != nil {
@@ -257,6 +441,68 @@ func (vm *VM) Run() error {
 			if err != nil {
 				return err
 			}
+		case code.OpGetMethod:
+			constIndex := code.ReadUInt16(ins[ip+1:])
+			vm.currentFrame().ip += 2
+			name := vm.constants[constIndex].(*object.String).Value
+			receiver := vm.pop()
+			method, ok := object.Method(receiver, name)
+			if !ok {
+				return fmt.Errorf("undefined method %s for %s", name, receiver.Type())
+			}
+			err := vm.push(method)
+			if err != nil {
+				return err
+			}
+		case code.OpImport:
+			constIndex := code.ReadUInt16(ins[ip+1:])
+			pathIndex := code.ReadUInt16(ins[ip+3:])
+			vm.currentFrame().ip += 4
+			fn := vm.constants[constIndex].(*object.CompiledFunction)
+			err := vm.executeImport(fn, vm.constants[pathIndex].(*object.String).Value)
+			if err != nil {
+				return err
+			}
+		case code.OpTry:
+			target := int(code.ReadUInt16(ins[ip+1:]))
+			vm.currentFrame().ip += 2
+			frame := vm.currentFrame()
+			frame.handlers = append(frame.handlers, handler{target: target, sp: vm.sp})
+		case code.OpEndTry:
+			frame := vm.currentFrame()
+			frame.handlers = frame.handlers[:len(frame.handlers)-1]
+		case code.OpThrow:
+			return vm.executeThrow(vm.pop())
+		case code.OpCatch:
+			errObj := vm.pop().(*object.Error)
+			err := vm.push(errObj.Thrown())
+			if err != nil {
+				return err
+			}
+		case code.OpSetIndex:
+			value := vm.pop()
+			index := vm.pop()
+			left := vm.pop()
+			err := vm.executeSetIndex(left, index, value)
+			if err != nil {
+				return err
+			}
+		case code.OpDup2:
+			err := vm.push(vm.stack[vm.sp-2])
+			if err == nil {
+				err = vm.push(vm.stack[vm.sp-2])
+			}
+			if err != nil {
+				return err
+			}
+		case code.OpSlice:
+			end := vm.pop()
+			start := vm.pop()
+			left := vm.pop()
+			err := vm.executeSliceExpression(left, start, end)
+			if err != nil {
+				return err
+			}
 		case code.OpFalse:
 			err := vm.push(False)
 			if err != nil {
@@ -286,10 +532,33 @@ func (vm *VM) pushClosure(constIndex int, numFree int) error {
 		free[i] = vm.stack[vm.sp-numFree+i]
 	}
 	vm.sp = vm.sp - numFree
-	closure := &object.Closure{Fn: function, Free: free}
+	closure := &object.Closure{Fn: function, Free: free, Globals: vm.currentFrame().cl.Globals}
 	return vm.push(closure)
 }
 
+// executeImport pushes the module whose top-level code is fn, running the
+// code with fresh globals the first time the module is imported from path.
+func (vm *VM) executeImport(fn *object.CompiledFunction, path string) error {
+	mod, ok := vm.modules[fn]
+	if !ok {
+		body := &object.Closure{Fn: fn, Globals: make([]object.Object, GlobalsSize)}
+		framesIndex := vm.framesIndex
+		exports, err := vm.callFunction(body, nil)
+		if err != nil {
+			// Back in the importing frame, so that the error is positioned
+			// at the import statement.
+			vm.framesIndex = framesIndex
+			return &module.ImportError{Path: path, Err: err}
+		}
+		mod = &object.Module{Name: fn.Module, Exports: make(map[string]object.Object)}
+		for _, pair := range exports.(*object.Hash).Pairs {
+			mod.Exports[pair.Key.(*object.String).Value] = pair.Value
+		}
+		vm.modules[fn] = mod
+	}
+	return vm.push(mod)
+}
+
 func (vm *VM) executeCall(numArgs int) error {
 	callee := vm.stack[vm.sp-1-numArgs]
 	switch callee := callee.(type) {
@@ -297,24 +566,125 @@ func (vm *VM) executeCall(numArgs int) error {
 		return vm.callBuiltin(callee, numArgs)
 	case *object.Closure:
 		return vm.callClosure(callee, numArgs)
+	case *object.StructType:
+		value, err := callee.New(vm.stack[vm.sp-numArgs : vm.sp])
+		if err != nil {
+			return err
+		}
+		vm.sp = vm.sp - numArgs - 1
+		return vm.push(value)
 	default:
-		return fmt.Errorf("calling non-function and non-builtin")
+		return fmt.Errorf("not a function: %s", callee.Type())
 	}
 }
 
 func (vm *VM) callClosure(cl *object.Closure, numArgs int) error {
-	if numArgs != cl.Fn.NumParameters {
-		return fmt.Errorf("wrong number of arguments. want=%d, got=%d", cl.Fn.NumParameters, numArgs)
+	if arity := cl.Fn.Arity(); !arity.Accepts(numArgs) {
+		return fmt.Errorf("wrong number of arguments. want=%s, got=%d", arity, numArgs)
 	}
 	frame := NewFrame(cl, vm.sp-numArgs)
+	frame.numArgs = numArgs
+
+	if cl.Fn.Variadic {
+		restIndex := frame.basePointer + cl.Fn.NumParameters
+		rest := []object.Object{}
+		if numArgs > cl.Fn.NumParameters {
+			rest = append(rest, vm.stack[restIndex:vm.sp]...)
+		}
+		vm.stack[restIndex] = &object.Array{Elements: rest}
+	}
+
 	vm.pushFrame(frame)
 	vm.sp = frame.basePointer + cl.Fn.NumLocals
 	return nil
 }
 
+// callHigherOrder runs a builtin that calls back into Monkey code. Each
+// callback runs on top of the current stack until its frame returns. A
+// runtime error in a callback stops the builtin and is returned with the
+// failing frame left current, so that it is reported at its position.
+func (vm *VM) callHigherOrder(builtin *object.Builtin, args []object.Object) (object.Object, error) {
+	var callErr error
+	call := func(fn object.Object, callArgs ...object.Object) object.Object {
+		if callErr != nil {
+			return &object.Error{Message: callErr.Error()}
+		}
+		result, err := vm.callFunction(fn, callArgs)
+		if err != nil {
+			callErr = err
+			return &object.Error{Message: err.Error()}
+		}
+		return result
+	}
+	result := builtin.HigherOrderFn(call, args...)
+	return result, callErr
+}
+
+func (vm *VM) callFunction(fn object.Object, args []object.Object) (object.Object, error) {
+	depth := vm.framesIndex
+	err := vm.push(fn)
+	for _, arg := range args {
+		if err != nil {
+			break
+		}
+		err = vm.push(arg)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	err = vm.executeCall(len(args))
+	if err != nil {
+		return nil, err
+	}
+	err = vm.run(depth)
+	if err != nil {
+		return nil, err
+	}
+	return vm.pop(), nil
+}
+
+// executeCallSpread replaces an array of arguments with its elements and
+// calls the function below them.
+func (vm *VM) executeCallSpread() error {
+	args := vm.pop().(*object.Array)
+	for _, arg := range args.Elements {
+		err := vm.push(arg)
+		if err != nil {
+			return err
+		}
+	}
+	return vm.executeCall(len(args.Elements))
+}
+
+func (vm *VM) executeSpread() error {
+	value := vm.pop()
+	spread, ok := value.(*object.Array)
+	if !ok {
+		return fmt.Errorf("cannot spread %s", value.Type())
+	}
+	// The array below is always one the compiler built for this list, so
+	// it can be extended in place.
+	array := vm.pop().(*object.Array)
+	array.Elements = append(array.Elements, spread.Elements...)
+	return vm.push(array)
+}
+
 func (vm *VM) callBuiltin(builtin *object.Builtin, numArgs int) error {
 	args := vm.stack[vm.sp-numArgs : vm.sp]
-	result := builtin.Fn(args...)
+	var result object.Object
+	if builtin.HigherOrderFn != nil {
+		var err error
+		result, err = vm.callHigherOrder(builtin, args)
+		if err != nil {
+			return err
+		}
+	} else {
+		result = builtin.Fn(args...)
+	}
+	if errObj, ok := result.(*object.Error); ok {
+		return errors.New(errObj.Message)
+	}
 	vm.sp = vm.sp - numArgs - 1
 	if result != nil {
 		vm.push(result)
@@ -328,13 +698,70 @@ func (vm *VM) executeIndexExpression(left, index object.Object) error {
 	switch {
 	case left.Type() == object.ARRAY_OBJ && index.Type() == object.INTEGER_OBJ:
 		return vm.executeArrayIndex(left, index)
+	case left.Type() == object.STRING_OBJ && index.Type() == object.INTEGER_OBJ:
+		return vm.executeStringIndex(left, index)
 	case left.Type() == object.HASH_OBJ:
 		return vm.executeHashIndex(left, index)
+	case left.Type() == object.MODULE_OBJ && index.Type() == object.STRING_OBJ:
+		value, err := left.(*object.Module).Export(index.(*object.String).Value)
+		if err != nil {
+			return err
+		}
+		return vm.push(value)
+	case left.Type() == object.STRUCT_OBJ && index.Type() == object.STRING_OBJ:
+		value, err := left.(*object.Struct).Field(index.(*object.String).Value)
+		if err != nil {
+			return err
+		}
+		return vm.push(value)
 	default:
 		return fmt.Errorf("index operator not supported: %s", left.Type())
 	}
 }
 
+func (vm *VM) executeSetIndex(left, index, value object.Object) error {
+	switch left := left.(type) {
+	case *object.Array:
+		i, ok := index.(*object.Integer)
+		if !ok {
+			return fmt.Errorf("array index must be an integer, got %s", index.Type())
+		}
+		if i.Value < 0 || i.Value >= int64(len(left.Elements)) {
+			return fmt.Errorf("index %d out of range for array of length %d", i.Value, len(left.Elements))
+		}
+		left.Elements[i.Value] = value
+	case *object.Hash:
+		key, ok := index.(object.Hashable)
+		if !ok {
+			return fmt.Errorf("unusable as hash key: %s", index.Type())
+		}
+		left.Pairs[key.HashKey()] = object.HashPair{Key: index, Value: value}
+	case *object.Struct:
+		name, ok := index.(*object.String)
+		if !ok {
+			return fmt.Errorf("struct field name must be a string, got %s", index.Type())
+		}
+		if err := left.SetField(name.Value, value); err != nil {
+			return err
+		}
+	default:
+		return fmt.Errorf("index assignment not supported: %s", left.Type())
+	}
+	return vm.push(value)
+}
+
+func (vm *VM) executeSliceExpression(left, start, end object.Object) error {
+	sliceable, ok := left.(object.Sliceable)
+	if !ok {
+		return fmt.Errorf("slice operator not supported: %s", left.Type())
+	}
+	lo, hi, err := object.SliceBounds(start, end, sliceable.Len())
+	if err != nil {
+		return err
+	}
+	return vm.push(sliceable.Slice(lo, hi))
+}
+
 func (vm *VM) executeArrayIndex(array, index object.Object) error {
 	arrayObject := array.(*object.Array)
 	i := index.(*object.Integer).Value
@@ -345,6 +772,14 @@ func (vm *VM) executeArrayIndex(array, index object.Object) error {
 	return vm.push(arrayObject.Elements[i])
 }
 
+func (vm *VM) executeStringIndex(str, index object.Object) error {
+	char, ok := str.(*object.String).CharAt(index.(*object.Integer).Value)
+	if !ok {
+		return vm.push(Null)
+	}
+	return vm.push(char)
+}
+
 func (vm *VM) executeHashIndex(hash, index object.Object) error {
 	hashObject := hash.(*object.Hash)
 	key, ok := index.(object.Hashable)
@@ -366,7 +801,7 @@ func (vm *VM) buildHash(startIndex, endIndex int) (*object.Hash, error) {
 		pair := object.HashPair{Key: key, Value: value}
 		hashKey, ok := key.(object.Hashable)
 		if !ok {
-			return nil, fmt.Errorf("unusuable as hashkey: %s", key.Type())
+			return nil, fmt.Errorf("unusable as hash key: %s", key.Type())
 		}
 		pairs[hashKey.HashKey()] = pair
 	}
@@ -381,92 +816,14 @@ func (vm *VM) buildArray(startIndex, endIndex int) *object.Array {
 	return &object.Array{Elements: elements}
 }
 
-func (vm *VM) executeComparison(op code.Opcode) error {
-	right := vm.pop()
-	left := vm.pop()
-	if left.Type() == object.INTEGER_OBJ && right.Type() == object.INTEGER_OBJ {
-		return vm.executeIntegerComparison(op, left, right)
-	}
-	switch op {
-	case code.OpEqual:
-		return vm.push(nativeBoolToBooleanObject(left == right))
-	case code.OpNotEqual:
-		return vm.push(nativeBoolToBooleanObject(left != right))
-	default:
-		return fmt.Errorf("unknown operator: %d (%s %s)", op, left.Type(), right.Type())
-	}
-}
-
-func (vm *VM) executeIntegerComparison(op code.Opcode, left, right object.Object) error {
-	leftValue := left.(*object.Integer).Value
-	rightValue := right.(*object.Integer).Value
-
-	switch op {
-	case code.OpEqual:
-		return vm.push(nativeBoolToBooleanObject(rightValue == leftValue))
-	case code.OpNotEqual:
-		return vm.push(nativeBoolToBooleanObject(rightValue != leftValue))
-	case code.OpGreaterThan:
-		return vm.push(nativeBoolToBooleanObject(leftValue > rightValue))
-	default:
-		return fmt.Errorf("unknown operator: %d (%s %s)", op, left.Type(), right.Type())
-	}
-}
-
-func (vm *VM) executeBangOperator() error {
-	operand := vm.pop()
-	switch operand {
-	case True:
-		return vm.push(False)
-	case False:
-		return vm.push(True)
-	case Null:
-		return vm.push(True)
-	default:
-		return vm.push(False)
-	}
-}
-
-func (vm *VM) executeMinusOperator() error {
-	operand := vm.pop()
-	if operand.Type() != object.INTEGER_OBJ {
-		return fmt.Errorf("unsupported type for negation: %s", operand.Type())
-	}
-	value := operand.(*object.Integer).Value
-	return vm.push(&object.Integer{Value: -value})
-}
-
-func (vm *VM) executeBinaryOperation(op code.Opcode) error {
-	right := vm.pop()
-	left := vm.pop()
-	leftType := left.Type()
-	rightType := right.Type()
-	switch {
-	case leftType == object.INTEGER_OBJ && rightType == object.INTEGER_OBJ:
-		return vm.executeBinaryIntegerOperation(op, left, right)
-	case leftType == object.STRING_OBJ && rightType == object.STRING_OBJ:
-		return vm.executeBinaryStringOperation(op, left, right)
-	default:
-		return fmt.Errorf("unsupported types for binary operation: %s %s", leftType, rightType)
-	}
-}
-
-func (vm *VM) executeBinaryStringOperation(op code.Opcode, left, right object.Object) error {
-	if op != code.OpAdd {
-		return fmt.Errorf("unknown string operator: %d", op)
-	}
-	leftValue := left.(*object.String).Value
-	rightValue := right.(*object.String).Value
-	return vm.push(&object.String{Value: leftValue + rightValue})
-}
-
-func (vm *VM) executeBinaryIntegerOperation(op code.Opcode, left, right object.Object) error {
-	if op != code.OpAdd {
-		return fmt.Errorf("unknown integer operator: %d", op)
+// buildString concatenates the stack values in [startIndex, endIndex),
+// converting values that are not strings with Inspect.
+func (vm *VM) buildString(startIndex, endIndex int) *object.String {
+	var out strings.Builder
+	for i := startIndex; i < endIndex; i++ {
+		out.WriteString(vm.stack[i].Inspect())
 	}
-	leftValue := left.(*object.Integer).Value
-	rightValue := right.(*object.Integer).Value
-	return vm.push(&object.Integer{Value: leftValue + rightValue})
+	return &object.String{Value: out.String()}
 }
 
 func nativeBoolToBooleanObject(input bool) *object.Boolean {
@@ -3,10 +3,14 @@ package vm
 import (
 	"fmt"
 	"monkey/ast"
+	"monkey/code"
 	"monkey/compiler"
+	"monkey/evaluator"
 	"monkey/lexer"
+	"monkey/module"
 	"monkey/object"
 	"monkey/parser"
+	"os"
 	"testing"
 )
 
@@ -61,6 +65,11 @@ func testExpectedObject(t *testing.T, expected interface{}, actual object.Object
 		if err != nil {
 			t.Errorf("testIntegerObject failed. %s", err)
 		}
+	case float64:
+		err := testFloatObject(expected, actual)
+		if err != nil {
+			t.Errorf("testFloatObject failed. %s", err)
+		}
 	case string:
 		err := testStringObject(expected, actual)
 		if err != nil {
@@ -122,6 +131,17 @@ func testExpectedObject(t *testing.T, expected interface{}, actual object.Object
 	}
 }
 
+func testFloatObject(expected float64, actual object.Object) error {
+	result, ok := actual.(*object.Float)
+	if !ok {
+		return fmt.Errorf("object is not Float. got=%T (%+v)", actual, actual)
+	}
+	if result.Value != expected {
+		return fmt.Errorf("object has wrong value. got=%g, want=%g", result.Value, expected)
+	}
+	return nil
+}
+
 func testStringObject(expected string, actual object.Object) error {
 	result, ok := actual.(*object.String)
 	if !ok {
@@ -172,6 +192,30 @@ func TestIntegerArithmetic(t *testing.T) {
 	runVmTests(t, tests)
 }
 
+func TestFloatArithmetic(t *testing.T) {
+	tests := []vmTestCase{
+		{"1.5", 1.5},
+		{"-2.25", -2.25},
+		{"1e3", 1000.0},
+		{"1.5 + 1.5", 3.0},
+		{"1 + 0.5", 1.5},
+		{"0.5 * 4", 2.0},
+		{"7 / 2.0", 3.5},
+		{"10 - 2.5 * 2", 5.0},
+		{"let total = 3; let count = 4; total / float(count)", 0.75},
+		{"1.5 < 2", true},
+		{"2 > 2.5", false},
+		{"1 == 1.0", true},
+		{"int(3.9)", 3},
+		{"float(2)", 2.0},
+		{`float("1.25")`, 1.25},
+		{"str(1.5)", "1.5"},
+		{"str(2.0)", "2.0"},
+	}
+
+	runVmTests(t, tests)
+}
+
 func TestConditionals(t *testing.T) {
 	tests := []vmTestCase{
 		{"if (1>2) {10} else {20}", 20},
@@ -185,11 +229,97 @@ func TestConditionals(t *testing.T) {
 	runVmTests(t, tests)
 }
 
+func TestOperators(t *testing.T) {
+	tests := []vmTestCase{
+		{"1 <= 2", true},
+		{"2 <= 2", true},
+		{"3 <= 2", false},
+		{"2 >= 3", false},
+		{"3 >= 3", true},
+		{"1.5 <= 1", false},
+		{`"abc" < "abd"`, true},
+		{`"b" >= "a"`, true},
+		{`"abc" == "abc"`, true},
+		{`"abc" != "abc"`, false},
+		{"7 % 3", 1},
+		{"-7 % 3", -1},
+		{"7.5 % 2", 1.5},
+		{"2 ** 10", 1024},
+		{"2 ** 3 ** 2", 512},
+		{"-2 ** 2", -4},
+		{"2 ** -1", 0.5},
+		{"2.0 ** 0.5 > 1.41", true},
+		{"0b1100 & 0b1010", 8},
+		{"0b1100 | 0b1010", 14},
+		{"0b1100 ^ 0b1010", 6},
+		{"~0", -1},
+		{"1 << 10", 1024},
+		{"-16 >> 2", -4},
+		{"0o755 & 0o111 == 0o111", true},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestOperatorErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"5 % 0", "1:3: division by zero"},
+		{"1 << -1", "1:3: negative shift count: -1"},
+		{"1.5 & 1", "1:5: unknown operator: FLOAT & INTEGER"},
+		{`"a" * 2`, "1:5: type mismatch: STRING * INTEGER"},
+		{`"a" - "b"`, "1:5: unknown operator: STRING - STRING"},
+		{"true < false", "1:6: unknown operator: BOOLEAN < BOOLEAN"},
+		{"struct P { x }; P(1) < P(1)", "1:22: unknown operator: STRUCT < STRUCT"},
+		{"~1.5", "1:1: unknown operator: ~FLOAT"},
+	}
+
+	for _, tt := range tests {
+		program := parse(tt.input)
+		comp := compiler.New()
+		err := comp.Compile(program)
+		if err != nil {
+			t.Fatalf("compiler error: %s", err)
+		}
+		machine := New(comp.Bytecode())
+		err = machine.Run()
+		if err == nil {
+			t.Fatalf("expected VM error for %q but resulted in none.", tt.input)
+		}
+		if err.Error() != tt.expected {
+			t.Errorf("wrong VM error. want=%q, got=%q", tt.expected, err)
+		}
+	}
+}
+
+func TestLogicalOperators(t *testing.T) {
+	tests := []vmTestCase{
+		{"true && true", true},
+		{"true && false", false},
+		{"false || true", true},
+		{"false || false", false},
+		{"1 < 2 && 2 < 3", true},
+		{`1 && "yes"`, "yes"},
+		{`false || "default"`, "default"},
+		{"if (1 > 2) { 10 } || 5", 5},
+		{"let boom = fn() { -true }; false && boom()", false},
+		{"let boom = fn() { -true }; true || boom()", true},
+		{"let n = 0; let check = fn(x) { x > 0 && 10 / x > 1 }; check(n)", false},
+	}
+
+	runVmTests(t, tests)
+}
+
 func TestStringExpressions(t *testing.T) {
 	tests := []vmTestCase{
 		{`"monkey"`, "monkey"},
 		{`"mon"+"key"`, "monkey"},
 		{`"mon"+"key"+"banana"`, "monkeybanana"},
+		{`let name = "Bob"; "Hello ${name}!"`, "Hello Bob!"},
+		{`let items = [1, 2]; "${len(items)} items, first ${items[0]}"`, "2 items, first 1"},
+		{`"${true}${"${1 + 1}"}"`, "true2"},
 	}
 
 	runVmTests(t, tests)
@@ -226,6 +356,27 @@ func TestIndexExpressions(t *testing.T) {
 		{`{1:1,2:2}[1]`, 1},
 		{`{1:1,2:2}[2]`, 2},
 		{`{1:1}[0]`, Null},
+		{`{1:1}[1.0]`, 1},
+		{`{2.0:2}[2]`, 2},
+		{`{1:1}[1.5]`, Null},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestSliceExpressions(t *testing.T) {
+	tests := []vmTestCase{
+		{`[1, 2, 3, 4][1:3]`, []interface{}{2, 3}},
+		{`[1, 2, 3, 4][:2]`, []interface{}{1, 2}},
+		{`[1, 2, 3, 4][2:]`, []interface{}{3, 4}},
+		{`[1, 2, 3, 4][-3:-1]`, []interface{}{2, 3}},
+		{`[1, 2, 3, 4][:]`, []interface{}{1, 2, 3, 4}},
+		{`[1, 2, 3][3:1]`, []interface{}{}},
+		{`[1, 2, 3][-10:10]`, []interface{}{1, 2, 3}},
+		{`"hello"[1:4]`, "ell"},
+		{`"héllo"[-4:]`, "éllo"},
+		{`"abc"[5:]`, ""},
+		{`let take = fn(xs, n) { xs[:n] }; let drop = fn(xs, n) { xs[n:] }; take(drop([1, 2, 3, 4, 5], 1), 2)`, []interface{}{2, 3}},
 	}
 
 	runVmTests(t, tests)
@@ -285,6 +436,457 @@ func TestClosures(t *testing.T) {
 
 }
 
+func TestAssignments(t *testing.T) {
+	tests := []vmTestCase{
+		{"let x = 1; x = 2; x", 2},
+		{"let x = 1; x += 2; x", 3},
+		{"let x = 10; x -= 2; x *= 3; x /= 4; x", 6},
+		{"let x = 1; let y = 2; x = y = 5; x + y", 10},
+		{`let s = "a"; s += "b"`, "ab"},
+		{"let f = fn() { let x = 1; x += 1; x }; f()", 2},
+		{"let x = 1; let f = fn() { x = 5 }; f(); x", 5},
+		{"let counter = fn() { let n = 0; fn() { n += 1 } }; let c = counter(); c(); c(); c()", 3},
+		{"let counter = fn() { let n = 0; fn() { n += 1 } }; let a = counter(); let b = counter(); a(); a(); b()", 1},
+		{"let f = fn() { let n = 0; let inc = fn() { n += 1 }; inc(); inc(); n }; f()", 2},
+		{"let f = fn() { let n = 0; let get = fn() { n }; n = 7; get() }; f()", 7},
+		{"let f = fn(n) { let g = fn() { fn() { n *= 2 } }; g()(); g()(); n }; f(3)", 12},
+		{"let f = fn() { f = 1 }; f()", 1},
+		{"let f = fn() { f = 1 }; f(); f", 1},
+		{"let g = fn() { let f = fn() { f = 5 }; f(); f }; g()", 5},
+		{"let f = fn() { let h = fn() { f = 2 }; h() }; f(); f", 2},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestIndexAssignments(t *testing.T) {
+	tests := []vmTestCase{
+		{`let a = [1, 2, 3]; a[1] = 5; a`, []interface{}{1, 5, 3}},
+		{`let a = [1, 2, 3]; a[0] += 10; a[0]`, 11},
+		{`let h = {"a": 1}; h["b"] = 2; h["a"] + h["b"]`, 3},
+		{`let h = {"n": 1}; h["n"] *= 5; h["n"]`, 5},
+		{`let a = [[0, 0], [0, 0]]; a[1][0] = 7; a`, []interface{}{[]interface{}{0, 0}, []interface{}{7, 0}}},
+		{`let a = [0]; let f = fn(xs) { xs[0] = 9 }; f(a); a[0]`, 9},
+		{`let a = [1]; a[0] = 2`, 2},
+		{`let xs = []; for (i in 0..5) { append(xs, i * i) }; xs`, []interface{}{0, 1, 4, 9, 16}},
+		{`let xs = [1]; append(xs, 2, 3) == xs`, true},
+		{`let xs = [1, 2, 3]; delete(xs, 1) + len(xs)`, 4},
+		{`let xs = [1]; delete(xs, 5)`, Null},
+		{`let h = {"a": 1, "b": 2}; delete(h, "a") + h["b"]`, 3},
+		{`let h = {"a": 1}; delete(h, "a"); h`, map[object.HashKey]int64{}},
+		{`let a = [1]; append(a, a); str(a)`, "[1, [...]]"},
+		{`let h = {}; h["self"] = h; str(h)`, "{self:{...}}"},
+		{`let b = [1]; let a = [b, b]; str(a)`, "[[1], [1]]"},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestMethodCalls(t *testing.T) {
+	tests := []vmTestCase{
+		{`let user = {"address": {"city": "Oslo"}}; user.address.city`, "Oslo"},
+		{`let h = {"n": 1}; h.n = 5; h.n += 1; h["n"]`, 6},
+		{`"abc".upper()`, "ABC"},
+		{`"a,b".split(",").join("-")`, "a-b"},
+		{`[1, 2, 3].map(fn(x) { x * 2 })`, []interface{}{2, 4, 6}},
+		{`[1, 2, 3, 4].filter(fn(x) { x % 2 == 0 }).reduce(fn(a, x) { a + x }, 0)`, 6},
+		{`let obj = {"greet": fn(name) { "hi " + name }}; obj.greet("bo")`, "hi bo"},
+		{`let h = {"b": 2, "a": 1}; h.keys().join(",") + h.values().join(",")`, "a,b1,2"},
+		{`map([1], fn(x) { x + 1 })`, []interface{}{2}},
+		{`let total = 0; [1, 2].map(fn(x) { total += x }); total`, 3},
+		{`[[1, 2], [3]].map(fn(xs) { xs.map(fn(x) { x * 10 }) })`, []interface{}{[]interface{}{10, 20}, []interface{}{30}}},
+		{`let fact = fn(n) { if (n < 2) { 1 } else { n * fact(n - 1) } }; [3, 4].map(fact)`, []interface{}{6, 24}},
+		{`["a", "b"].map(upper)`, []interface{}{"A", "B"}},
+		{`"a-b".split(...["-"]).len()`, 2},
+		{`let f = fn() { [1, 2].map(fn(x) { return x + 1; 0 }) }; f()`, []interface{}{2, 3}},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestTryCatch(t *testing.T) {
+	tests := []vmTestCase{
+		{`try { throw "boom" } catch (e) { e }`, "boom"},
+		{`try { 1 } catch (e) { 2 }`, 1},
+		{`let x = try { throw {"code": 7} } catch (e) { e["code"] }; x`, 7},
+		{`try { 10 / 0 } catch (e) { e }`, "division by zero"},
+		{`try { [1][5] = 2 } catch (e) { e }`, "index 5 out of range for array of length 1"},
+		{`try { 1 + "a" } catch (e) { e }`, "type mismatch: INTEGER + STRING"},
+		{`try { len(1) } catch (e) { e }`, "argument to `len` not supported, got INTEGER"},
+		{`let log = []; try { append(log, 1) } finally { append(log, 2) }; log`, []interface{}{1, 2}},
+		{`let log = []; try { throw 1 } catch (e) { append(log, e) } finally { append(log, 2) }; log`, []interface{}{1, 2}},
+		{`let log = []; try { try { throw 1 } finally { append(log, "f") } } catch (e) { append(log, e) }; log`, []interface{}{"f", 1}},
+		{`try { try { throw 1 } catch (e) { throw e + 1 } } catch (e) { e }`, 2},
+		{`let f = fn() { throw "deep" }; let g = fn() { f() + 1 }; try { g() } catch (e) { e }`, "deep"},
+		{`let f = fn() { try { throw 1 } catch (e) { e + 1 } }; f() + f()`, 4},
+		{`try { [1, 2].map(fn(x) { if (x == 2) { throw x } x }) } catch (e) { e * 10 }`, 20},
+		{`[1, 2].map(fn(x) { try { throw x } catch (e) { e * 3 } })`, []interface{}{3, 6}},
+		{`let n = 0; for (i in 0..5) { try { if (i == 3) { break } } finally { n += 1 } }; n`, 4},
+		{`let n = 0; for (i in 0..3) { try { continue } finally { n += 1 } }; n`, 3},
+		{`let log = []; let f = fn() { try { return 1 } finally { append(log, "f") } }; f() + len(log)`, 2},
+		{`let f = fn() { try { return 1 } catch (e) { 0 } }; f(); try { throw 5 } catch (e) { e }`, 5},
+		{`let i = 0; while (true) { try { i += 1; if (i > 2) { break } } catch (e) { 0 } }; try { throw i } catch (e) { e }`, 3},
+	}
+
+	runVmTests(t, tests)
+}
+
+// TestCaughtErrorsMatchEvaluator checks that a caught runtime error has the
+func TestIterNextWithoutIterator(t *testing.T) {
+	instructions := code.Instructions{}
+	for _, ins := range []code.Instructions{
+		code.Make(code.OpConstant, 0),
+		code.Make(code.OpIterNext, 6),
+	} {
+		instructions = append(instructions, ins...)
+	}
+	bytecode := &compiler.Bytecode{
+		Instructions: instructions,
+		Constants:    []object.Object{&object.Integer{Value: 1}},
+	}
+
+	err := New(bytecode).Run()
+	if err == nil || err.Error() != "cannot iterate over INTEGER" {
+		t.Errorf("wrong VM error. want=%q, got=%v", "cannot iterate over INTEGER", err)
+	}
+}
+
+// same message in both engines.
+func TestCaughtErrorsMatchEvaluator(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`try { 1 + "a" } catch (e) { e }`, "type mismatch: INTEGER + STRING"},
+		{`try { "a" < 1 } catch (e) { e }`, "type mismatch: STRING < INTEGER"},
+		{`try { "a" - "b" } catch (e) { e }`, "unknown operator: STRING - STRING"},
+		{`try { true > false } catch (e) { e }`, "unknown operator: BOOLEAN > BOOLEAN"},
+		{`try { 1.5 & 1 } catch (e) { e }`, "unknown operator: FLOAT & INTEGER"},
+		{`try { 1 .. 2.5 } catch (e) { e }`, "unknown operator: INTEGER .. FLOAT"},
+		{`try { "a" .. 1 } catch (e) { e }`, "type mismatch: STRING .. INTEGER"},
+		{`try { -null } catch (e) { e }`, "unknown operator: -NULL"},
+		{`try { ~1.5 } catch (e) { e }`, "unknown operator: ~FLOAT"},
+		{`try { let f = 1; f() } catch (e) { e }`, "not a function: INTEGER"},
+		{`try { let f = fn() { 1 }; f[0] } catch (e) { e }`, "index operator not supported: FUNCTION"},
+		{`try { let f = fn() { 1 }; {f: 1} } catch (e) { e }`, "unusable as hash key: FUNCTION"},
+		{`try { len(fn() { 1 }) } catch (e) { e }`, "argument to `len` not supported, got FUNCTION"},
+		{`try { fn(x) { x }() } catch (e) { e }`, "wrong number of arguments. want=1, got=0"},
+		{`try { 1 / 0 } catch (e) { e }`, "division by zero"},
+	}
+
+	for _, tt := range tests {
+		program := parse(tt.input)
+		comp := compiler.New()
+		err := comp.Compile(program)
+		if err != nil {
+			t.Fatalf("compiler error: %s", err)
+		}
+		machine := New(comp.Bytecode())
+		err = machine.Run()
+		if err != nil {
+			t.Fatalf("vm error: %s", err)
+		}
+		results := map[string]object.Object{
+			"vm":        machine.LastPoppedStackElem(),
+			"evaluator": evaluator.Eval(parse(tt.input), object.NewEnvironment()),
+		}
+		for engine, result := range results {
+			str, ok := result.(*object.String)
+			if !ok {
+				t.Errorf("%s: %q: object is not String. got=%T (%+v)", engine, tt.input, result, result)
+				continue
+			}
+			if str.Value != tt.expected {
+				t.Errorf("%s: %q: wrong message. want=%q, got=%q", engine, tt.input, tt.expected, str.Value)
+			}
+		}
+	}
+}
+
+func TestImports(t *testing.T) {
+	tests := []vmTestCase{
+		{`import "lib/strings" as s; s.shout("hi")`, "HI!"},
+		{`import "lib/strings" as s; s.first + len(s.others)`, 3},
+		{`import "lib/strings" as s; s["first"]`, 1},
+		{`import "lib/strings" as s; s.Pair(1, 2) == s.Pair(1, 2)`, true},
+		{`import "lib/counter" as a; import "lib/counter" as b; a.tick(); b.tick(); a.count[0]`, 2},
+		{`import "lib/counter" as c; c.loud`, "X!"},
+		{`let suffix = "?"; import "lib/strings" as s; s.shout("a") + suffix`, "A!?"},
+		{`import "lib/strings" as s; let f = fn() { s.shout("in") }; f()`, "IN!"},
+	}
+
+	for _, tt := range tests {
+		comp := compiler.New()
+		comp.SetModuleLoader(newTestLoader(), "")
+		err := comp.Compile(parse(tt.input))
+		if err != nil {
+			t.Fatalf("compiler error: %s", err)
+		}
+		machine := New(comp.Bytecode())
+		err = machine.Run()
+		if err != nil {
+			t.Fatalf("vm error: %s", err)
+		}
+		testExpectedObject(t, tt.expected, machine.LastPoppedStackElem())
+	}
+
+	errorTests := []struct {
+		input    string
+		expected string
+	}{
+		{`import "lib/strings" as s; s.suffix`, "1:29: module lib/strings.monkey has no export suffix"},
+		{`import "lib/missing" as m;`, `1:1: importing "lib/missing": module "lib/missing" not found`},
+		{`import "lib/cycle" as c;`, `1:1: importing "lib/cycle": lib/cycle.monkey:1:1: importing "cycle": import cycle: lib/cycle.monkey -> lib/cycle.monkey`},
+		{`import "lib/ping" as p;`, `1:1: importing "lib/ping": lib/ping.monkey:1:1: importing "pong": lib/pong.monkey:2:1: importing "ping": import cycle: lib/ping.monkey -> lib/pong.monkey -> lib/ping.monkey`},
+		{"let x = 1;\nimport \"lib/bad\" as b;", `2:1: importing "lib/bad": lib/bad.monkey:1:5: error[P0001]: expected next token to be IDENT, got = instead`},
+		{`import "lib/broken" as b;`, `1:1: importing "lib/broken": lib/broken.monkey:2:11: division by zero`},
+		{"let x = 1;\nimport \"lib/uses_broken\" as u;", `2:1: importing "lib/uses_broken": lib/uses_broken.monkey:2:1: importing "broken": lib/broken.monkey:2:11: division by zero`},
+	}
+
+	for _, tt := range errorTests {
+		comp := compiler.New()
+		comp.SetModuleLoader(newTestLoader(), "")
+		err := comp.Compile(parse(tt.input))
+		if err == nil {
+			err = New(comp.Bytecode()).Run()
+		}
+		if err == nil || err.Error() != tt.expected {
+			t.Errorf("wrong error for %q. want=%q, got=%v", tt.input, tt.expected, err)
+		}
+	}
+}
+
+var testModules = map[string]string{
+	"lib/strings.monkey": `
+let suffix = "!";
+export let shout = fn(s) { upper(s) + suffix };
+export let [first, ...others] = [1, 2, 3];
+export struct Pair { left, right }
+`,
+	"lib/counter.monkey": `
+import "strings" as s;
+export let count = [0];
+export let tick = fn() { count[0] += 1 };
+export let loud = s.shout("x");
+`,
+	"lib/cycle.monkey": `import "cycle" as c;`,
+	"lib/ping.monkey":  `import "pong" as p;`,
+	"lib/pong.monkey":  "// ping and pong import each other\nimport \"ping\" as p;",
+	"lib/bad.monkey":   `let = 1;`,
+	"lib/broken.monkey": `export let x = 1;
+let y = 1 / 0;`,
+	"lib/uses_broken.monkey": `export let z = 2;
+import "broken" as b;`,
+}
+
+func newTestLoader() *module.Loader {
+	loader := module.NewLoader()
+	loader.ReadFile = func(filename string) ([]byte, error) {
+		source, ok := testModules[filename]
+		if !ok {
+			return nil, os.ErrNotExist
+		}
+		return []byte(source), nil
+	}
+	return loader
+}
+
+func TestConstants(t *testing.T) {
+	tests := []vmTestCase{
+		{"const MAX = 100; let n = 0; for (i in 0..10) { n += MAX }; n", 1000},
+		{`const GREETING = "hi"; let f = fn() { GREETING + "!" }; f()`, "hi!"},
+		{"const ON = true; if (ON) { 1 } else { 2 }", 1},
+		{"const NEG = -1.5; NEG * 2", -3.0},
+		{"const xs = [1]; xs[0] = 2; xs", []interface{}{2}},
+		{"const [a, b] = [1, 2]; a + b", 3},
+		{"let f = fn() { const n = 2; fn(x) { x * n } }; f()(4)", 8},
+		{"const x = 1; let f = fn() { let x = 5; x += 1; x }; f() + x", 7},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestLoops(t *testing.T) {
+	tests := []vmTestCase{
+		{"let i = 0; while (i < 10) { i += 1 }; i", 10},
+		{"let n = 0; for (let i = 0; i < 100000; i += 1) { n += i }; n", 4999950000},
+		{"let n = 0; for (let i = 0; i < 10; i += 1) { if (i % 2 == 0) { continue } n += i }; n", 25},
+		{"let i = 0; while (true) { if (i == 5) { break; } i += 1 }; i", 5},
+		{"let i = 0; for (;;) { i += 1; if (i > 3) { break } }; i", 4},
+		{`let f = fn(n) { let s = ""; let i = 0; while (i < n) { s += str(i); i += 1 } s }; f(4)`, "0123"},
+		{"let f = fn() { let i = 0; while (true) { if (i == 3) { return i * 10 } i += 1 } }; f()", 30},
+		{"let n = 0; for (let i = 0; i < 3; i += 1) { for (let j = 0; j < 3; j += 1) { if (j == i) { break } n += 1 } }; n", 3},
+		{"let fs = []; let i = 0; while (i < 3) { let j = i; fs = push(fs, fn() { j }); i += 1 }; fs[0]() + fs[2]()", 2},
+		{"if (true) { let x = 1; }", Null},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestNullishAndOptionalChains(t *testing.T) {
+	tests := []vmTestCase{
+		{"null", Null},
+		{"null == null", true},
+		{"if (null) { 1 } else { 2 }", 2},
+		{`{"a": 1}["b"] ?? 5`, 5},
+		{"0 ?? 5", 0},
+		{"false ?? 5", false},
+		{"null ?? null ?? 3", 3},
+		{"let n = 0; let f = fn() { n += 1 }; 1 ?? f(); n", 0},
+		{`let h = {"a": {"b": [1, 2]}}; h?.a?.b?[1]`, 2},
+		{`let h = {}; h.x?.b.c.d`, Null},
+		{`let h = {}; h.x?.len()`, Null},
+		{`let h = {"s": "hey"}; h.s?.len()`, 3},
+		{"let n = null; n?[0]", Null},
+		{"let n = null; n?[1:2]", Null},
+		{"[1, 2, 3]?[1:]", []int{2, 3}},
+		{"let n = 0; let f = fn() { n += 1 }; null?.m(f()); n", 0},
+		{`let h = {"f": fn(x) { x * 2 }}; h?.f(4) + (h.g?[0] ?? 1)`, 9},
+		{`let h = {}; [h.a?.b, 1][1]`, 1},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestStructs(t *testing.T) {
+	tests := []vmTestCase{
+		{"struct Point { x, y }; str(Point)", "struct Point"},
+		{"struct Point { x, y }; str(Point(1, 2))", "Point{x: 1, y: 2}"},
+		{"struct Empty {}; str(Empty())", "Empty{}"},
+		{`struct Point { x, y }; let p = Point(1, 2); p.x + p["y"]`, 3},
+		{"struct Point { x, y }; let p = Point(1, 2); p.x = 10; p.y += 1; str(p)", "Point{x: 10, y: 3}"},
+		{"struct Point { x, y }; Point(1, 2) == Point(1, 2.0)", true},
+		{"struct Point { x, y }; Point(1, 2) != Point(2, 1)", true},
+		{"struct A { x }; struct B { x }; A(1) == B(1)", false},
+		{"struct Box { v }; Box([1]) == Box([1])", false},
+		{"struct Box { v }; Box(Box(null)) == Box(Box(null))", true},
+		{"struct Node { next }; let n = Node(null); n.next = n; str(n)", "Node{next: Node{...}}"},
+		{"struct Node { next }; let a = Node(null); a.next = a; let b = Node(null); b.next = b; a == b", true},
+		{"struct Point { x, y }; str(map([[1, 2]], fn(a) { Point(...a) }))", "[Point{x: 1, y: 2}]"},
+		{"struct Counter { n, step }; let c = Counter(1, fn(n) { n + 1 }); c.step(c.n)", 2},
+		{"struct Point { x, y }; let p = Point(1, 2); p?.x", 1},
+		{"let f = fn(x) { struct Wrap { v }; Wrap(x) }; f(1) == f(1)", true},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestBlockScoping(t *testing.T) {
+	tests := []vmTestCase{
+		{"let x = 1; if (true) { let x = 2; x += 1 }; x", 1},
+		{"let x = 1; if (true) { x = 2 }; x", 2},
+		{"let x = 1; let y = if (true) { let x = x + 1; x * 10 }; x + y", 21},
+		{"let f = fn(x) { if (x) { let a = 1; a } else { let b = 2; b } }; f(true) + f(false) * 10", 21},
+		{"let f = if (true) { let a = 1; fn() { a } }; if (true) { let b = 2; b }; f()", 1},
+		{"let f = fn() { let g = if (true) { let a = 1; fn() { a += 1 } }; g(); g() }; f()", 3},
+		{"let fs = []; for (x in 0..3) { fs = push(fs, fn() { x }) }; fs[0]() + fs[2]()", 2},
+		{"let fs = []; let i = 0; while (i < 3) { let j = i; fs = push(fs, fn() { j }); i += 1 }; fs[0]() + fs[2]()", 2},
+		{"let fs = []; for (let i = 0; i < 3; i += 1) { fs = push(fs, fn() { i }) }; fs[0]() + fs[2]()", 6},
+		{"let f = fn(v) { match (v) { [a] => a, [a, b] => a + b } }; f([1]) + f([2, 3])", 6},
+		{"let e = 1; let r = try { throw 2 } catch (e) { e }; r + e", 3},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestForInLoops(t *testing.T) {
+	tests := []vmTestCase{
+		{`let s = 0; for (x in [1, 2, 3]) { s += x }; s`, 6},
+		{`let s = 0; for (i, x in [10, 20, 30]) { s += i * x }; s`, 80},
+		{`let s = 0; for (i in 0..100000) { s += i }; s`, 4999950000},
+		{`let n = 0; for (i in 5..2) { n += 1 }; n`, 0},
+		{`let s = ""; for (c in "héllo") { s = c + s }; s`, "olléh"},
+		{`let s = ""; for (k, v in {"b": 2, "a": 1, "c": 3}) { s += k + str(v) }; s`, "a1b2c3"},
+		{`let s = 0; for (v in {"a": 1, "b": 2}) { s += v }; s`, 3},
+		{`let s = 0; for (x in [1, 2, 3, 4, 5]) { if (x == 2) { continue } if (x == 4) { break } s += x }; s`, 4},
+		{`let f = fn(xs) { for (x in xs) { if (x > 1) { return x } } -1 }; f([0, 1, 5, 7]) + f([])`, 4},
+		{`let n = 0; for (i in 0..3) { for (j in 0..i) { n += 1 } }; n`, 3},
+		{`let s = 0; for (x in [1, 2, 3]) { match (x) { 2 => { continue }, _ => 0 }; s += x }; s`, 4},
+		{`let s = 0; for (x in [1, 2, 3]) { let a = [x]; if (x == 2) { break } else { 0 }; s += a[0] }; s`, 1},
+		{`let n = 0; while (true) { match (n) { 3 => { break }, _ => { n += 1 } } }; n`, 3},
+		{`let n = 0; for (x in 0..5) { try { if (x == 2) { continue } } finally { n += 1 } }; n`, 5},
+		{`let s = 0; for (x in [1, 2]) { let f = fn(y) { if (y) { 10 } else { 1 } }; s += [x, f(x == 2)][1] }; s`, 11},
+		{`let a = [0, if (true) { let i = 0; while (true) { i += 1; if (i == 3) { break } }; i }]; a[1]`, 3},
+		{`let f = fn() { for (x in [1]) { x } }; f()`, Null},
+		{`if (true) { for (x in [1]) { x } }`, Null},
+		{`for (x in [1, 2]) { x }`, Null},
+		{`for (x in []) { }`, Null},
+		{`let i = 0; while (i < 2) { i += 1 }`, Null},
+		{`for (let i = 0; i < 2; i += 1) { i }`, Null},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestMatchExpressions(t *testing.T) {
+	tests := []vmTestCase{
+		{`match (2) { 1 => "one", 2 => "two", _ => "many" }`, "two"},
+		{`match (7) { 1 => "one", _ => "many" }`, "many"},
+		{`match (2.0) { 2 => "int", _ => "other" }`, "int"},
+		{`match ("b") { "a" => 1, "b" => 2 }`, 2},
+		{`match (-1) { -1 => true, _ => false }`, true},
+		{`match (5) { n if n < 0 => -n, n => n * 2 }`, 10},
+		{`match (-5) { n if n < 0 => -n, n => n * 2 }`, 5},
+		{`match ([1, 2, 3]) { [] => 0, [h, ...t] => h + len(t) }`, 3},
+		{`match ([]) { [] => 0, [h, ...t] => h }`, 0},
+		{`match ([1]) { [a, b] => a + b, [a] => a * 10 }`, 10},
+		{`match ([1, [2, 3]]) { [a, [b, c]] => a + b + c }`, 6},
+		{`match ([1, [2]]) { [a, [b, c]] => 0, [a, [b]] => b }`, 2},
+		{`match ([1, 2, 3]) { [_, ...rest] => rest }`, []interface{}{2, 3}},
+		{`match ({"type": "user", "id": 7}) { {"type": "admin"} => 0, {"type": "user", "id": id} => id }`, 7},
+		{`match ({"a": 1}) { {"a": 1, "b": _} => 1, {"a": _} => 2 }`, 2},
+		{`match ({"p": [1, 2]}) { {"p": [x, y]} if x < y => y, _ => 0 }`, 2},
+		{`let f = fn(v) { match (v) { [x, ...xs] => x + f(xs), [] => 0 } }; f([1, 2, 3, 4])`, 10},
+		{`let f = fn(v) { match (v) { [a, b] => match (b) { [c] => a + c, _ => a } } }; f([1, [2]]) + f([3, 4])`, 6},
+		{`match (3) { x => { let y = x * 2; y + 1 } }`, 7},
+		{`match (1) { 1 => { let y = 2; } }`, Null},
+		{`match (null) { null => 1, _ => 2 }`, 1},
+		{`match (0) { null => 1, _ => 2 }`, 2},
+		{`match ({"a": 1}["b"]) { null => "missing", v => v }`, "missing"},
+		{`match ([1, null]) { [_, null] => "hole", _ => "full" }`, "hole"},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestDestructuring(t *testing.T) {
+	tests := []vmTestCase{
+		{`let [a, b, ...rest] = [1, 2, 3, 4]; a + b + len(rest)`, 5},
+		{`let [first, ...others] = [1]; others`, []interface{}{}},
+		{`let {name, age} = {"name": "Ann", "age": 30}; name + str(age)`, "Ann30"},
+		{`let {"n": [x, y]} = {"n": [1, 2]}; x * y`, 2},
+		{`let [_, second] = [1, 2]; second`, 2},
+		{`let f = fn([x, y]) { x + y }; f([3, 4])`, 7},
+		{`let f = fn(a, {b}) { a + b }; f(1, {"b": 2})`, 3},
+		{`let f = fn() { let [a, [b, c]] = [1, [2, 3]]; a * b * c }; f()`, 6},
+		{`let swap = fn([a, b]) { [b, a] }; swap([1, 2])`, []interface{}{2, 1}},
+		{`let f = fn([a]) { fn() { a } }; f([9])()`, 9},
+		{`let sum = fn(xs) { match (xs) { [] => 0, [h, ...t] => h + sum(t) } }; let [a, ...b] = [5, 6, 7]; a + sum(b)`, 18},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestFunctionParameters(t *testing.T) {
+	tests := []vmTestCase{
+		{`let f = fn(a, b = 10) { a + b }; f(1)`, 11},
+		{`let f = fn(a, b = 10) { a + b }; f(1, 2)`, 3},
+		{`let f = fn(a, b = a * 2) { a + b }; f(3)`, 9},
+		{`let f = fn(n = 1) { fn() { n } }; f()()`, 1},
+		{`let f = fn([x, y] = [1, 2]) { x + y }; f()`, 3},
+		{`let f = fn(...xs) { xs }; f()`, []interface{}{}},
+		{`let f = fn(...xs) { xs }; f(1, 2)`, []interface{}{1, 2}},
+		{`let f = fn(a, b = 2, ...rest) { len(rest) }; f(1, 3, 4, 5)`, 2},
+		{`let f = fn(a, b, c) { a + b + c }; let xs = [1, 2, 3]; f(...xs)`, 6},
+		{`let f = fn(a, ...rest) { len(rest) }; f(...[1, 2], ...[3], 4)`, 3},
+		{`len(...["abc"])`, 3},
+		{`let a = [1, 2]; let b = [3]; [...a, ...b, 4, ...a]`, []interface{}{1, 2, 3, 4, 1, 2}},
+		{`let a = [1]; let b = [...a, 2]; a`, []interface{}{1}},
+	}
+
+	runVmTests(t, tests)
+}
+
 func TestFibonacci(t *testing.T) {
 	tests := []vmTestCase{
 		{`let fibonacci=fn(x){if (x==0){0}else{if (x==1){1}else{fibonacci(x-1)+fibonacci(x-2);}}};fibonacci(15);`, 610},
@@ -294,3 +896,69 @@ func TestFibonacci(t *testing.T) {
 	runVmTests(t, tests)
 
 }
+
+func TestRuntimeErrorPositions(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"let x = true;\n-x;", "2:1: unknown operator: -BOOLEAN"},
+		{"let f = fn(a) { a };\nf(1, 2);", "2:2: wrong number of arguments. want=1, got=2"},
+		{"let f = fn() {\n  -true\n};\nf();", "2:3: unknown operator: -BOOLEAN"},
+		{"let x = 0;\n10 / x;", "2:4: division by zero"},
+		{`1 - "a"`, "1:3: type mismatch: INTEGER - STRING"},
+		{"let x = 3;\nmatch (x) { 1 => 1, 2 => 2 }", "2:1: no match arm matched 3"},
+		{"for (x in 5) { x }", "1:1: cannot iterate over INTEGER"},
+		{"let [a, b] = [1];", "1:5: cannot destructure [1] into [a, b]"},
+		{`let {name} = {"age": 1};`, "1:5: cannot destructure {age:1} into {name}"},
+		{"let f = fn(a, [x]) { x };\nf(1, 5)", "1:15: cannot destructure 5 into [x]"},
+		{"let f = fn(a, b = 1) { a };\nf(1, 2, 3)", "2:2: wrong number of arguments. want=1 to 2, got=3"},
+		{"let f = fn(a, ...rest) { a };\nf()", "2:2: wrong number of arguments. want=at least 1, got=0"},
+		{"let a = [1];\n[0, ...a, ...2]", "2:11: cannot spread INTEGER"},
+		{"let n = 1;\nn[0:1]", "2:2: slice operator not supported: INTEGER"},
+		{`[1, 2]["a":]`, "1:7: slice index must be an integer, got STRING"},
+		{"let a = [1];\na[1] = 2", "2:6: index 1 out of range for array of length 1"},
+		{`let s = "ab"; s[0] = "c"`, "1:20: index assignment not supported: STRING"},
+		{`let h = {}; h[[1]] = 1`, "1:20: unusable as hash key: ARRAY"},
+		{"1.foo()", "1:2: undefined method foo for INTEGER"},
+		{"[1, 2].map(fn(x) {\n  -true\n})", "2:3: unknown operator: -BOOLEAN"},
+		{`throw "boom"`, "1:1: uncaught exception: boom"},
+		{"try {\n  1 / 0\n} finally { 1 }", "2:5: division by zero"},
+		{"try { 1 } catch (e) { 2 };\nthrow [1]", "2:1: uncaught exception: [1]"},
+		{"struct Point { x, y }; Point(1, 2).z", "1:35: struct Point has no field z"},
+		{"struct Point { x, y }; let p = Point(1, 2); p.z = 1", "1:49: struct Point has no field z"},
+		{"struct Point { x, y }; let p = Point(1, 2); p[0] = 1", "1:50: struct field name must be a string, got INTEGER"},
+		{"struct Point { x, y }; Point(1)", "1:29: wrong number of arguments. want=2, got=1"},
+	}
+
+	for _, tt := range tests {
+		program := parse(tt.input)
+		comp := compiler.New()
+		err := comp.Compile(program)
+		if err != nil {
+			t.Fatalf("compiler error: %s", err)
+		}
+		machine := New(comp.Bytecode())
+		err = machine.Run()
+		if err == nil {
+			t.Fatalf("expected VM error but resulted in none.")
+		}
+		if err.Error() != tt.expected {
+			t.Errorf("wrong VM error. want=%q, got=%q", tt.expected, err)
+		}
+	}
+}
+
+func TestUnicodeStrings(t *testing.T) {
+	tests := []vmTestCase{
+		{`len("héllo")`, 5},
+		{`len("日本語")`, 3},
+		{`"héllo"[1]`, "é"},
+		{`"日本語"[2]`, "語"},
+		{`let größe = "groß"; größe[3]`, "ß"},
+		{`"日本語"[3]`, Null},
+		{`"abc"[-1]`, Null},
+	}
+
+	runVmTests(t, tests)
+}